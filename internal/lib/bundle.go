@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"context"
+
 	"github.com/rs/zerolog"
 )
 
@@ -15,9 +17,9 @@ func (b *Bundle) SetLogger(_ zerolog.Logger) {
 	// No-op since this is really just a container executor
 }
 
-func (b *Bundle) Execute(_ UserConfig, _ SyncOpts, _ GodotConfig) error {
+func (b *Bundle) Execute(_ context.Context, _ UserConfig, _ SyncOpts, _ GodotConfig) (bool, error) {
 	// Intentional noop, all the inner executors do the actual work
-	return nil
+	return false, nil
 }
 
 func (b *Bundle) GetName() string {
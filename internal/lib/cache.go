@@ -0,0 +1,481 @@
+package lib
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/rs/zerolog"
+)
+
+const (
+	cacheDownloadsDir = "downloads"
+	cacheIndexDir     = "index"
+)
+
+// downloadCache is a content addressed store of downloaded files. Blobs are stored by the sha256 of
+// their contents under downloads/, and index/ maps the cacheKey of a download to the blob it
+// produced.
+// Shared directories use the same layout, but are only ever read from, so they can live on a
+// read-only mount or be baked into an image. An offline cache never falls back to the network
+type downloadCache struct {
+	Dir     string
+	Shared  []string
+	Offline bool
+}
+
+// cacheIndexEntry is the on-disk record of a single cached url
+type cacheIndexEntry struct {
+	Url     string    `json:"url"`
+	Version string    `json:"version"`
+	Sha256  string    `json:"sha256"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Stored  time.Time `json:"stored"`
+}
+
+// CacheEntry describes a single cached download
+type CacheEntry struct {
+	Url      string
+	Version  string
+	Sha256   string
+	Name     string
+	Size     int64
+	LastUsed time.Time
+	Shared   bool
+}
+
+func newDownloadCache(conf UserConfig) downloadCache {
+	return downloadCache{
+		Dir:     conf.CacheDir,
+		Shared:  conf.SharedCacheDirs,
+		Offline: conf.offline != nil,
+	}
+}
+
+// ShortSha256 is the start of the hash, for display
+func (c CacheEntry) ShortSha256() string {
+	if len(c.Sha256) <= 12 {
+		return c.Sha256
+	}
+	return c.Sha256[:12]
+}
+
+// cacheKey identifies a download in the index. A url alone isn't enough, as the same url (i.e a
+// latest/download link) can serve something new with each release, so it's paired with the version
+// the download was resolved to
+func cacheKey(url string, version string) string {
+	return urlKey(version + "\x00" + url)
+}
+
+func urlKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
+
+func fileSha256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("error hashing file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// lookup returns the path of the cached blob for version of url, if any cache has it. Blobs that fail
+// verification are ignored, so a corrupt shared cache can't poison an install
+func (c downloadCache) lookup(url string, version string) (string, bool) {
+	key := cacheKey(url, version)
+	for i, dir := range c.dirs() {
+		indexPath := filepath.Join(dir, cacheIndexDir, key)
+		entry, err := readCacheIndex(indexPath)
+		if err != nil {
+			continue
+		}
+		blob := filepath.Join(dir, cacheDownloadsDir, entry.Sha256)
+		sum, err := fileSha256(blob)
+		if err != nil || sum != entry.Sha256 {
+			continue
+		}
+		// Track usage in our own cache so prune can tell what's still in use
+		if i == 0 && c.Dir != "" {
+			now := time.Now()
+			_ = os.Chtimes(indexPath, now, now)
+		}
+		return blob, true
+	}
+	return "", false
+}
+
+// store moves the file at src into the cache as the contents of version of url, returning the path
+// of the cached blob
+func (c downloadCache) store(url string, version string, name string, src string) (string, error) {
+	sum, err := fileSha256(src)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return "", fmt.Errorf("error checking downloaded file: %w", err)
+	}
+
+	blob := filepath.Join(c.Dir, cacheDownloadsDir, sum)
+	if err := ensureContainingDir(blob); err != nil {
+		return "", err
+	}
+	if err := moveFile(src, blob); err != nil {
+		return "", fmt.Errorf("error moving download into cache: %w", err)
+	}
+
+	entry := cacheIndexEntry{
+		Url:     url,
+		Version: version,
+		Sha256:  sum,
+		Name:    name,
+		Size:    info.Size(),
+		Stored:  time.Now(),
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("error marshalling cache index: %w", err)
+	}
+	indexPath := filepath.Join(c.Dir, cacheIndexDir, cacheKey(url, version))
+	if err := ensureContainingDir(indexPath); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(indexPath, b, 0644); err != nil {
+		return "", fmt.Errorf("error writing cache index: %w", err)
+	}
+
+	return blob, nil
+}
+
+func (c downloadCache) dirs() []string {
+	dirs := []string{}
+	if c.Dir != "" {
+		dirs = append(dirs, c.Dir)
+	}
+	return append(dirs, c.Shared...)
+}
+
+func readCacheIndex(path string) (cacheIndexEntry, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cacheIndexEntry{}, err
+	}
+	var entry cacheIndexEntry
+	if err := json.Unmarshal(b, &entry); err != nil {
+		return cacheIndexEntry{}, fmt.Errorf("error parsing cache index %v: %w", path, err)
+	}
+	return entry, nil
+}
+
+// fetchToFile places the contents of url at dest, serving it from the cache when possible and
+// populating the cache otherwise. version is what url was resolved to, i.e a release tag
+func fetchToFile(ctx context.Context, cache downloadCache, client *http.Client, url string, version string, dest string, requestFunc func(*requests.Builder), logger zerolog.Logger) error {
+	if blob, ok := cache.lookup(url, version); ok {
+		logger.Debug().Str("url", url).Msg("using cached download")
+		return linkOrCopy(blob, dest)
+	}
+	if cache.Offline {
+		return fmt.Errorf("%v is not available offline", url)
+	}
+
+	if err := fetchWithRestarts(ctx, client, url, dest, requestFunc, logger); err != nil {
+		return fmt.Errorf("error downloading from url: %w", err)
+	}
+
+	if cache.Dir == "" {
+		return nil
+	}
+	blob, err := cache.store(url, version, filepath.Base(dest), dest)
+	if err != nil {
+		// The cache is an optimization, don't fail the install over it
+		logger.Warn().Err(err).Str("url", url).Msg("unable to cache download")
+		return nil
+	}
+	return linkOrCopy(blob, dest)
+}
+
+// interruptedDownload is a download that failed after the server started responding, i.e the
+// connection was reset partway through the body
+type interruptedDownload struct {
+	err error
+}
+
+func (i *interruptedDownload) Error() string {
+	return i.err.Error()
+}
+
+func (i *interruptedDownload) Unwrap() error {
+	return i.err
+}
+
+// fetchWithRestarts downloads url to dest. The transport only retries until a response arrives, so
+// downloads interrupted while reading the body are restarted here, as many times as the client
+// would retry a request
+func fetchWithRestarts(ctx context.Context, client *http.Client, url string, dest string, requestFunc func(*requests.Builder), logger zerolog.Logger) error {
+	retry, ok := client.Transport.(*retryTransport)
+	if !ok {
+		retry = &retryTransport{retries: defaultHttpRetries, backoff: defaultRetryBackoff}
+	}
+	toFile := toFileWithProgress(dest, "downloading "+filepath.Base(dest), logger)
+
+	for attempt := 0; ; attempt++ {
+		req := requests.
+			URL(url).
+			Client(client).
+			Handle(func(res *http.Response) error {
+				if err := toFile(res); err != nil {
+					return &interruptedDownload{err: err}
+				}
+				return nil
+			})
+		if requestFunc != nil {
+			requestFunc(req)
+		}
+		err := req.Fetch(ctx)
+		var interrupted *interruptedDownload
+		if err == nil || !errors.As(err, &interrupted) || ctx.Err() != nil || attempt >= retry.retries {
+			return err
+		}
+
+		wait := retry.backoffFor(attempt)
+		logger.Warn().Err(err).Str("url", url).Dur("wait", wait).Int("attempt", attempt+1).Msg("download interrupted, restarting")
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// ensure makes sure url is present in the writable cache, copying it out of a shared cache or
+// downloading it as required
+func (c downloadCache) ensure(ctx context.Context, client *http.Client, url string, version string, name string, requestFunc func(*requests.Builder), logger zerolog.Logger) error {
+	own := downloadCache{Dir: c.Dir}
+	if _, ok := own.lookup(url, version); ok {
+		return nil
+	}
+
+	dir, err := os.MkdirTemp("", "godot-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dest := filepath.Join(dir, name)
+	if err := fetchToFile(ctx, downloadCache{Shared: c.dirs()}, client, url, version, dest, requestFunc, logger); err != nil {
+		return err
+	}
+	if _, err := own.store(url, version, name, dest); err != nil {
+		return fmt.Errorf("error storing download: %w", err)
+	}
+	return nil
+}
+
+// linkOrCopy hard links src to dest, falling back to a copy when that's not possible (i.e across
+// filesystems)
+func linkOrCopy(src string, dest string) error {
+	if err := os.Link(src, dest); err == nil {
+		return nil
+	}
+
+	sfile, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening %v: %w", src, err)
+	}
+	defer sfile.Close()
+
+	dfile, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("error creating %v: %w", dest, err)
+	}
+	defer dfile.Close()
+
+	if _, err := io.Copy(dfile, sfile); err != nil {
+		return fmt.Errorf("error copying %v: %w", src, err)
+	}
+	return nil
+}
+
+// moveFile renames src to dest, falling back to a copy & delete across filesystems
+func moveFile(src string, dest string) error {
+	if err := os.Rename(src, dest); err == nil {
+		return nil
+	}
+	if err := linkOrCopy(src, dest); err != nil {
+		return err
+	}
+	return os.Remove(src)
+}
+
+// entries lists everything in the cache, including shared caches
+func (c downloadCache) entries() ([]CacheEntry, error) {
+	entries := []CacheEntry{}
+	for _, dir := range c.dirs() {
+		indexDir := filepath.Join(dir, cacheIndexDir)
+		files, err := os.ReadDir(indexDir)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading cache index: %w", err)
+		}
+		for _, f := range files {
+			info, err := f.Info()
+			if err != nil {
+				return nil, fmt.Errorf("error reading cache index: %w", err)
+			}
+			entry, err := readCacheIndex(filepath.Join(indexDir, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, CacheEntry{
+				Url:      entry.Url,
+				Version:  entry.Version,
+				Sha256:   entry.Sha256,
+				Name:     entry.Name,
+				Size:     entry.Size,
+				LastUsed: info.ModTime(),
+				Shared:   dir != c.Dir,
+			})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+// prune removes index entries not used since cutoff, and then any blobs no longer referenced. Only
+// the writable cache is pruned
+func (c downloadCache) prune(cutoff time.Time) (int, error) {
+	if c.Dir == "" {
+		return 0, nil
+	}
+
+	indexDir := filepath.Join(c.Dir, cacheIndexDir)
+	files, err := os.ReadDir(indexDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("error reading cache index: %w", err)
+	}
+
+	removed := 0
+	referenced := map[string]struct{}{}
+	for _, f := range files {
+		indexPath := filepath.Join(indexDir, f.Name())
+		info, err := f.Info()
+		if err != nil {
+			return removed, fmt.Errorf("error reading cache index: %w", err)
+		}
+		entry, err := readCacheIndex(indexPath)
+		if err == nil && !info.ModTime().Before(cutoff) {
+			referenced[entry.Sha256] = struct{}{}
+			continue
+		}
+		if err := os.Remove(indexPath); err != nil {
+			return removed, fmt.Errorf("error removing cache index: %w", err)
+		}
+		removed++
+	}
+
+	blobDir := filepath.Join(c.Dir, cacheDownloadsDir)
+	blobs, err := os.ReadDir(blobDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return removed, fmt.Errorf("error reading cache downloads: %w", err)
+	}
+	for _, b := range blobs {
+		if _, ok := referenced[b.Name()]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(blobDir, b.Name())); err != nil {
+			return removed, fmt.Errorf("error removing cached download: %w", err)
+		}
+	}
+
+	return removed, nil
+}
+
+// parseAge parses a duration, additionally accepting a number of days such as "30d"
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	return d, nil
+}
+
+func cacheFromUserConfig() (downloadCache, error) {
+	conf, err := NewOverrideableConfig(ConfigOverrides{
+		IgnoreVault: true,
+	})
+	if err != nil {
+		return downloadCache{}, fmt.Errorf("error getting config: %w", err)
+	}
+	return newDownloadCache(conf), nil
+}
+
+func CacheList() ([]CacheEntry, error) {
+	cache, err := cacheFromUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	return cache.entries()
+}
+
+func CacheClean(logger zerolog.Logger) error {
+	cache, err := cacheFromUserConfig()
+	if err != nil {
+		return err
+	}
+	if cache.Dir == "" {
+		return nil
+	}
+	logger.Info().Str("dir", cache.Dir).Msg("removing download cache")
+	for _, sub := range []string{cacheIndexDir, cacheDownloadsDir} {
+		if err := os.RemoveAll(filepath.Join(cache.Dir, sub)); err != nil {
+			return fmt.Errorf("error removing cache: %w", err)
+		}
+	}
+	return nil
+}
+
+func CachePrune(olderThan string, logger zerolog.Logger) error {
+	age, err := parseAge(olderThan)
+	if err != nil {
+		return err
+	}
+	cache, err := cacheFromUserConfig()
+	if err != nil {
+		return err
+	}
+	removed, err := cache.prune(time.Now().Add(-age))
+	if err != nil {
+		return err
+	}
+	logger.Info().Int("removed", removed).Msg("pruned download cache")
+	return nil
+}
@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadCache(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		fmt.Fprint(w, "contents of "+r.URL.Path)
+	}))
+	defer srv.Close()
+
+	log := zerolog.Nop()
+
+	t.Run("populates_and_reuses", func(t *testing.T) {
+		hits = 0
+		cache := downloadCache{Dir: t.TempDir()}
+
+		first := filepath.Join(t.TempDir(), "tool.tar.gz")
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/tool", "v1", first, nil, log))
+		requireContents(t, first, "contents of /tool")
+
+		second := filepath.Join(t.TempDir(), "tool.tar.gz")
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/tool", "v1", second, nil, log))
+		requireContents(t, second, "contents of /tool")
+		require.Equal(t, 1, hits)
+
+		entries, err := cache.entries()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		require.Equal(t, srv.URL+"/tool", entries[0].Url)
+		require.Equal(t, "tool.tar.gz", entries[0].Name)
+		require.False(t, entries[0].Shared)
+	})
+
+	t.Run("new_versions_of_a_url_are_fetched_again", func(t *testing.T) {
+		hits = 0
+		cache := downloadCache{Dir: t.TempDir()}
+
+		// i.e a releases/latest/download url, which serves something new with every release
+		url := srv.URL + "/latest/download/tool"
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, url, "v1", filepath.Join(t.TempDir(), "tool"), nil, log))
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, url, "v2", filepath.Join(t.TempDir(), "tool"), nil, log))
+		require.Equal(t, 2, hits)
+
+		entries, err := cache.entries()
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{"v1", "v2"}, []string{entries[0].Version, entries[1].Version})
+	})
+
+	t.Run("shared_cache_is_read_only", func(t *testing.T) {
+		hits = 0
+		shared := downloadCache{Dir: t.TempDir()}
+		require.NoError(t, fetchToFile(context.Background(), shared, http.DefaultClient, srv.URL+"/shared", "v1", filepath.Join(t.TempDir(), "shared"), nil, log))
+		require.Equal(t, 1, hits)
+
+		cache := downloadCache{Dir: t.TempDir(), Shared: []string{shared.Dir}}
+		dest := filepath.Join(t.TempDir(), "shared")
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/shared", "v1", dest, nil, log))
+		requireContents(t, dest, "contents of /shared")
+		require.Equal(t, 1, hits)
+
+		// Nothing should have been written to the local cache
+		_, err := os.Stat(filepath.Join(cache.Dir, cacheIndexDir))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("corrupt_blob_is_ignored", func(t *testing.T) {
+		hits = 0
+		cache := downloadCache{Dir: t.TempDir()}
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/corrupt", "v1", filepath.Join(t.TempDir(), "corrupt"), nil, log))
+
+		blob, ok := cache.lookup(srv.URL+"/corrupt", "v1")
+		require.True(t, ok)
+		require.NoError(t, os.Remove(blob))
+		require.NoError(t, os.WriteFile(blob, []byte("tampered"), 0644))
+
+		dest := filepath.Join(t.TempDir(), "corrupt")
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/corrupt", "v1", dest, nil, log))
+		requireContents(t, dest, "contents of /corrupt")
+		require.Equal(t, 2, hits)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		cache := downloadCache{Dir: t.TempDir()}
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/old", "v1", filepath.Join(t.TempDir(), "old"), nil, log))
+		require.NoError(t, fetchToFile(context.Background(), cache, http.DefaultClient, srv.URL+"/new", "v1", filepath.Join(t.TempDir(), "new"), nil, log))
+
+		old := time.Now().Add(-48 * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(cache.Dir, cacheIndexDir, cacheKey(srv.URL+"/old", "v1")), old, old))
+
+		removed, err := cache.prune(time.Now().Add(-24 * time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, 1, removed)
+
+		_, ok := cache.lookup(srv.URL+"/old", "v1")
+		require.False(t, ok)
+		_, ok = cache.lookup(srv.URL+"/new", "v1")
+		require.True(t, ok)
+
+		blobs, err := os.ReadDir(filepath.Join(cache.Dir, cacheDownloadsDir))
+		require.NoError(t, err)
+		require.Len(t, blobs, 1)
+	})
+}
+
+func TestFetchToFileRestartsInterruptedDownloads(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Length", "1024")
+		if calls > 1 {
+			_, _ = w.Write(make([]byte, 1024))
+			return
+		}
+		// Drop the connection partway through the body
+		_, _ = w.Write(make([]byte, 10))
+		w.(http.Flusher).Flush()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		require.NoError(t, err)
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	clientWith := func(retries int) *http.Client {
+		return &http.Client{Transport: &retryTransport{base: http.DefaultTransport, retries: retries, backoff: time.Millisecond}}
+	}
+
+	dest := filepath.Join(t.TempDir(), "tool")
+	require.NoError(t, fetchToFile(context.Background(), downloadCache{}, clientWith(2), srv.URL, "v1", dest, nil, zerolog.Nop()))
+	info, err := os.Stat(dest)
+	require.NoError(t, err)
+	require.Equal(t, int64(1024), info.Size())
+	require.Equal(t, 2, calls)
+
+	t.Run("until retries run out", func(t *testing.T) {
+		calls = 0
+		err := fetchToFile(context.Background(), downloadCache{}, clientWith(0), srv.URL, "v1", dest, nil, zerolog.Nop())
+		require.Error(t, err)
+		require.Equal(t, 1, calls)
+	})
+}
+
+func TestCacheEntryShortSha256(t *testing.T) {
+	require.Equal(t, "0123456789ab", CacheEntry{Sha256: "0123456789abcdef"}.ShortSha256())
+	require.Equal(t, "0123", CacheEntry{Sha256: "0123"}.ShortSha256())
+	require.Equal(t, "", CacheEntry{}.ShortSha256())
+}
+
+func TestParseAge(t *testing.T) {
+	d, err := parseAge("30d")
+	require.NoError(t, err)
+	require.Equal(t, 30*24*time.Hour, d)
+
+	d, err = parseAge("90m")
+	require.NoError(t, err)
+	require.Equal(t, 90*time.Minute, d)
+
+	_, err = parseAge("xd")
+	require.Error(t, err)
+}
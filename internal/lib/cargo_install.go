@@ -0,0 +1,102 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+var _ Executor = (*CargoInstall)(nil)
+
+type CargoInstall struct {
+	Name     string         `yaml:"-"`
+	Package  string         `yaml:"package" mapstructure:"package"`
+	Version  string         `yaml:"version" mapstructure:"version"`
+	Locked   bool           `yaml:"locked" mapstructure:"locked"`
+	Features []string       `yaml:"features" mapstructure:"features"`
+	log      zerolog.Logger `yaml:"-"`
+}
+
+func (c *CargoInstall) SetLogger(log zerolog.Logger) {
+	c.log = log
+}
+
+func (c *CargoInstall) Type() ExecutorType {
+	return ExecutorTypeCargoInstall
+}
+
+func (c *CargoInstall) GetName() string {
+	return c.Name
+}
+
+func (c *CargoInstall) SetName(s string) {
+	c.Name = s
+}
+
+func (c *CargoInstall) Validate() error {
+	var errs *multierror.Error
+
+	if c.Package == "" {
+		errs = multierror.Append(errs, fmt.Errorf("package is required"))
+	}
+	if strings.Contains(c.Package, "@") {
+		errs = multierror.Append(errs, fmt.Errorf("package should not include a version, use version instead"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *CargoInstall) Execute(ctx context.Context, conf UserConfig, _ SyncOpts, _ GodotConfig) (bool, error) {
+	cargo := findTool("cargo", filepath.Join(conf.HomeDir, ".cargo", "bin", "cargo"))
+	runner := conf.commandRunner()
+
+	stdout, stderr, err := runner.Run(ctx, cargo, "install", "--list")
+	if err != nil {
+		return false, fmt.Errorf("error listing installed crates: %v\n%v", err, stderr)
+	}
+	installed, ok := parseCargoInstallList(stdout)[c.Package]
+	if ok && (c.Version == "" || strings.TrimPrefix(c.Version, "v") == installed) {
+		c.log.Debug().Str("package", c.Package).Str("version", installed).Msg("already installed")
+		return false, nil
+	}
+
+	c.log.Info().Str("package", c.Package).Msg("cargo installing")
+	args := []string{"install", c.Package}
+	if c.Version != "" {
+		args = append(args, "--version", strings.TrimPrefix(c.Version, "v"))
+	}
+	if c.Locked {
+		args = append(args, "--locked")
+	}
+	if len(c.Features) > 0 {
+		args = append(args, "--features", strings.Join(c.Features, ","))
+	}
+	if _, stderr, err := runner.Run(ctx, cargo, args...); err != nil {
+		return false, fmt.Errorf("error installing package: %v\n%v", err, stderr)
+	}
+	return true, nil
+}
+
+// parseCargoInstallList reads the crate versions out of `cargo install --list`, which looks like
+//
+//	ripgrep v14.1.0:
+//	    rg
+func parseCargoInstallList(out string) map[string]string {
+	installed := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if line == "" || unicode.IsSpace(rune(line[0])) {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		installed[fields[0]] = strings.TrimPrefix(strings.TrimSuffix(fields[1], ":"), "v")
+	}
+	return installed
+}
@@ -0,0 +1,79 @@
+package lib
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCargoInstallList(t *testing.T) {
+	out := `cargo-edit v0.12.2 (https://github.com/killercup/cargo-edit#4f2c8e3a):
+    cargo-add
+    cargo-rm
+ripgrep v14.1.0:
+    rg
+`
+	require.Equal(t, map[string]string{"cargo-edit": "0.12.2", "ripgrep": "14.1.0"}, parseCargoInstallList(out))
+}
+
+func TestCargoInstallExecute(t *testing.T) {
+	// Nothing on the PATH, so the rustup location is used
+	t.Setenv("PATH", t.TempDir())
+	home := buildDirectoryStructure(t, map[string]string{
+		".cargo/bin/cargo": "#!/bin/sh\n",
+	})
+	cargo := filepath.Join(home, ".cargo", "bin", "cargo")
+
+	newRunner := func() *fakeRunner {
+		return &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			cargo + " install --list": func(args []string) (string, string, error) {
+				return "ripgrep v14.1.0:\n    rg\n", "", nil
+			},
+		}}
+	}
+
+	tcs := []struct {
+		name    string
+		install *CargoInstall
+		want    []string
+	}{
+		{
+			name:    "unpinned and installed",
+			install: &CargoInstall{Package: "ripgrep"},
+			want:    []string{cargo + " install --list"},
+		},
+		{
+			name:    "pinned and installed",
+			install: &CargoInstall{Package: "ripgrep", Version: "v14.1.0"},
+			want:    []string{cargo + " install --list"},
+		},
+		{
+			name:    "different version",
+			install: &CargoInstall{Package: "ripgrep", Version: "14.1.1", Locked: true},
+			want:    []string{cargo + " install --list", cargo + " install ripgrep --version 14.1.1 --locked"},
+		},
+		{
+			name:    "missing",
+			install: &CargoInstall{Package: "bat", Features: []string{"minimal-application", "git"}},
+			want:    []string{cargo + " install --list", cargo + " install bat --features minimal-application,git"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := newRunner()
+			conf := UserConfig{HomeDir: home, runner: runner}
+			changed, err := tc.install.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, runner.commands)
+			require.Equal(t, len(tc.want) > 1, changed)
+		})
+	}
+}
+
+func TestCargoInstallValidate(t *testing.T) {
+	require.ErrorContains(t, (&CargoInstall{}).Validate(), "package is required")
+	require.ErrorContains(t, (&CargoInstall{Package: "ripgrep@14.1.0"}).Validate(), "use version instead")
+	require.NoError(t, (&CargoInstall{Package: "ripgrep"}).Validate())
+}
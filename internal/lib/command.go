@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var _ Executor = (*Command)(nil)
+
+const (
+	// commandStateDir holds the rendered hash each command last ran against, under the build location
+	commandStateDir = "commands"
+	defaultShell    = "sh"
+	// commandWaitDelay is how long to wait for output from anything a timed out command left behind
+	commandWaitDelay = 5 * time.Second
+)
+
+type Command struct {
+	Name          string            `yaml:"-"`
+	Script        string            `yaml:"script" mapstructure:"script"`
+	Run           string            `yaml:"run" mapstructure:"run"`
+	Shell         string            `yaml:"shell" mapstructure:"shell"`
+	Creates       string            `yaml:"creates" mapstructure:"creates"`
+	Unless        string            `yaml:"unless" mapstructure:"unless"`
+	OnlyIf        string            `yaml:"only-if" mapstructure:"only-if"`
+	RunOnChangeOf []string          `yaml:"run-on-change-of" mapstructure:"run-on-change-of"`
+	Env           map[string]string `yaml:"env" mapstructure:"env"`
+	Dir           string            `yaml:"dir" mapstructure:"dir"`
+	Timeout       string            `yaml:"timeout" mapstructure:"timeout"`
+	log           zerolog.Logger    `yaml:"-"`
+}
+
+func (c *Command) SetLogger(log zerolog.Logger) {
+	c.log = log
+}
+
+func (c *Command) Type() ExecutorType {
+	return ExecutorTypeCommand
+}
+
+func (c *Command) GetName() string {
+	return c.Name
+}
+
+func (c *Command) SetName(s string) {
+	c.Name = s
+}
+
+func (c *Command) Validate() error {
+	var errs *multierror.Error
+
+	if (c.Script == "") == (c.Run == "") {
+		errs = multierror.Append(errs, fmt.Errorf("exactly one of script or run is required"))
+	}
+	if filepath.IsAbs(c.Script) {
+		errs = multierror.Append(errs, fmt.Errorf("script should be relative to the dotfiles repo"))
+	}
+	if _, err := parseDurationOr(c.Timeout, 0, "timeout"); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	for key := range c.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			errs = multierror.Append(errs, fmt.Errorf("invalid environment variable name %q", key))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *Command) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
+	timeout, err := parseDurationOr(c.Timeout, 0, "timeout")
+	if err != nil {
+		return false, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if c.Creates != "" {
+		if _, err := os.Stat(replaceTilde(c.Creates, conf.HomeDir)); err == nil {
+			c.log.Debug().Str("creates", c.Creates).Msg("already exists, skipping")
+			return false, nil
+		}
+	}
+
+	if c.Unless != "" {
+		if err := c.check(ctx, conf, c.Unless); err == nil {
+			c.log.Debug().Str("unless", c.Unless).Msg("check succeeded, skipping")
+			return false, nil
+		} else if ctx.Err() != nil {
+			return false, fmt.Errorf("error running unless check: %w", ctx.Err())
+		}
+	}
+
+	if c.OnlyIf != "" {
+		if err := c.check(ctx, conf, c.OnlyIf); err != nil {
+			if ctx.Err() != nil {
+				return false, fmt.Errorf("error running only-if check: %w", ctx.Err())
+			}
+			c.log.Debug().Str("only-if", c.OnlyIf).Msg("check failed, skipping")
+			return false, nil
+		}
+	}
+
+	hash := ""
+	if len(c.RunOnChangeOf) > 0 {
+		hash, err = c.renderedHash(conf, godotConf)
+		if err != nil {
+			return false, err
+		}
+		if previous, err := os.ReadFile(c.statePath(conf)); err == nil && string(previous) == hash {
+			c.log.Debug().Msg("tracked templates unchanged, skipping")
+			return false, nil
+		}
+	}
+
+	c.log.Info().Str("name", c.Name).Msg("running command")
+	name, args := c.argv(conf)
+	cmd := c.command(ctx, conf, name, args...)
+	var stderr bytes.Buffer
+	stdoutLog := &logWriter{log: c.log, stream: "stdout"}
+	stderrLog := &logWriter{log: c.log, stream: "stderr"}
+	cmd.Stdout = stdoutLog
+	cmd.Stderr = io.MultiWriter(stderrLog, &stderr)
+	err = cmd.Run()
+	stdoutLog.Flush()
+	stderrLog.Flush()
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return false, fmt.Errorf("error running command: %w\n%v", err, stderr.String())
+	}
+
+	if hash != "" {
+		state := c.statePath(conf)
+		if err := ensureContainingDir(state); err != nil {
+			return false, err
+		}
+		if err := opts.journal.record(state); err != nil {
+			return false, err
+		}
+		if err := os.WriteFile(state, []byte(hash), 0644); err != nil {
+			return false, fmt.Errorf("error recording rendered hash: %w", err)
+		}
+	}
+	return true, nil
+}
+
+func (c *Command) shell() string {
+	if c.Shell == "" {
+		return defaultShell
+	}
+	return c.Shell
+}
+
+// argv is what to run; scripts are run directly, so their shebang is respected, and inline commands
+// are run with the shell
+func (c *Command) argv(conf UserConfig) (string, []string) {
+	if c.Script != "" {
+		return filepath.Join(conf.CloneLocation, c.Script), nil
+	}
+	return c.shell(), []string{"-c", c.Run}
+}
+
+// check runs an unless/only-if check, succeeding when it exits 0
+func (c *Command) check(ctx context.Context, conf UserConfig, check string) error {
+	cmd := c.command(ctx, conf, c.shell(), "-c", check)
+	return cmd.Run()
+}
+
+func (c *Command) command(ctx context.Context, conf UserConfig, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = commandWaitDelay
+	cmd.Dir = conf.HomeDir
+	if c.Dir != "" {
+		cmd.Dir = replaceTilde(c.Dir, conf.HomeDir)
+	}
+
+	keys := lo.Keys(c.Env)
+	sort.Strings(keys)
+	cmd.Env = append(os.Environ(), lo.Map(keys, func(key string, _ int) string {
+		return key + "=" + c.Env[key]
+	})...)
+	return cmd
+}
+
+// renderedHash is a hash across the rendered output of every config file in run-on-change-of
+func (c *Command) renderedHash(conf UserConfig, godotConf GodotConfig) (string, error) {
+	h := sha256.New()
+	for _, name := range c.RunOnChangeOf {
+		godotEx, ok := godotConf.Executors[name]
+		if !ok || godotEx.Type != ExecutorTypeConfigFile {
+			return "", fmt.Errorf("run-on-change-of references unknown config-file %v", name)
+		}
+		ex, err := godotEx.AsExecutor()
+		if err != nil {
+			return "", err
+		}
+		rendered, err := os.ReadFile(filepath.Join(conf.BuildLocation, ex.(*ConfigFile).TemplateName))
+		if errors.Is(err, os.ErrNotExist) {
+			// Not rendered for this target, which is a state of its own
+			rendered = nil
+		} else if err != nil {
+			return "", fmt.Errorf("error reading rendered %v: %w", name, err)
+		}
+		fmt.Fprintf(h, "%v\x00%x\x00", name, sha256.Sum256(rendered))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func (c *Command) statePath(conf UserConfig) string {
+	return filepath.Join(conf.BuildLocation, commandStateDir, c.Name)
+}
+
+// logWriter logs everything written to it, a line at a time
+type logWriter struct {
+	log    zerolog.Logger
+	stream string
+	buf    []byte
+}
+
+func (l *logWriter) Write(p []byte) (int, error) {
+	l.buf = append(l.buf, p...)
+	for {
+		i := bytes.IndexByte(l.buf, '\n')
+		if i < 0 {
+			break
+		}
+		l.log.Info().Str("stream", l.stream).Msg(string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs any trailing output that didn't end in a newline
+func (l *logWriter) Flush() {
+	if len(l.buf) > 0 {
+		l.log.Info().Str("stream", l.stream).Msg(string(l.buf))
+		l.buf = nil
+	}
+}
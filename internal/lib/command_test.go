@@ -0,0 +1,177 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// runCount is how many times a command appending to its log file has run
+func runCount(t *testing.T, log string) int {
+	t.Helper()
+	b, err := os.ReadFile(log)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	require.NoError(t, err)
+	return bytes.Count(b, []byte("\n"))
+}
+
+func TestCommandExecute(t *testing.T) {
+	home := t.TempDir()
+	conf := UserConfig{HomeDir: home, BuildLocation: t.TempDir()}
+	log := filepath.Join(home, "runs")
+
+	run := func(t *testing.T, c *Command) {
+		t.Helper()
+		c.Run = "echo ran >> " + log
+		c.SetLogger(zerolog.Nop())
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+	}
+
+	t.Run("creates", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(log))
+		c := &Command{Name: "creates", Creates: "~/marker"}
+		run(t, c)
+		require.Equal(t, 1, runCount(t, log))
+		require.NoError(t, os.WriteFile(filepath.Join(home, "marker"), nil, 0644))
+		run(t, c)
+		require.Equal(t, 1, runCount(t, log))
+	})
+
+	t.Run("unless", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(log))
+		run(t, &Command{Name: "unless", Unless: "false"})
+		run(t, &Command{Name: "unless", Unless: "true"})
+		require.Equal(t, 1, runCount(t, log))
+	})
+
+	t.Run("only-if", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(log))
+		run(t, &Command{Name: "only-if", OnlyIf: "true"})
+		run(t, &Command{Name: "only-if", OnlyIf: "false"})
+		require.Equal(t, 1, runCount(t, log))
+	})
+
+	t.Run("no guards always runs", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(log))
+		run(t, &Command{Name: "always"})
+		run(t, &Command{Name: "always"})
+		require.Equal(t, 2, runCount(t, log))
+	})
+}
+
+func TestCommandEnvironment(t *testing.T) {
+	home := t.TempDir()
+	clone := buildDirectoryStructure(t, map[string]string{
+		"scripts/setup.sh": "#!/bin/sh\necho \"$GREETING from $(pwd)\" > out\n",
+	})
+	require.NoError(t, os.Chmod(filepath.Join(clone, "scripts", "setup.sh"), 0755))
+	conf := UserConfig{HomeDir: home, CloneLocation: clone}
+
+	t.Run("script runs in the home directory", func(t *testing.T) {
+		c := &Command{Script: "scripts/setup.sh", Env: map[string]string{"GREETING": "hello"}}
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(home, "out"), "hello from "+home+"\n")
+	})
+
+	t.Run("working directory", func(t *testing.T) {
+		require.NoError(t, os.MkdirAll(filepath.Join(home, "work"), 0755))
+		c := &Command{Script: "scripts/setup.sh", Dir: "~/work", Env: map[string]string{"GREETING": "hi"}}
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(home, "work", "out"), "hi from "+filepath.Join(home, "work")+"\n")
+	})
+
+	t.Run("output is logged", func(t *testing.T) {
+		var buf bytes.Buffer
+		c := &Command{Run: "echo to stdout; printf 'to stderr' >&2"}
+		c.SetLogger(zerolog.New(&buf))
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), `"stream":"stdout","message":"to stdout"`)
+		require.Contains(t, buf.String(), `"stream":"stderr","message":"to stderr"`)
+	})
+
+	t.Run("failures include stderr", func(t *testing.T) {
+		c := &Command{Run: "echo something broke >&2; exit 3"}
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.ErrorContains(t, err, "exit status 3")
+		require.ErrorContains(t, err, "something broke")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		c := &Command{Run: "exec sleep 5", Timeout: "50ms"}
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestCommandRunOnChangeOf(t *testing.T) {
+	home := t.TempDir()
+	build := t.TempDir()
+	conf := UserConfig{HomeDir: home, BuildLocation: build}
+	godotConf := GodotConfig{Executors: map[string]GodotExecutor{
+		"bat-config": {Name: "bat-config", Type: ExecutorTypeConfigFile, Spec: map[string]any{
+			"template-name": "bat",
+			"destination":   "~/.config/bat/config",
+		}},
+	}}
+	log := filepath.Join(home, "runs")
+	c := &Command{Name: "bat-cache", Run: "echo ran >> " + log, RunOnChangeOf: []string{"bat-config"}}
+
+	require.NoError(t, os.WriteFile(filepath.Join(build, "bat"), []byte("--theme=one"), 0644))
+	_, err := c.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+	require.NoError(t, err)
+	_, err = c.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+	require.NoError(t, err)
+	require.Equal(t, 1, runCount(t, log))
+
+	require.NoError(t, os.WriteFile(filepath.Join(build, "bat"), []byte("--theme=two"), 0644))
+	j, err := newJournal(zerolog.Nop())
+	require.NoError(t, err)
+	defer j.close()
+	_, err = c.Execute(context.Background(), conf, SyncOpts{journal: j}, godotConf)
+	require.NoError(t, err)
+	require.Equal(t, 2, runCount(t, log))
+
+	t.Run("rolling back forgets the run", func(t *testing.T) {
+		require.NoError(t, j.rollback())
+		_, err := c.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.NoError(t, err)
+		require.Equal(t, 3, runCount(t, log))
+	})
+
+	t.Run("failures don't record the hash", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filepath.Join(build, "bat"), []byte("--theme=three"), 0644))
+		failing := &Command{Name: "bat-cache", Run: "exit 1", RunOnChangeOf: []string{"bat-config"}}
+		_, err := failing.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.Error(t, err)
+		_, err = c.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.NoError(t, err)
+		require.Equal(t, 4, runCount(t, log))
+	})
+}
+
+func TestCommandValidate(t *testing.T) {
+	require.ErrorContains(t, (&Command{}).Validate(), "exactly one of script or run")
+	require.ErrorContains(t, (&Command{Run: "true", Script: "a.sh"}).Validate(), "exactly one of script or run")
+	require.ErrorContains(t, (&Command{Script: "/etc/a.sh"}).Validate(), "relative to the dotfiles repo")
+	require.ErrorContains(t, (&Command{Run: "true", Timeout: "soon"}).Validate(), "invalid timeout")
+	require.NoError(t, (&Command{Run: "true", Timeout: "5m", Env: map[string]string{"A": "b"}}).Validate())
+
+	conf := GodotConfig{Executors: map[string]GodotExecutor{
+		"cmd": {Name: "cmd", Type: ExecutorTypeCommand, Spec: map[string]any{
+			"run":              "true",
+			"run-on-change-of": []string{"missing"},
+		}},
+	}}
+	require.ErrorContains(t, conf.Validate(), "executor cmd references unknown config-file missing")
+}
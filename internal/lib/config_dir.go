@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 )
 
 var _ Executor = (*ConfigDir)(nil)
+var _ generationRecorder = (*ConfigDir)(nil)
 
 type ConfigDir struct {
 	Name        string         `yaml:"-"`
@@ -19,13 +21,46 @@ type ConfigDir struct {
 	log         zerolog.Logger `yaml:"-"`
 }
 
-func (c *ConfigDir) Execute(conf UserConfig, opts SyncOpts, godotConf GodotConfig) error {
+func (c *ConfigDir) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
 	c.log.Info().Str("config-dir", c.DirName).Msg("ensuring config-dir")
-	files, err := c.getFiles(conf)
+	configFiles, err := c.configFiles(conf)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	for _, configFile := range configFiles {
+		fileChanged, err := configFile.Execute(ctx, conf, opts, godotConf)
+		if err != nil {
+			return false, fmt.Errorf("error handling %v: %w", configFile.TemplateName, err)
+		}
+		changed = changed || fileChanged
+	}
+
+	return changed, nil
+}
+
+func (c *ConfigDir) recordGeneration(conf UserConfig, gen *Generation) error {
+	configFiles, err := c.configFiles(conf)
 	if err != nil {
 		return err
 	}
+	for _, configFile := range configFiles {
+		if err := configFile.recordGeneration(conf, gen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
+// configFiles is a config file executor for each file in the directory
+func (c *ConfigDir) configFiles(conf UserConfig) ([]ConfigFile, error) {
+	files, err := c.getFiles(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	configFiles := []ConfigFile{}
 	for _, file := range files {
 		configFile := ConfigFile{
 			TemplateName: file,
@@ -34,12 +69,9 @@ func (c *ConfigDir) Execute(conf UserConfig, opts SyncOpts, godotConf GodotConfi
 		}
 		// Quiet the logging down so we dont get wierd spam from using a nested executor
 		configFile.SetLogger(LoggerWithLevel(zerolog.WarnLevel))
-		if err := configFile.Execute(conf, opts, godotConf); err != nil {
-			return fmt.Errorf("error handling %v: %w", file, err)
-		}
+		configFiles = append(configFiles, configFile)
 	}
-
-	return nil
+	return configFiles, nil
 }
 
 func (c *ConfigDir) getFiles(conf UserConfig) ([]string, error) {
@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
 
@@ -66,7 +67,8 @@ func TestExecute(t *testing.T) {
 			Destination: "~/.config/some-config",
 		}
 
-		require.NoError(t, confDir.Execute(userConf, SyncOpts{}, GodotConfig{}))
+		_, err := confDir.Execute(context.Background(), userConf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 		requireContents(t, filepath.Join(root, "home", ".config", "some-config", "top-file"), "Hello World")
 		requireContents(t, filepath.Join(root, "home", ".config", "some-config", "some-sub-dir", "some-file"), "Hello {{ .Target }}")
 	})
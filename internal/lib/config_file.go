@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -33,6 +34,8 @@ type TemplateVars struct {
 }
 
 var _ Executor = (*ConfigFile)(nil)
+var _ bundleExporter = (*ConfigFile)(nil)
+var _ generationRecorder = (*ConfigFile)(nil)
 
 type ConfigFile struct {
 	Name         string         `yaml:"-"`
@@ -71,46 +74,47 @@ func (c *ConfigFile) Validate() error {
 	return errs.ErrorOrNil()
 }
 
-func (c *ConfigFile) Execute(conf UserConfig, opts SyncOpts, godotConf GodotConfig) error {
+func (c *ConfigFile) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
 	c.createVaultClosure(conf, opts)
 	if err := c.createIsInstalledClosure(conf, godotConf); err != nil {
-		return fmt.Errorf("error creating IsInstalled closure: %w", err)
+		return false, fmt.Errorf("error creating IsInstalled closure: %w", err)
 	}
 
 	c.log.Info().Str("name", c.TemplateName).Msg("executing config file")
 	buildPath := path.Join(conf.BuildLocation, c.TemplateName)
 	if err := ensureContainingDir(buildPath); err != nil {
-		return err
+		return false, err
+	}
+	if err := opts.journal.record(buildPath); err != nil {
+		return false, err
 	}
-	f, err := os.OpenFile(buildPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0744)
+	// A missing build is treated as empty, which never matches a rendered hash
+	previous, _ := fileSha256(buildPath)
+	// Render to the side so a failed render leaves the previous build untouched
+	err := writeAtomic(buildPath, 0744, func(w io.Writer) error {
+		return c.render(w, conf)
+	})
 	if err != nil {
-		return fmt.Errorf("error opening destination file %v: %v", buildPath, err)
+		return false, err
 	}
-	defer f.Close()
-
-	if err := c.render(f, conf); err != nil {
-		return err
+	rendered, err := fileSha256(buildPath)
+	if err != nil {
+		return false, err
 	}
 
 	dest := replaceTilde(c.Destination, conf.HomeDir)
-	exists, err := c.pathExists(dest)
-	if err != nil {
-		return err
+	target, _ := os.Readlink(dest)
+	if err := opts.journal.record(dest); err != nil {
+		return false, err
 	}
-	if exists {
-		if err := c.removePath(dest); err != nil {
-			return fmt.Errorf("error removing path: %w", err)
-		}
-	}
-
 	if err := c.symlink(buildPath, dest); err != nil {
-		return fmt.Errorf("error symlinking: %w", err)
+		return false, fmt.Errorf("error symlinking: %w", err)
 	}
 
-	return nil
+	return previous != rendered || target != buildPath, nil
 }
 
-func (c *ConfigFile) render(f *os.File, conf UserConfig) error {
+func (c *ConfigFile) render(f io.Writer, conf UserConfig) error {
 	if c.NoTemplate {
 		src, err := os.Open(c.templatePath(conf.CloneLocation))
 		if err != nil {
@@ -142,6 +146,28 @@ func (c *ConfigFile) render(f *os.File, conf UserConfig) error {
 	}
 }
 
+// exportToBundle renders the template when vault values are being captured, so that every value it
+// looks up ends up in the bundle
+func (c *ConfigFile) exportToBundle(_ context.Context, conf UserConfig, godotConf GodotConfig, w *bundleWriter) error {
+	if c.NoTemplate || w.Manifest.Vault == nil {
+		return nil
+	}
+
+	c.createVaultClosure(conf, SyncOpts{})
+	if err := c.createIsInstalledClosure(conf, godotConf); err != nil {
+		return fmt.Errorf("error creating IsInstalled closure: %w", err)
+	}
+	return c.render(io.Discard, conf)
+}
+
+// recordGeneration snapshots the rendered file, along with the symlink pointing at it
+func (c *ConfigFile) recordGeneration(conf UserConfig, gen *Generation) error {
+	if err := gen.addFile(path.Join(conf.BuildLocation, c.TemplateName)); err != nil {
+		return err
+	}
+	return gen.addLink(replaceTilde(c.Destination, conf.HomeDir))
+}
+
 func (c *ConfigFile) createVaultClosure(conf UserConfig, opts SyncOpts) {
 	if _, ok := funcs[funcNameVaultLookup]; ok {
 		return
@@ -203,31 +229,12 @@ func (c *ConfigFile) templatePath(dotfiles string) string {
 	return path.Join(dotfiles, "templates", c.TemplateName)
 }
 
-func (c *ConfigFile) pathExists(path string) (bool, error) {
-	if _, err := os.Stat(path); err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		} else {
-			return false, fmt.Errorf("error checking existance of %v: %v", path, err)
-		}
-	}
-	return true, nil
-}
-
-func (c *ConfigFile) removePath(path string) error {
-	if err := os.Remove(path); err != nil {
-		return fmt.Errorf("error deleting path %v: %v", path, err)
-	}
-	return nil
-}
-
 func (c *ConfigFile) symlink(source string, dest string) error {
 	if err := ensureContainingDir(dest); err != nil {
 		return err
 	}
 
-	err := os.Symlink(source, dest)
-	if err != nil {
+	if err := createSymlink(source, dest); err != nil {
 		return fmt.Errorf("error creating symlink: %v", err)
 	}
 	return nil
@@ -1,7 +1,9 @@
 package lib
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
 	"testing"
@@ -40,9 +42,37 @@ func TestConfigFileExecute(t *testing.T) {
 			TemplateName: "dot_conf",
 			Destination:  "~/.config/conf",
 		}
-		require.NoError(t, f.Execute(conf, SyncOpts{}, GodotConfig{}))
+		changed, err := f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
 
 		requireContents(t, path.Join(conf.HomeDir, ".config", "conf"), fmt.Sprintf("Hello from %v", targetName))
+
+		changed, err = f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+
+		require.NoError(t, os.WriteFile(f.templatePath(conf.CloneLocation), []byte("Hi from {{ .Target }}"), 0644))
+		changed, err = f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+	})
+
+	t.Run("failed render keeps the previous build", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "dot_conf", "Hello from {{ .Target }}")
+
+		f := ConfigFile{
+			TemplateName: "dot_conf",
+			Destination:  "~/.config/conf",
+		}
+		_, err := f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+
+		require.NoError(t, os.WriteFile(f.templatePath(conf.CloneLocation), []byte("{{ .Target }} {{ .Missing }}"), 0644))
+		_, err = f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.Error(t, err)
+		requireContents(t, path.Join(conf.HomeDir, ".config", "conf"), fmt.Sprintf("Hello from %v", targetName))
 	})
 
 	t.Run("without templates", func(t *testing.T) {
@@ -54,7 +84,8 @@ func TestConfigFileExecute(t *testing.T) {
 			Destination:  "~/.config/conf",
 			NoTemplate: true,
 		}
-		require.NoError(t, f.Execute(conf, SyncOpts{}, GodotConfig{}))
+		_, err := f.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 
 		requireContents(t, path.Join(conf.HomeDir, ".config", "conf"), "Hello from {{ .Target }}")
 	})
@@ -79,7 +110,8 @@ func TestIsInstalled(t *testing.T) {
 	t.Run("installed", func(t *testing.T) {
 		defer cleanFuncsMap(t)
 
-		require.NoError(t, f.Execute(
+		_, err := f.Execute(
+			context.Background(),
 			conf,
 			SyncOpts{},
 			GodotConfig{
@@ -105,14 +137,16 @@ func TestIsInstalled(t *testing.T) {
 					targetName: []string{"blarg"},
 				},
 			},
-		))
+		)
+		require.NoError(t, err)
 		requireContents(t, outPath, "blarg installed\n")
 	})
 
 	t.Run("not_installed", func(t *testing.T) {
 		defer cleanFuncsMap(t)
 
-		require.NoError(t, f.Execute(
+		_, err := f.Execute(
+			context.Background(),
 			conf,
 			SyncOpts{},
 			GodotConfig{
@@ -138,14 +172,16 @@ func TestIsInstalled(t *testing.T) {
 					targetName: []string{"blarg2"},
 				},
 			},
-		))
+		)
+		require.NoError(t, err)
 		requireContents(t, outPath, "blarg not installed\n")
 	})
 
 	t.Run("installed_via_bundle", func(t *testing.T) {
 		defer cleanFuncsMap(t)
 
-		require.NoError(t, f.Execute(
+		_, err := f.Execute(
+			context.Background(),
 			conf,
 			SyncOpts{},
 			GodotConfig{
@@ -170,7 +206,8 @@ func TestIsInstalled(t *testing.T) {
 					targetName: []string{"blarg-bundle"},
 				},
 			},
-		))
+		)
+		require.NoError(t, err)
 		requireContents(t, outPath, "blarg installed\n")
 	})
 
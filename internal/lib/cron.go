@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+var _ Executor = (*Cron)(nil)
+var _ bundleExporter = (*Cron)(nil)
+
+const (
+	cronBlockBegin = "# BEGIN GODOT MANAGED BLOCK: "
+	cronBlockEnd   = "# END GODOT MANAGED BLOCK: "
+)
+
+type Cron struct {
+	Name         string         `yaml:"-"`
+	TemplateName string         `yaml:"template-name" mapstructure:"template-name"`
+	NoTemplate   bool           `yaml:"no-template" mapstructure:"no-template"`
+	Schedule     string         `yaml:"schedule" mapstructure:"schedule"`
+	Command      string         `yaml:"command" mapstructure:"command"`
+	log          zerolog.Logger `yaml:"-"`
+}
+
+func (c *Cron) SetLogger(log zerolog.Logger) {
+	c.log = log
+}
+
+func (c *Cron) Type() ExecutorType {
+	return ExecutorTypeCron
+}
+
+func (c *Cron) GetName() string {
+	return c.Name
+}
+
+func (c *Cron) SetName(n string) {
+	c.Name = n
+}
+
+func (c *Cron) Validate() error {
+	var errs *multierror.Error
+
+	inline := c.Schedule != "" || c.Command != ""
+	if c.TemplateName == "" && !inline {
+		errs = multierror.Append(errs, fmt.Errorf("one of template-name or schedule/command is required"))
+	}
+	if c.TemplateName != "" && inline {
+		errs = multierror.Append(errs, fmt.Errorf("template-name and schedule/command are mutually exclusive"))
+	}
+	if inline && (c.Schedule == "" || c.Command == "") {
+		errs = multierror.Append(errs, fmt.Errorf("schedule and command must be given together"))
+	}
+	if c.Schedule != "" && !strings.HasPrefix(c.Schedule, "@") && len(strings.Fields(c.Schedule)) != 5 {
+		errs = multierror.Append(errs, fmt.Errorf("schedule must have 5 fields, or be a shorthand like @daily"))
+	}
+	if strings.Contains(c.Command, "\n") {
+		errs = multierror.Append(errs, fmt.Errorf("command must be a single line"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *Cron) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return false, fmt.Errorf("cron is not available on windows")
+	}
+
+	c.log.Info().Msg("ensuring crontab entries")
+	entries, err := c.entries(conf, opts, godotConf)
+	if err != nil {
+		return false, err
+	}
+
+	current, err := c.readCrontab(ctx, conf)
+	if err != nil {
+		return false, err
+	}
+	updated := replaceCronBlock(current, c.Name, entries)
+	if updated == current {
+		c.log.Debug().Msg("crontab up to date")
+		return false, nil
+	}
+
+	if err := c.writeCrontab(ctx, conf, updated); err != nil {
+		return false, err
+	}
+	opts.journal.onRollback(func() error {
+		return c.writeCrontab(context.Background(), conf, current)
+	})
+
+	return true, nil
+}
+
+// entries are the lines of the managed block, either rendered from the template or built from the
+// inline schedule
+func (c *Cron) entries(conf UserConfig, opts SyncOpts, godotConf GodotConfig) (string, error) {
+	if c.TemplateName == "" {
+		return c.Schedule + " " + c.Command + "\n", nil
+	}
+
+	f := c.configFile()
+	f.createVaultClosure(conf, opts)
+	if err := f.createIsInstalledClosure(conf, godotConf); err != nil {
+		return "", fmt.Errorf("error creating IsInstalled closure: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := f.render(&buf, conf); err != nil {
+		return "", err
+	}
+	entries := buf.String()
+	if entries != "" && !strings.HasSuffix(entries, "\n") {
+		entries += "\n"
+	}
+	return entries, nil
+}
+
+func (c *Cron) configFile() *ConfigFile {
+	f := &ConfigFile{
+		Name:         c.Name,
+		TemplateName: c.TemplateName,
+		NoTemplate:   c.NoTemplate,
+	}
+	f.SetLogger(c.log)
+	return f
+}
+
+func (c *Cron) readCrontab(ctx context.Context, conf UserConfig) (string, error) {
+	stdout, stderr, err := conf.commandRunner().Run(ctx, "crontab", "-l")
+	if err != nil {
+		// A user without a crontab is the same as an empty one
+		if strings.Contains(stderr, "no crontab") {
+			return "", nil
+		}
+		return "", fmt.Errorf("error reading crontab: %v\n%v", err, stderr)
+	}
+	return stdout, nil
+}
+
+func (c *Cron) writeCrontab(ctx context.Context, conf UserConfig, contents string) error {
+	tmp, err := os.CreateTemp("", "godot-crontab-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+
+	if _, stderr, err := conf.commandRunner().Run(ctx, "crontab", tmp.Name()); err != nil {
+		return fmt.Errorf("error installing crontab: %v\n%v", err, stderr)
+	}
+	return nil
+}
+
+func (c *Cron) exportToBundle(ctx context.Context, conf UserConfig, godotConf GodotConfig, w *bundleWriter) error {
+	if c.TemplateName == "" {
+		return nil
+	}
+	return c.configFile().exportToBundle(ctx, conf, godotConf, w)
+}
+
+// replaceCronBlock swaps the managed block for name in crontab with entries, appending it if it isn't
+// present yet. Everything outside the block is left exactly as it was
+func replaceCronBlock(crontab string, name string, entries string) string {
+	begin := cronBlockBegin + name
+	end := cronBlockEnd + name
+	block := begin + "\n" + entries + end + "\n"
+
+	lines := strings.SplitAfter(crontab, "\n")
+	start, stop := -1, -1
+	for i, line := range lines {
+		switch strings.TrimRight(line, "\n") {
+		case begin:
+			start = i
+		case end:
+			if start != -1 {
+				stop = i
+			}
+		}
+	}
+
+	if start == -1 || stop == -1 {
+		if crontab != "" && !strings.HasSuffix(crontab, "\n") {
+			crontab += "\n"
+		}
+		return crontab + block
+	}
+
+	return strings.Join(lines[:start], "") + block + strings.Join(lines[stop+1:], "")
+}
@@ -0,0 +1,106 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCrontab serves crontab -l from contents, and replaces them when a file is installed
+func fakeCrontab(t *testing.T, contents *string) *fakeRunner {
+	return &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+		"crontab -l": func([]string) (string, string, error) {
+			if *contents == "" {
+				return "", "no crontab for user", fmt.Errorf("exit status 1")
+			}
+			return *contents, "", nil
+		},
+		"crontab /": func(args []string) (string, string, error) {
+			b, err := os.ReadFile(args[0])
+			require.NoError(t, err)
+			*contents = string(b)
+			return "", "", nil
+		},
+	}}
+}
+
+func TestCron(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("cron is not available on windows")
+	}
+
+	t.Run("inline entry", func(t *testing.T) {
+		crontab := "MAILTO=me\n0 * * * * existing\n"
+		conf := UserConfig{runner: fakeCrontab(t, &crontab)}
+
+		c := &Cron{Name: "backup", Schedule: "@daily", Command: "backup.sh"}
+		c.SetLogger(zerolog.Nop())
+		changed, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, "MAILTO=me\n0 * * * * existing\n# BEGIN GODOT MANAGED BLOCK: backup\n@daily backup.sh\n# END GODOT MANAGED BLOCK: backup\n", crontab)
+
+		changed, err = c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+
+		c.Schedule = "@hourly"
+		changed, err = c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, "MAILTO=me\n0 * * * * existing\n# BEGIN GODOT MANAGED BLOCK: backup\n@hourly backup.sh\n# END GODOT MANAGED BLOCK: backup\n", crontab)
+	})
+
+	t.Run("from a template, with no existing crontab", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "crontab", "*/5 * * * * {{ .Home }}/bin/poll\n@reboot {{ .Home }}/bin/start")
+		crontab := ""
+		conf.runner = fakeCrontab(t, &crontab)
+
+		c := &Cron{Name: "poll", TemplateName: "crontab"}
+		c.SetLogger(zerolog.Nop())
+		changed, err := c.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, fmt.Sprintf("# BEGIN GODOT MANAGED BLOCK: poll\n*/5 * * * * %[1]v/bin/poll\n@reboot %[1]v/bin/start\n# END GODOT MANAGED BLOCK: poll\n", conf.HomeDir), crontab)
+	})
+
+	t.Run("rollback restores the previous crontab", func(t *testing.T) {
+		crontab := "0 * * * * existing\n"
+		conf := UserConfig{runner: fakeCrontab(t, &crontab)}
+		j, err := newJournal(zerolog.Nop())
+		require.NoError(t, err)
+		defer j.close()
+
+		c := &Cron{Name: "backup", Schedule: "@daily", Command: "backup.sh"}
+		c.SetLogger(zerolog.Nop())
+		_, err = c.Execute(context.Background(), conf, SyncOpts{journal: j}, GodotConfig{})
+		require.NoError(t, err)
+		require.NotEqual(t, "0 * * * * existing\n", crontab)
+
+		require.NoError(t, j.rollback())
+		require.Equal(t, "0 * * * * existing\n", crontab)
+	})
+}
+
+func TestReplaceCronBlock(t *testing.T) {
+	existing := "a\n# BEGIN GODOT MANAGED BLOCK: x\nold\n# END GODOT MANAGED BLOCK: x\nb\n"
+	require.Equal(t, "a\n# BEGIN GODOT MANAGED BLOCK: x\nnew\n# END GODOT MANAGED BLOCK: x\nb\n", replaceCronBlock(existing, "x", "new\n"))
+	require.Equal(t, existing+"# BEGIN GODOT MANAGED BLOCK: y\nnew\n# END GODOT MANAGED BLOCK: y\n", replaceCronBlock(existing, "y", "new\n"))
+	require.Equal(t, "a\n# BEGIN GODOT MANAGED BLOCK: y\nnew\n# END GODOT MANAGED BLOCK: y\n", replaceCronBlock("a", "y", "new\n"))
+}
+
+func TestCronValidate(t *testing.T) {
+	require.NoError(t, (&Cron{Schedule: "0 * * * *", Command: "x"}).Validate())
+	require.NoError(t, (&Cron{Schedule: "@daily", Command: "x"}).Validate())
+	require.NoError(t, (&Cron{TemplateName: "crontab"}).Validate())
+	require.Error(t, (&Cron{}).Validate())
+	require.Error(t, (&Cron{Schedule: "0 * *", Command: "x"}).Validate())
+	require.Error(t, (&Cron{Schedule: "@daily"}).Validate())
+	require.Error(t, (&Cron{TemplateName: "crontab", Command: "x"}).Validate())
+}
@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"context"
+
 	"github.com/rs/zerolog"
 )
 
@@ -18,12 +20,22 @@ golang
 go-install
 config-dir
 neovim
+gitlab-release
+gitea-release
+package-repo
+cargo-install
+pipx-install
+npm-global
+command
+systemd-user-unit
+cron
 )
 */
 type ExecutorType string
 
 type Executor interface {
-	Execute(UserConfig, SyncOpts, GodotConfig) error
+	// Execute reports whether it changed anything, which decides if on-change hooks are run
+	Execute(context.Context, UserConfig, SyncOpts, GodotConfig) (bool, error)
 	Type() ExecutorType
 	Validate() error
 	SetLogger(zerolog.Logger)
@@ -52,19 +64,29 @@ func deduplicate(executors []Executor) []Executor {
 
 func applyOrdering(executors []Executor) []Executor {
 	// We cant do a go install until we've installed go, so if we didn't sort these properly then
-	// the first configuration run would fail
+	// the first configuration run would fail. The same goes for cargo, pipx & npm, which are usually
+	// installed by system packages. Similarly, package repos need to be set up before anything is
+	// installed from them. Commands, services and cron jobs usually run something that was just
+	// installed, so they go once everything is in place
+	repos := []Executor{}
 	installs := []Executor{}
+	commands := []Executor{}
 	sortedExecutors := []Executor{}
 
 	for _, e := range executors {
-		if e.Type() == ExecutorTypeGoInstall {
+		switch e.Type() {
+		case ExecutorTypePackageRepo:
+			repos = append(repos, e)
+		case ExecutorTypeGoInstall, ExecutorTypeCargoInstall, ExecutorTypePipxInstall, ExecutorTypeNpmGlobal:
 			installs = append(installs, e)
-		} else {
+		case ExecutorTypeCommand, ExecutorTypeSystemdUserUnit, ExecutorTypeCron:
+			commands = append(commands, e)
+		default:
 			sortedExecutors = append(sortedExecutors, e)
 		}
 	}
 
-	sortedExecutors = append(sortedExecutors, installs...)
+	sortedExecutors = append(append(append(repos, sortedExecutors...), installs...), commands...)
 	
 	return sortedExecutors
 }
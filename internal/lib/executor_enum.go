@@ -32,6 +32,24 @@ const (
 	ExecutorTypeConfigDir ExecutorType = "config-dir"
 	// ExecutorTypeNeovim is a ExecutorType of type neovim.
 	ExecutorTypeNeovim ExecutorType = "neovim"
+	// ExecutorTypeGitlabRelease is a ExecutorType of type gitlab-release.
+	ExecutorTypeGitlabRelease ExecutorType = "gitlab-release"
+	// ExecutorTypeGiteaRelease is a ExecutorType of type gitea-release.
+	ExecutorTypeGiteaRelease ExecutorType = "gitea-release"
+	// ExecutorTypePackageRepo is a ExecutorType of type package-repo.
+	ExecutorTypePackageRepo ExecutorType = "package-repo"
+	// ExecutorTypeCargoInstall is a ExecutorType of type cargo-install.
+	ExecutorTypeCargoInstall ExecutorType = "cargo-install"
+	// ExecutorTypePipxInstall is a ExecutorType of type pipx-install.
+	ExecutorTypePipxInstall ExecutorType = "pipx-install"
+	// ExecutorTypeNpmGlobal is a ExecutorType of type npm-global.
+	ExecutorTypeNpmGlobal ExecutorType = "npm-global"
+	// ExecutorTypeCommand is a ExecutorType of type command.
+	ExecutorTypeCommand ExecutorType = "command"
+	// ExecutorTypeSystemdUserUnit is a ExecutorType of type systemd-user-unit.
+	ExecutorTypeSystemdUserUnit ExecutorType = "systemd-user-unit"
+	// ExecutorTypeCron is a ExecutorType of type cron.
+	ExecutorTypeCron ExecutorType = "cron"
 )
 
 var ErrInvalidExecutorType = fmt.Errorf("not a valid ExecutorType, try [%s]", strings.Join(_ExecutorTypeNames, ", "))
@@ -47,6 +65,15 @@ var _ExecutorTypeNames = []string{
 	string(ExecutorTypeGoInstall),
 	string(ExecutorTypeConfigDir),
 	string(ExecutorTypeNeovim),
+	string(ExecutorTypeGitlabRelease),
+	string(ExecutorTypeGiteaRelease),
+	string(ExecutorTypePackageRepo),
+	string(ExecutorTypeCargoInstall),
+	string(ExecutorTypePipxInstall),
+	string(ExecutorTypeNpmGlobal),
+	string(ExecutorTypeCommand),
+	string(ExecutorTypeSystemdUserUnit),
+	string(ExecutorTypeCron),
 }
 
 // ExecutorTypeNames returns a list of possible string values of ExecutorType.
@@ -69,16 +96,25 @@ func (x ExecutorType) IsValid() bool {
 }
 
 var _ExecutorTypeValue = map[string]ExecutorType{
-	"config-file":    ExecutorTypeConfigFile,
-	"github-release": ExecutorTypeGithubRelease,
-	"git-repo":       ExecutorTypeGitRepo,
-	"sys-package":    ExecutorTypeSysPackage,
-	"url-download":   ExecutorTypeUrlDownload,
-	"bundle":         ExecutorTypeBundle,
-	"golang":         ExecutorTypeGolang,
-	"go-install":     ExecutorTypeGoInstall,
-	"config-dir":     ExecutorTypeConfigDir,
-	"neovim":         ExecutorTypeNeovim,
+	"config-file":       ExecutorTypeConfigFile,
+	"github-release":    ExecutorTypeGithubRelease,
+	"git-repo":          ExecutorTypeGitRepo,
+	"sys-package":       ExecutorTypeSysPackage,
+	"url-download":      ExecutorTypeUrlDownload,
+	"bundle":            ExecutorTypeBundle,
+	"golang":            ExecutorTypeGolang,
+	"go-install":        ExecutorTypeGoInstall,
+	"config-dir":        ExecutorTypeConfigDir,
+	"neovim":            ExecutorTypeNeovim,
+	"gitlab-release":    ExecutorTypeGitlabRelease,
+	"gitea-release":     ExecutorTypeGiteaRelease,
+	"package-repo":      ExecutorTypePackageRepo,
+	"cargo-install":     ExecutorTypeCargoInstall,
+	"pipx-install":      ExecutorTypePipxInstall,
+	"npm-global":        ExecutorTypeNpmGlobal,
+	"command":           ExecutorTypeCommand,
+	"systemd-user-unit": ExecutorTypeSystemdUserUnit,
+	"cron":              ExecutorTypeCron,
 }
 
 // ParseExecutorType attempts to convert a string to a ExecutorType.
@@ -8,6 +8,9 @@ import (
 
 func TestApplyOrdering(t *testing.T) {
 	inp := []Executor{
+		&Cron{
+			Name: "cron",
+		},
 		&ConfigFile{
 			Name: "cf1",
 		},
@@ -17,11 +20,17 @@ func TestApplyOrdering(t *testing.T) {
 		&Golang{
 			Name: "golang",
 		},
+		&NpmGlobal{
+			Name: "npm-1",
+		},
+		&SystemPackage{
+			Name: "nodejs",
+		},
 	}
 	got := applyOrdering(inp)
 	require.Equal(
 		t,
-		[]string{"cf1", "golang", "go-inst-1"},
+		[]string{"cf1", "golang", "nodejs", "go-inst-1", "npm-1", "cron"},
 		lo.Map(got, func(e Executor, _ int) string {
 			return e.GetName()
 		}),
@@ -0,0 +1,252 @@
+package lib
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+type GcOpts struct {
+	// Keep is the number of most recent generations whose installs are kept, in addition to whatever
+	// the current symlinks point at. The current generation is always kept
+	Keep   int
+	DryRun bool
+	Logger zerolog.Logger
+}
+
+// GcEntry is something removed (or that would be removed) by garbage collection
+type GcEntry struct {
+	Path string
+	Size int64
+}
+
+// versionSuffix is what follows `<name>-` in a versioned install
+var versionSuffix = regexp.MustCompile(`^v?[0-9]`)
+
+type GcResult struct {
+	Removed []GcEntry
+	// Unmanaged are unused entries that look like versioned installs of something godot manages, but no
+	// generation recorded installing, i.e they were installed before generations existed. They're not
+	// removed
+	Unmanaged   []GcEntry
+	Generations []int
+}
+
+// Reclaimed is the total size of everything removed
+func (r GcResult) Reclaimed() int64 {
+	return lo.SumBy(r.Removed, func(e GcEntry) int64 { return e.Size })
+}
+
+func Gc(opts GcOpts) (GcResult, error) {
+	conf, err := generationsFromUserConfig()
+	if err != nil {
+		return GcResult{}, err
+	}
+	return gc(conf, opts)
+}
+
+func gc(conf UserConfig, opts GcOpts) (GcResult, error) {
+	if opts.Keep < 0 {
+		return GcResult{}, fmt.Errorf("keep cannot be negative")
+	}
+
+	store := newGenerationStore(conf)
+	kept, pruned, err := store.partition(opts.Keep)
+	if err != nil {
+		return GcResult{}, err
+	}
+
+	// Everything currently linked, or linked by a kept generation, is in use. Only what a generation
+	// recorded installing is godot's to remove, generations being pruned included, so their leftovers
+	// are still recognized
+	current, err := binaryDirLinks(conf.BinaryDir)
+	if err != nil {
+		return GcResult{}, err
+	}
+	links := []lo.Tuple2[string, string]{}
+	for link, target := range current {
+		links = append(links, lo.T2(link, target))
+	}
+	installed := map[string]bool{}
+	managed := map[string]bool{}
+	for _, number := range append(append([]int{}, kept...), pruned...) {
+		g, err := store.load(number)
+		if err != nil {
+			return GcResult{}, err
+		}
+		for name, tag := range g.Versions {
+			managed[name] = true
+			if norm, err := normalizeTag(tag); err == nil {
+				installed[name+"-"+norm] = true
+			}
+		}
+		for link, target := range g.Links {
+			if entry, ok := binaryDirEntry(conf.BinaryDir, link, target); ok {
+				installed[entry] = true
+			}
+			if filepath.Dir(link) == filepath.Clean(conf.BinaryDir) {
+				managed[filepath.Base(link)] = true
+			}
+		}
+		if !lo.Contains(kept, number) {
+			continue
+		}
+		for link, target := range g.Links {
+			if filepath.Dir(link) == filepath.Clean(conf.BinaryDir) {
+				links = append(links, lo.T2(link, target))
+			}
+		}
+	}
+
+	inUse := map[string]bool{}
+	for _, link := range links {
+		if entry, ok := binaryDirEntry(conf.BinaryDir, link.A, link.B); ok {
+			inUse[entry] = true
+		}
+	}
+
+	entries, err := os.ReadDir(conf.BinaryDir)
+	if err != nil && !os.IsNotExist(err) {
+		return GcResult{}, fmt.Errorf("error reading %v: %w", conf.BinaryDir, err)
+	}
+
+	unmanaged := func(name string) bool {
+		for prefix := range managed {
+			if rest, ok := strings.CutPrefix(name, prefix+"-"); ok && versionSuffix.MatchString(rest) {
+				return true
+			}
+		}
+		return false
+	}
+
+	result := GcResult{Removed: []GcEntry{}, Unmanaged: []GcEntry{}, Generations: pruned}
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink != 0 || inUse[entry.Name()] {
+			continue
+		}
+		if !installed[entry.Name()] && !unmanaged(entry.Name()) {
+			continue
+		}
+
+		p := filepath.Join(conf.BinaryDir, entry.Name())
+		size, err := diskUsage(p)
+		if err != nil {
+			return GcResult{}, err
+		}
+		if installed[entry.Name()] {
+			result.Removed = append(result.Removed, GcEntry{Path: p, Size: size})
+		} else {
+			result.Unmanaged = append(result.Unmanaged, GcEntry{Path: p, Size: size})
+		}
+	}
+
+	for _, entry := range result.Unmanaged {
+		opts.Logger.Info().Str("path", entry.Path).Str("size", FormatBytes(entry.Size)).Msg("unmanaged, not removed")
+	}
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	for _, entry := range result.Removed {
+		opts.Logger.Info().Str("path", entry.Path).Str("size", FormatBytes(entry.Size)).Msg("removing")
+		if err := os.RemoveAll(entry.Path); err != nil {
+			return result, fmt.Errorf("error removing %v: %w", entry.Path, err)
+		}
+	}
+	for _, number := range pruned {
+		opts.Logger.Info().Int("generation", number).Msg("removing generation")
+		if err := os.RemoveAll(store.dir(number)); err != nil {
+			return result, fmt.Errorf("error removing generation %v: %w", number, err)
+		}
+	}
+
+	return result, nil
+}
+
+// partition splits the stored generations into the newest keep (plus the current one), and the rest
+func (s generationStore) partition(keep int) ([]int, []int, error) {
+	numbers, err := s.numbers()
+	if err != nil {
+		return nil, nil, err
+	}
+	current, err := s.current()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := []int{}
+	pruned := []int{}
+	for i, n := range numbers {
+		if n == current || i >= len(numbers)-keep {
+			kept = append(kept, n)
+		} else {
+			pruned = append(pruned, n)
+		}
+	}
+	return kept, pruned, nil
+}
+
+// binaryDirLinks is every symlink in dir, and where it points
+func binaryDirLinks(dir string) (map[string]string, error) {
+	links := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return links, nil
+		}
+		return nil, fmt.Errorf("error reading %v: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.Type()&fs.ModeSymlink == 0 {
+			continue
+		}
+		link := filepath.Join(dir, entry.Name())
+		target, err := os.Readlink(link)
+		if err != nil {
+			return nil, fmt.Errorf("error reading symlink %v: %w", link, err)
+		}
+		links[link] = target
+	}
+	return links, nil
+}
+
+// binaryDirEntry is the name of the top level entry of dir that target (as linked from link) lives
+// in, i.e neovim-v0.10.0 for a link to neovim-v0.10.0/bin/nvim
+func binaryDirEntry(dir string, link string, target string) (string, bool) {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(link), target)
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(target))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return strings.Split(rel, string(filepath.Separator))[0], true
+}
+
+func diskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error measuring %v: %w", path, err)
+	}
+	return size, nil
+}
@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGc(t *testing.T) {
+	setup := func(t *testing.T) UserConfig {
+		t.Helper()
+
+		home := buildDirectoryStructure(t, map[string]string{
+			"bin/tool-v1.0.0":             "old tool",
+			"bin/tool-v2.0.0":             "new tool",
+			"bin/tool-nightly":            "nightly tool",
+			"bin/neovim-v0.9.0/bin/nvim":  "old nvim",
+			"bin/neovim-v0.10.0/bin/nvim": "new nvim",
+			"bin/kubectl-v1.30.0":         "kubectl",
+			"bin/kubectl-myplugin":        "not ours",
+			"bin/kubectl-v1.29.0":         "installed by hand",
+			"bin/neovim-v0.8.0/bin/nvim":  "before generations",
+			"bin/foo-1.2":                 "not ours, but looks versioned",
+			"bin/notes.txt":               "not ours either",
+			"rendered/":                   "",
+		})
+		conf := UserConfig{
+			HomeDir:       home,
+			BinaryDir:     filepath.Join(home, "bin"),
+			BuildLocation: filepath.Join(home, "rendered"),
+		}
+		link := func(target string, name string) {
+			require.NoError(t, createSymlink(filepath.Join(conf.BinaryDir, target), filepath.Join(conf.BinaryDir, name)))
+		}
+
+		store := newGenerationStore(conf)
+		old := newGeneration("lab")
+		old.Versions = map[string]string{"tool": "nightly", "neovim": "v0.9.0"}
+		old.Links = map[string]string{filepath.Join(conf.BinaryDir, "tool"): filepath.Join(conf.BinaryDir, "tool-nightly")}
+		_, err := store.save(old)
+		require.NoError(t, err)
+
+		previous := newGeneration("lab")
+		previous.Versions = map[string]string{"tool": "v1.0.0"}
+		previous.Links = map[string]string{filepath.Join(conf.BinaryDir, "tool"): filepath.Join(conf.BinaryDir, "tool-v1.0.0")}
+		_, err = store.save(previous)
+		require.NoError(t, err)
+
+		link("tool-v2.0.0", "tool")
+		link("neovim-v0.10.0", "neovim")
+		link("neovim-v0.10.0/bin/nvim", "nvim")
+		link("kubectl-v1.30.0", "kubectl")
+		// A symlink of the user's own, which shouldn't make foo-1.2 look like one of godot's installs
+		require.NoError(t, createSymlink(conf.HomeDir, filepath.Join(conf.BinaryDir, "foo")))
+		nvim := &Neovim{Name: "neovim", Tag: "v0.10.0"}
+		nvim.installed = nvim.release()
+		executors := []Executor{
+			&UrlDownload{Name: "tool", Tag: "v2.0.0"},
+			&UrlDownload{Name: "kubectl", Tag: "v1.30.0"},
+			nvim,
+		}
+		require.NoError(t, recordGeneration(conf, executors, executors, zerolog.Nop()))
+
+		return conf
+	}
+
+	exists := func(t *testing.T, conf UserConfig, name string) bool {
+		_, err := os.Lstat(filepath.Join(conf.BinaryDir, name))
+		return err == nil
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		conf := setup(t)
+		result, err := gc(conf, GcOpts{DryRun: true})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []GcEntry{
+			{Path: filepath.Join(conf.BinaryDir, "tool-v1.0.0"), Size: 8},
+			{Path: filepath.Join(conf.BinaryDir, "tool-nightly"), Size: 12},
+			{Path: filepath.Join(conf.BinaryDir, "neovim-v0.9.0"), Size: 8},
+		}, result.Removed)
+		require.Equal(t, int64(28), result.Reclaimed())
+		require.ElementsMatch(t, []GcEntry{
+			{Path: filepath.Join(conf.BinaryDir, "kubectl-v1.29.0"), Size: 17},
+			{Path: filepath.Join(conf.BinaryDir, "neovim-v0.8.0"), Size: 18},
+		}, result.Unmanaged)
+		require.Equal(t, []int{1, 2}, result.Generations)
+		require.True(t, exists(t, conf, "tool-v1.0.0"))
+	})
+
+	t.Run("keeps recent generations", func(t *testing.T) {
+		conf := setup(t)
+		result, err := gc(conf, GcOpts{Keep: 2, Logger: zerolog.Nop()})
+		require.NoError(t, err)
+		require.Equal(t, []int{1}, result.Generations)
+
+		require.True(t, exists(t, conf, "tool-v1.0.0"))
+		require.False(t, exists(t, conf, "tool-nightly"))
+		require.False(t, exists(t, conf, "neovim-v0.9.0"))
+
+		numbers, err := newGenerationStore(conf).numbers()
+		require.NoError(t, err)
+		require.Equal(t, []int{2, 3}, numbers)
+	})
+
+	t.Run("only removes versioned installs", func(t *testing.T) {
+		conf := setup(t)
+		_, err := gc(conf, GcOpts{Logger: zerolog.Nop()})
+		require.NoError(t, err)
+
+		for _, name := range []string{"tool", "tool-v2.0.0", "neovim-v0.10.0", "nvim", "kubectl-v1.30.0", "kubectl-myplugin", "kubectl-v1.29.0", "neovim-v0.8.0", "foo-1.2", "notes.txt"} {
+			require.True(t, exists(t, conf, name), name)
+		}
+		require.False(t, exists(t, conf, "tool-v1.0.0"))
+		requireContents(t, filepath.Join(conf.BinaryDir, "nvim"), "new nvim")
+	})
+}
@@ -0,0 +1,515 @@
+package lib
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+const (
+	generationsDir        = "generations"
+	generationFilesDir    = "files"
+	generationManifest    = "generation.json"
+	generationCurrentFile = "current"
+)
+
+// Generation is a snapshot of what a successful sync left on the machine, which can later be rolled
+// back to
+type Generation struct {
+	Number  int       `json:"number"`
+	Created time.Time `json:"created"`
+	Target  string    `json:"target"`
+	// Versions maps each installed item to the version that was installed
+	Versions map[string]string `json:"versions"`
+	// Links maps each symlink godot manages to what it pointed at
+	Links map[string]string `json:"links"`
+	// Files maps each rendered config file to the sha256 of its contents, which are stored in the
+	// generation
+	Files map[string]string `json:"files"`
+	// Current is true for the generation the machine is currently on
+	Current bool `json:"-"`
+
+	// snapshots are the files to store alongside the generation, keyed by sha256
+	snapshots map[string]string
+}
+
+// generationRecorder is implemented by executors whose results can be captured in a generation
+type generationRecorder interface {
+	recordGeneration(conf UserConfig, g *Generation) error
+}
+
+func newGeneration(target string) *Generation {
+	return &Generation{
+		Created:   time.Now(),
+		Target:    target,
+		Versions:  map[string]string{},
+		Links:     map[string]string{},
+		Files:     map[string]string{},
+		snapshots: map[string]string{},
+	}
+}
+
+// addLink records where the symlink at link currently points, if it exists
+func (g *Generation) addLink(link string) error {
+	target, err := os.Readlink(link)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error reading symlink %v: %w", link, err)
+	}
+	g.Links[link] = target
+	return nil
+}
+
+// addFile snapshots the contents of path, if it exists
+func (g *Generation) addFile(path string) error {
+	sum, err := fileSha256(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	g.Files[path] = sum
+	g.snapshots[sum] = path
+	return nil
+}
+
+// addInstall records the version and symlinks of something installed by installDownload
+func (g *Generation) addInstall(conf UserConfig, spec installSpec, tag string) error {
+	links := []string{}
+	if len(spec.Binaries) > 0 {
+		installs, err := binaryInstalls(conf, tag, spec.Binaries)
+		if err != nil {
+			return err
+		}
+		for _, install := range installs {
+			links = append(links, install.SymlinkName)
+		}
+	} else {
+		symlink, err := getSymlinkName(conf, spec.Name, tag)
+		if err != nil {
+			return err
+		}
+		links = append(links, symlink)
+	}
+	if spec.InstallMode == InstallModeDirectory {
+		for _, link := range spec.Links {
+			links = append(links, filepath.Join(conf.BinaryDir, path.Base(link)))
+		}
+	}
+
+	for _, link := range links {
+		if err := g.addLink(link); err != nil {
+			return err
+		}
+	}
+	g.Versions[spec.Name] = tag
+	return nil
+}
+
+// sameAs is true if g captures the same state as other
+func (g *Generation) sameAs(other *Generation) bool {
+	return g.Target == other.Target &&
+		reflect.DeepEqual(g.Versions, other.Versions) &&
+		reflect.DeepEqual(g.Links, other.Links) &&
+		reflect.DeepEqual(g.Files, other.Files)
+}
+
+// carryOver seeds g with everything in the current generation, so executors that didn't run this
+// time keep what they last recorded
+func (g *Generation) carryOver(store generationStore) error {
+	current, err := store.current()
+	if err != nil || current == 0 {
+		return err
+	}
+	prev, err := store.load(current)
+	if err != nil {
+		return err
+	}
+	for name, version := range prev.Versions {
+		g.Versions[name] = version
+	}
+	for link, target := range prev.Links {
+		g.Links[link] = target
+	}
+	for file, sum := range prev.Files {
+		g.Files[file] = sum
+		g.snapshots[sum] = snapshotPath(store.dir(current), sum)
+	}
+	return nil
+}
+
+func snapshotPath(dir string, sum string) string {
+	return filepath.Join(dir, generationFilesDir, sum)
+}
+
+type generationStore struct {
+	Dir string
+}
+
+func newGenerationStore(conf UserConfig) generationStore {
+	return generationStore{Dir: filepath.Join(conf.BuildLocation, generationsDir)}
+}
+
+func (s generationStore) dir(number int) string {
+	return filepath.Join(s.Dir, strconv.Itoa(number))
+}
+
+// numbers lists every stored generation, oldest first
+func (s generationStore) numbers() ([]int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []int{}, nil
+		}
+		return nil, fmt.Errorf("error reading generations: %w", err)
+	}
+	numbers := []int{}
+	for _, entry := range entries {
+		n, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers, nil
+}
+
+func (s generationStore) load(number int) (*Generation, error) {
+	b, err := os.ReadFile(filepath.Join(s.dir(number), generationManifest))
+	if err != nil {
+		return nil, fmt.Errorf("error reading generation %v: %w", number, err)
+	}
+	var g Generation
+	if err := json.Unmarshal(b, &g); err != nil {
+		return nil, fmt.Errorf("error parsing generation %v: %w", number, err)
+	}
+	return &g, nil
+}
+
+// current is the generation the machine is on, or 0 if there are none
+func (s generationStore) current() (int, error) {
+	b, err := os.ReadFile(filepath.Join(s.Dir, generationCurrentFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error reading current generation: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid current generation %q", string(b))
+	}
+	return n, nil
+}
+
+func (s generationStore) setCurrent(number int) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating generations directory: %w", err)
+	}
+	return writeAtomic(filepath.Join(s.Dir, generationCurrentFile), 0644, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, number)
+		return err
+	})
+}
+
+// save stores g as the newest generation, and makes it current. Nothing is stored if g is the same as
+// the current generation
+func (s generationStore) save(g *Generation) (bool, error) {
+	current, err := s.current()
+	if err != nil {
+		return false, err
+	}
+	if current != 0 {
+		if prev, err := s.load(current); err == nil && g.sameAs(prev) {
+			return false, nil
+		}
+	}
+
+	numbers, err := s.numbers()
+	if err != nil {
+		return false, err
+	}
+	g.Number = 1
+	if len(numbers) > 0 {
+		g.Number = numbers[len(numbers)-1] + 1
+	}
+
+	// Stage the generation and move it into place, so a partial one is never picked up
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return false, fmt.Errorf("error creating generations directory: %w", err)
+	}
+	staging, err := os.MkdirTemp(s.Dir, ".godot-generation-")
+	if err != nil {
+		return false, fmt.Errorf("error creating generation: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := os.MkdirAll(filepath.Join(staging, generationFilesDir), 0755); err != nil {
+		return false, fmt.Errorf("error creating generation: %w", err)
+	}
+	for sum, src := range g.snapshots {
+		if err := copyFile(src, snapshotPath(staging, sum), 0644); err != nil {
+			return false, fmt.Errorf("error snapshotting %v: %w", src, err)
+		}
+	}
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("error marshalling generation: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, generationManifest), b, 0644); err != nil {
+		return false, fmt.Errorf("error writing generation: %w", err)
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		return false, fmt.Errorf("error setting generation permissions: %w", err)
+	}
+	if err := os.Rename(staging, s.dir(g.Number)); err != nil {
+		return false, fmt.Errorf("error moving generation into place: %w", err)
+	}
+
+	return true, s.setCurrent(g.Number)
+}
+
+// recordGeneration captures the state left behind by the executors that ran as a new generation.
+// When only some of the configured executors ran (i.e --quick or --executors), everything else is
+// carried over from the current generation, as it's been left as it was
+func recordGeneration(conf UserConfig, ran []Executor, configured []Executor, logger zerolog.Logger) error {
+	store := newGenerationStore(conf)
+	g := newGeneration(conf.Target)
+
+	ranNames := lo.Map(ran, func(ex Executor, _ int) string { return ex.GetName() })
+	partial := lo.SomeBy(configured, func(ex Executor) bool {
+		_, ok := ex.(generationRecorder)
+		return ok && !lo.Contains(ranNames, ex.GetName())
+	})
+	if partial {
+		if err := g.carryOver(store); err != nil {
+			return err
+		}
+	}
+
+	for _, ex := range ran {
+		recorder, ok := ex.(generationRecorder)
+		if !ok {
+			continue
+		}
+		if err := recorder.recordGeneration(conf, g); err != nil {
+			return fmt.Errorf("error recording %v: %w", ex.GetName(), err)
+		}
+	}
+
+	saved, err := store.save(g)
+	if err != nil {
+		return err
+	}
+	if saved {
+		logger.Info().Int("generation", g.Number).Msg("recorded generation")
+	}
+	return nil
+}
+
+// rollbackTo switches the machine to generation number, re-pointing symlinks at the versions it
+// had installed and restoring its rendered config files. Anything added since is removed
+func rollbackTo(conf UserConfig, number int, logger zerolog.Logger) (err error) {
+	store := newGenerationStore(conf)
+	currentNumber, err := store.current()
+	if err != nil {
+		return err
+	}
+	if number == 0 {
+		number, err = store.previous(currentNumber)
+		if err != nil {
+			return err
+		}
+	}
+	target, err := store.load(number)
+	if err != nil {
+		return err
+	}
+	current := newGeneration(target.Target)
+	if currentNumber != 0 && currentNumber != number {
+		if current, err = store.load(currentNumber); err != nil {
+			return err
+		}
+	}
+
+	// Make sure everything is still around before touching anything
+	var errs *multierror.Error
+	for link, dest := range target.Links {
+		if !filepath.IsAbs(dest) {
+			dest = filepath.Join(filepath.Dir(link), dest)
+		}
+		if exists, err := pathExists(dest); err != nil || !exists {
+			errs = multierror.Append(errs, fmt.Errorf("%v is no longer installed", dest))
+		}
+	}
+	for file, sum := range target.Files {
+		if exists, err := pathExists(snapshotPath(store.dir(number), sum)); err != nil || !exists {
+			errs = multierror.Append(errs, fmt.Errorf("snapshot of %v is missing", file))
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return fmt.Errorf("unable to roll back to generation %v: %w", number, err)
+	}
+
+	j, err := newJournal(logger)
+	if err != nil {
+		return err
+	}
+	defer j.close()
+	defer func() {
+		if err != nil {
+			if rbErr := j.rollback(); rbErr != nil {
+				err = fmt.Errorf("%w (restoring the previous state also failed: %v)", err, rbErr)
+			}
+		}
+	}()
+
+	for link, dest := range target.Links {
+		if err := j.record(link); err != nil {
+			return err
+		}
+		if err := ensureContainingDir(link); err != nil {
+			return err
+		}
+		if err := createSymlink(dest, link); err != nil {
+			return err
+		}
+	}
+	for file, sum := range target.Files {
+		if err := j.record(file); err != nil {
+			return err
+		}
+		if err := ensureContainingDir(file); err != nil {
+			return err
+		}
+		if err := copyFile(snapshotPath(store.dir(number), sum), file, 0744); err != nil {
+			return fmt.Errorf("error restoring %v: %w", file, err)
+		}
+	}
+
+	// Remove what was added after the target generation, as long as it hasn't been changed since
+	for link, dest := range current.Links {
+		if _, ok := target.Links[link]; ok {
+			continue
+		}
+		if actual, err := os.Readlink(link); err != nil || actual != dest {
+			continue
+		}
+		if err := j.record(link); err != nil {
+			return err
+		}
+		if err := os.Remove(link); err != nil {
+			return fmt.Errorf("error removing %v: %w", link, err)
+		}
+	}
+	for file, sum := range current.Files {
+		if _, ok := target.Files[file]; ok {
+			continue
+		}
+		if actual, err := fileSha256(file); err != nil || actual != sum {
+			continue
+		}
+		if err := j.record(file); err != nil {
+			return err
+		}
+		if err := os.Remove(file); err != nil {
+			return fmt.Errorf("error removing %v: %w", file, err)
+		}
+	}
+
+	if err := store.setCurrent(number); err != nil {
+		return err
+	}
+	logger.Info().Int("generation", number).Msg("rolled back")
+	return nil
+}
+
+// previous is the generation before number
+func (s generationStore) previous(number int) (int, error) {
+	numbers, err := s.numbers()
+	if err != nil {
+		return 0, err
+	}
+	prev := 0
+	for _, n := range numbers {
+		if n < number {
+			prev = n
+		}
+	}
+	if prev == 0 {
+		return 0, fmt.Errorf("no generation before %v to roll back to", number)
+	}
+	return prev, nil
+}
+
+func generationsFromUserConfig() (UserConfig, error) {
+	conf, err := NewOverrideableConfig(ConfigOverrides{
+		IgnoreVault: true,
+	})
+	if err != nil {
+		return UserConfig{}, fmt.Errorf("error getting config: %w", err)
+	}
+	return conf, nil
+}
+
+// GenerationList lists every stored generation, oldest first
+func GenerationList() ([]Generation, error) {
+	conf, err := generationsFromUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	return listGenerations(newGenerationStore(conf))
+}
+
+func listGenerations(store generationStore) ([]Generation, error) {
+	numbers, err := store.numbers()
+	if err != nil {
+		return nil, err
+	}
+	current, err := store.current()
+	if err != nil {
+		return nil, err
+	}
+
+	generations := []Generation{}
+	for _, n := range numbers {
+		g, err := store.load(n)
+		if err != nil {
+			return nil, err
+		}
+		g.Current = n == current
+		generations = append(generations, *g)
+	}
+	return generations, nil
+}
+
+type RollbackOpts struct {
+	// Generation to roll back to, defaults to the one before the current generation
+	Generation int
+	Logger     zerolog.Logger
+}
+
+func Rollback(opts RollbackOpts) error {
+	conf, err := generationsFromUserConfig()
+	if err != nil {
+		return err
+	}
+	return rollbackTo(conf, opts.Generation, opts.Logger)
+}
@@ -0,0 +1,165 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerations(t *testing.T) {
+	defer cleanFuncsMap(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tool " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	conf := setupForConfigFile(t, "dot_conf", "version one")
+	conf.BinaryDir = filepath.Join(conf.HomeDir, "bin")
+	conf.CacheDir = t.TempDir()
+	store := newGenerationStore(conf)
+
+	tool := func(tag string) *UrlDownload {
+		return &UrlDownload{
+			Name:     "tool",
+			Tag:      tag,
+			LinuxUrl: srv.URL + "/" + tag,
+			MacUrl:   srv.URL + "/" + tag,
+		}
+	}
+	extra := &UrlDownload{
+		Name:     "extra",
+		Tag:      "v1.0.0",
+		LinuxUrl: srv.URL + "/extra",
+		MacUrl:   srv.URL + "/extra",
+	}
+	conf1 := &ConfigFile{TemplateName: "dot_conf", Destination: "~/.config/conf"}
+
+	sync := func(executors ...Executor) {
+		t.Helper()
+		for _, ex := range executors {
+			ex.SetLogger(zerolog.Nop())
+			_, err := ex.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+		}
+		require.NoError(t, recordGeneration(conf, executors, executors, zerolog.Nop()))
+	}
+
+	sync(tool("v1.0.0"), conf1)
+
+	// Nothing changed, so no new generation
+	sync(tool("v1.0.0"), conf1)
+	numbers, err := store.numbers()
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, numbers)
+
+	require.NoError(t, os.WriteFile(conf1.templatePath(conf.CloneLocation), []byte("version two"), 0644))
+	sync(tool("v2.0.0"), conf1, extra)
+
+	generations, err := listGenerations(store)
+	require.NoError(t, err)
+	require.Len(t, generations, 2)
+	require.False(t, generations[0].Current)
+	require.True(t, generations[1].Current)
+	require.Equal(t, "v2.0.0", generations[1].Versions["tool"])
+	requireContents(t, filepath.Join(conf.BinaryDir, "tool"), "tool /v2.0.0")
+
+	t.Run("rolls back to the previous generation", func(t *testing.T) {
+		require.NoError(t, rollbackTo(conf, 0, zerolog.Nop()))
+
+		requireContents(t, filepath.Join(conf.BinaryDir, "tool"), "tool /v1.0.0")
+		requireContents(t, filepath.Join(conf.HomeDir, ".config", "conf"), "version one")
+		_, err := os.Lstat(filepath.Join(conf.BinaryDir, "extra"))
+		require.True(t, os.IsNotExist(err))
+
+		current, err := store.current()
+		require.NoError(t, err)
+		require.Equal(t, 1, current)
+
+		require.ErrorContains(t, rollbackTo(conf, 0, zerolog.Nop()), "no generation before 1")
+	})
+
+	t.Run("and forward again", func(t *testing.T) {
+		require.NoError(t, rollbackTo(conf, 2, zerolog.Nop()))
+		requireContents(t, filepath.Join(conf.BinaryDir, "tool"), "tool /v2.0.0")
+		requireContents(t, filepath.Join(conf.HomeDir, ".config", "conf"), "version two")
+		requireContents(t, filepath.Join(conf.BinaryDir, "extra"), "tool /extra")
+	})
+
+	t.Run("missing versions are refused", func(t *testing.T) {
+		require.NoError(t, os.Remove(filepath.Join(conf.BinaryDir, "tool-v1.0.0")))
+		err := rollbackTo(conf, 1, zerolog.Nop())
+		require.ErrorContains(t, err, "no longer installed")
+
+		// Nothing should have been touched
+		requireContents(t, filepath.Join(conf.BinaryDir, "tool"), "tool /v2.0.0")
+		current, err := store.current()
+		require.NoError(t, err)
+		require.Equal(t, 2, current)
+	})
+}
+
+func TestRecordGenerationPartialSync(t *testing.T) {
+	defer cleanFuncsMap(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("tool " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	conf := setupForConfigFile(t, "dot_conf", "version one")
+	conf.BinaryDir = filepath.Join(conf.HomeDir, "bin")
+	conf.CacheDir = t.TempDir()
+	store := newGenerationStore(conf)
+
+	tool := &UrlDownload{Name: "tool", Tag: "v1.0.0", LinuxUrl: srv.URL + "/v1.0.0", MacUrl: srv.URL + "/v1.0.0"}
+	conf1 := &ConfigFile{Name: "conf", TemplateName: "dot_conf", Destination: "~/.config/conf"}
+	// Never resolved, as it isn't run by any of the partial syncs
+	latest := &GithubRelease{releaseCommon: releaseCommon{Name: "latest", Tag: Latest}, Repo: "org/latest"}
+	configured := []Executor{tool, conf1, latest}
+
+	sync := func(ran ...Executor) {
+		t.Helper()
+		for _, ex := range ran {
+			ex.SetLogger(zerolog.Nop())
+			_, err := ex.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+		}
+		require.NoError(t, recordGeneration(conf, ran, configured, zerolog.Nop()))
+	}
+
+	sync(tool, conf1)
+	first, err := store.load(1)
+	require.NoError(t, err)
+	require.NotContains(t, first.Versions, "latest")
+
+	// Only the config file ran, and it didn't change, so neither did anything else
+	sync(conf1)
+	numbers, err := store.numbers()
+	require.NoError(t, err)
+	require.Equal(t, []int{1}, numbers)
+
+	// The tool is carried over from the first generation rather than dropped
+	require.NoError(t, os.WriteFile(conf1.templatePath(conf.CloneLocation), []byte("version two"), 0644))
+	sync(conf1)
+	second, err := store.load(2)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"tool": "v1.0.0"}, second.Versions)
+	require.Equal(t, first.Links, second.Links)
+
+	// And carried over files can still be restored
+	tool.Tag = "v2.0.0"
+	tool.LinuxUrl, tool.MacUrl = srv.URL+"/v2.0.0", srv.URL+"/v2.0.0"
+	sync(tool)
+	require.NoError(t, rollbackTo(conf, 1, zerolog.Nop()))
+	requireContents(t, filepath.Join(conf.HomeDir, ".config", "conf"), "version one")
+	require.NoError(t, rollbackTo(conf, 3, zerolog.Nop()))
+	requireContents(t, filepath.Join(conf.HomeDir, ".config", "conf"), "version two")
+	requireContents(t, filepath.Join(conf.BinaryDir, "tool"), "tool /v2.0.0")
+}
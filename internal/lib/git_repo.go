@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 	"path"
 
@@ -12,6 +13,7 @@ import (
 )
 
 var _ Executor = (*GitRepo)(nil)
+var _ bundleExporter = (*GitRepo)(nil)
 
 type GitRepo struct {
 	Name        string         `yaml:"-"`
@@ -78,7 +80,7 @@ func (g *GitRepo) location(conf UserConfig) string {
 	return replaceTilde(g.Location, conf.HomeDir)
 }
 
-func (g *GitRepo) Execute(conf UserConfig, _ SyncOpts, _ GodotConfig) error {
+func (g *GitRepo) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
 	g.log.Info().Str("url", g.URL).Msg("ensuring git repo cloned")
 
 	var repo *git.Repository
@@ -87,38 +89,98 @@ func (g *GitRepo) Execute(conf UserConfig, _ SyncOpts, _ GodotConfig) error {
 	// Check if it's already cloned
 	cloned, err := g.isRepoCloned(conf)
 	if err != nil {
-		return err
+		return false, err
 	}
 
 	// Either clone it or open it
+	before := plumbing.ZeroHash
 	if !cloned {
-		repo, err = g.cloneRepo(conf)
+		if err := opts.journal.record(g.location(conf)); err != nil {
+			return false, err
+		}
+		repo, err = g.cloneRepo(ctx, conf)
 	} else {
 		repo, err = g.openRepo(conf)
+		if err == nil {
+			err = g.recordHead(repo, opts.journal)
+		}
+		if err == nil {
+			before, err = headHash(repo)
+		}
 	}
 	if err != nil {
-		return fmt.Errorf("error ensuring repo cloned: %w", err)
+		return false, fmt.Errorf("error ensuring repo cloned: %w", err)
 	}
 
 	// Either pull the latest commits, or ensure that that requested commit is checked out
 	if g.TrackLatest {
-		if err := g.pullRepo(repo, conf); err != nil {
-			return fmt.Errorf("error pulling latest: %w", err)
+		if err := g.pullRepo(ctx, repo, conf); err != nil {
+			return false, fmt.Errorf("error pulling latest: %w", err)
 		}
-		return nil
 	} else {
 		if !g.Ref.IsZero() {
 			// Fetch any new commits
-			if err := g.fetchRepo(repo, conf); err != nil {
-				return fmt.Errorf("error fetching new commits: %w", err)
+			if err := g.fetchRepo(ctx, repo, conf); err != nil {
+				return false, fmt.Errorf("error fetching new commits: %w", err)
 			}
 			g.log.Info().Str("ref", g.Ref.String()).Msg("ensuring at ref")
 			if err := g.ensureCommitCheckedOut(repo, g.Ref); err != nil {
-				return fmt.Errorf("error ensuring commit checked out: %w", err)
+				return false, fmt.Errorf("error ensuring commit checked out: %w", err)
 			}
 		}
 	}
 
+	after, err := headHash(repo)
+	if err != nil {
+		return false, err
+	}
+	return !cloned || after != before, nil
+}
+
+// headHash is the commit currently checked out
+func headHash(repo *git.Repository) (plumbing.Hash, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("error reading HEAD: %v", err)
+	}
+	return head.Hash(), nil
+}
+
+func (g *GitRepo) exportToBundle(ctx context.Context, conf UserConfig, _ GodotConfig, w *bundleWriter) error {
+	return w.addRepo(ctx, g.URL, g.authFromConfig(conf))
+}
+
+// recordHead registers a rollback that returns the repo to whatever is currently checked out
+func (g *GitRepo) recordHead(repo *git.Repository, j *journal) error {
+	if j == nil {
+		return nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("error reading HEAD: %v", err)
+	}
+
+	j.onRollback(func() error {
+		current, err := repo.Head()
+		if err == nil && current.Name() == head.Name() && current.Hash() == head.Hash() {
+			return nil
+		}
+		w, err := repo.Worktree()
+		if err != nil {
+			return fmt.Errorf("error getting worktree: %v", err)
+		}
+		checkout := &git.CheckoutOptions{Hash: head.Hash()}
+		if head.Name().IsBranch() {
+			checkout = &git.CheckoutOptions{Branch: head.Name()}
+		}
+		if err := w.Checkout(checkout); err != nil {
+			return fmt.Errorf("error restoring %v: %v", g.URL, err)
+		}
+		if err := w.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.MergeReset}); err != nil {
+			return fmt.Errorf("error restoring %v: %v", g.URL, err)
+		}
+		return nil
+	})
 	return nil
 }
 
@@ -132,16 +194,26 @@ func (g *GitRepo) isRepoCloned(conf UserConfig) (bool, error) {
 
 func (g *GitRepo) authFromConfig(conf UserConfig) *http.BasicAuth {
 	if g.Private {
+		// Only the repo's own host gets a token, the github PAT is never sent anywhere but github.com
+		token := conf.tokenForHost(hostFromUrl(g.URL))
+		if token == "" {
+			return nil
+		}
 		return &http.BasicAuth{
 			Username: "my-cool-token",
-			Password: conf.GithubPAT,
+			Password: token,
 		}
 	}
 	return nil
 }
 
-func (g *GitRepo) cloneRepo(conf UserConfig) (*git.Repository, error) {
-	repo, err := git.PlainClone(
+func (g *GitRepo) cloneRepo(ctx context.Context, conf UserConfig) (*git.Repository, error) {
+	if conf.offline != nil {
+		return g.cloneFromBundle(ctx, conf)
+	}
+
+	repo, err := git.PlainCloneContext(
+		ctx,
 		g.location(conf),
 		false,
 		&git.CloneOptions{
@@ -155,6 +227,73 @@ func (g *GitRepo) cloneRepo(conf UserConfig) (*git.Repository, error) {
 	return repo, nil
 }
 
+// cloneFromBundle clones the offline bundle's copy of the repo, and then points origin back at the
+// real url so that later online syncs behave as if it had been cloned normally
+func (g *GitRepo) cloneFromBundle(ctx context.Context, conf UserConfig) (*git.Repository, error) {
+	bundled, err := conf.offline.repoPath(g.URL)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := git.PlainCloneContext(
+		ctx,
+		g.location(conf),
+		false,
+		&git.CloneOptions{
+			URL: bundled,
+		},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error cloning %v from bundle: %v", g.URL, err)
+	}
+	if err := setOriginUrls(repo, []string{g.URL}); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// withRemote runs fn against origin, temporarily pointing it at the offline bundle's copy of the
+// repo when syncing offline
+func (g *GitRepo) withRemote(repo *git.Repository, conf UserConfig, fn func(auth *http.BasicAuth) error) error {
+	if conf.offline == nil {
+		return fn(g.authFromConfig(conf))
+	}
+
+	bundled, err := conf.offline.repoPath(g.URL)
+	if err != nil {
+		return err
+	}
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return fmt.Errorf("error getting remote: %v", err)
+	}
+	original := remote.Config().URLs
+
+	if err := setOriginUrls(repo, []string{bundled}); err != nil {
+		return err
+	}
+	fnErr := fn(nil)
+	if err := setOriginUrls(repo, original); err != nil {
+		return err
+	}
+	return fnErr
+}
+
+func setOriginUrls(repo *git.Repository, urls []string) error {
+	cfg, err := repo.Config()
+	if err != nil {
+		return fmt.Errorf("error reading repo config: %v", err)
+	}
+	remote, ok := cfg.Remotes[git.DefaultRemoteName]
+	if !ok {
+		return fmt.Errorf("repo has no %v remote", git.DefaultRemoteName)
+	}
+	remote.URLs = urls
+	if err := repo.SetConfig(cfg); err != nil {
+		return fmt.Errorf("error writing repo config: %v", err)
+	}
+	return nil
+}
+
 func (g *GitRepo) openRepo(conf UserConfig) (*git.Repository, error) {
 	repo, err := git.PlainOpen(g.location(conf))
 	if err != nil {
@@ -163,9 +302,11 @@ func (g *GitRepo) openRepo(conf UserConfig) (*git.Repository, error) {
 	return repo, nil
 }
 
-func (g *GitRepo) fetchRepo(repo *git.Repository, conf UserConfig) error {
-	err := repo.Fetch(&git.FetchOptions{
-		Auth: g.authFromConfig(conf),
+func (g *GitRepo) fetchRepo(ctx context.Context, repo *git.Repository, conf UserConfig) error {
+	err := g.withRemote(repo, conf, func(auth *http.BasicAuth) error {
+		return repo.FetchContext(ctx, &git.FetchOptions{
+			Auth: auth,
+		})
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("error fetching new commits: %v", err)
@@ -173,14 +314,16 @@ func (g *GitRepo) fetchRepo(repo *git.Repository, conf UserConfig) error {
 	return nil
 }
 
-func (g *GitRepo) pullRepo(repo *git.Repository, conf UserConfig) error {
+func (g *GitRepo) pullRepo(ctx context.Context, repo *git.Repository, conf UserConfig) error {
 	w, err := repo.Worktree()
 	if err != nil {
 		return fmt.Errorf("error getting worktree: %v", err)
 	}
 
-	err = w.Pull(&git.PullOptions{
-		Auth: g.authFromConfig(conf),
+	err = g.withRemote(repo, conf, func(auth *http.BasicAuth) error {
+		return w.PullContext(ctx, &git.PullOptions{
+			Auth: auth,
+		})
 	})
 	if err != nil && err != git.NoErrAlreadyUpToDate {
 		return fmt.Errorf("error pulling repo: %v", err)
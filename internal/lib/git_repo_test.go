@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"path"
 	"strings"
 	"testing"
@@ -19,7 +20,7 @@ func TestGitRepo(t *testing.T) {
 	}, "\n")
 
 	checkMsg := func(t *testing.T, loc string) {
-		stdout, _, err := runCmd("git", "-C", loc, "log", "-n", "1")
+		stdout, _, err := runCmd(context.Background(), "git", "-C", loc, "log", "-n", "1")
 		require.NoError(t, err)
 
 		require.Equal(t, expectedCommitMsg, stdout)
@@ -37,7 +38,8 @@ func TestGitRepo(t *testing.T) {
 				Tag: "v1.4.2",
 			},
 		}
-		require.NoError(t, gr.Execute(UserConfig{}, SyncOpts{}, GodotConfig{}))
+		_, err := gr.Execute(context.Background(), UserConfig{}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 		checkMsg(t, loc)
 	})
 
@@ -53,7 +55,27 @@ func TestGitRepo(t *testing.T) {
 				Commit: "02c8c0085385f7d65ba35556edfc58e0f48257eb",
 			},
 		}
-		require.NoError(t, gr.Execute(UserConfig{}, SyncOpts{}, GodotConfig{}))
+		_, err := gr.Execute(context.Background(), UserConfig{}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 		checkMsg(t, loc)
 	})
 }
+
+func TestGitRepoAuth(t *testing.T) {
+	conf := UserConfig{
+		GithubPAT:  "github-pat",
+		HostTokens: map[string]string{"gitea.example.com": "gitea-token"},
+	}
+	password := func(url string) string {
+		auth := (&GitRepo{URL: url, Private: true}).authFromConfig(conf)
+		if auth == nil {
+			return ""
+		}
+		return auth.Password
+	}
+
+	require.Equal(t, "github-pat", password("https://github.com/org/private.git"))
+	require.Equal(t, "gitea-token", password("https://gitea.example.com/org/private.git"))
+	require.Equal(t, "", password("https://gitlab.example.com/org/private.git"))
+	require.Nil(t, (&GitRepo{URL: "https://github.com/org/public.git"}).authFromConfig(conf))
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	GiteaDefaultApiUrl = "https://codeberg.org/api/v1"
+)
+
+var _ Executor = (*GiteaRelease)(nil)
+var _ releaseForge = (*GiteaRelease)(nil)
+var _ bundleExporter = (*GiteaRelease)(nil)
+var _ generationRecorder = (*GiteaRelease)(nil)
+
+// GiteaRelease installs release assets from a Gitea or Forgejo instance, such as Codeberg
+type GiteaRelease struct {
+	releaseCommon `yaml:",inline" mapstructure:",squash"`
+	Repo          string `yaml:"repo" mapstructure:"repo"`
+}
+
+func (g *GiteaRelease) Type() ExecutorType {
+	return ExecutorTypeGiteaRelease
+}
+
+func (g *GiteaRelease) Validate() error {
+	var errs *multierror.Error
+
+	if g.Repo == "" {
+		errs = multierror.Append(errs, fmt.Errorf("repo is required"))
+	}
+	errs = multierror.Append(errs, g.releaseCommon.validate())
+
+	return errs.ErrorOrNil()
+}
+
+func (g *GiteaRelease) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
+	return g.execute(ctx, conf, opts, g)
+}
+
+func (g *GiteaRelease) exportToBundle(ctx context.Context, conf UserConfig, _ GodotConfig, w *bundleWriter) error {
+	return g.export(ctx, conf, g, w)
+}
+
+func (g *GiteaRelease) apiUrl() string {
+	if g.ApiUrl != "" {
+		return strings.TrimSuffix(g.ApiUrl, "/")
+	}
+	return GiteaDefaultApiUrl
+}
+
+func (g *GiteaRelease) authorize(conf UserConfig, req *requests.Builder) {
+	if token := conf.tokenForHost(hostFromUrl(g.apiUrl())); token != "" {
+		req.Header("Authorization", "token "+token)
+	}
+}
+
+func (g *GiteaRelease) latestTag(ctx context.Context, conf UserConfig) (string, error) {
+	var resp githubTag
+	req := requests.
+		URL(fmt.Sprintf("%v/repos/%v/releases/latest", g.apiUrl(), g.Repo)).
+		ToJSON(&resp).
+		Client(conf.httpClient())
+	g.authorize(conf, req)
+	if err := req.Fetch(ctx); err != nil {
+		return "", fmt.Errorf("error getting latest release for %v: %v", g.Repo, err)
+	}
+	return resp.TagName, nil
+}
+
+func (g *GiteaRelease) assetsForTag(ctx context.Context, conf UserConfig, tag string) ([]release, error) {
+	var resp releaseResponse
+	req := requests.
+		URL(fmt.Sprintf("%v/repos/%v/releases/tags/%v", g.apiUrl(), g.Repo, tag)).
+		ToJSON(&resp).
+		Client(conf.httpClient())
+	g.authorize(conf, req)
+	if err := req.Fetch(ctx); err != nil {
+		return nil, fmt.Errorf("error getting release %v for %v: %v", tag, g.Repo, err)
+	}
+
+	// Gitea's asset url points at the API's metadata for the asset, not the asset itself
+	for i := range resp.Assets {
+		resp.Assets[i].Url = resp.Assets[i].DownloadUrl
+	}
+	return resp.Assets, nil
+}
+
+func (g *GiteaRelease) downloadRequestFunc(conf UserConfig, assetUrl string) func(*requests.Builder) {
+	return func(req *requests.Builder) {
+		if sameHost(assetUrl, g.apiUrl()) {
+			g.authorize(conf, req)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGiteaReleaseExecute(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	assetName := fmt.Sprintf("tool-%v-%v", runtime.GOOS, runtime.GOARCH)
+
+	mux.HandleFunc("/api/v1/repos/owner/tool/releases/tags/v2.0.0", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token my-gitea-token", r.Header.Get("Authorization"))
+		fmt.Fprintf(
+			w,
+			`{"tag_name": "v2.0.0", "assets": [{"name": "%v", "browser_download_url": "%v/attachments/%v"}, {"name": "tool.sha256", "browser_download_url": "%v/attachments/tool.sha256"}]}`,
+			assetName, srv.URL, assetName, srv.URL,
+		)
+	})
+	mux.HandleFunc("/attachments/"+assetName, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "token my-gitea-token", r.Header.Get("Authorization"))
+		fmt.Fprint(w, "gitea binary")
+	})
+
+	dir := t.TempDir()
+	g := GiteaRelease{
+		releaseCommon: releaseCommon{
+			Name:   "tool",
+			Tag:    "v2.0.0",
+			ApiUrl: srv.URL + "/api/v1",
+		},
+		Repo: "owner/tool",
+	}
+	_, err := g.Execute(context.Background(), UserConfig{
+		BinaryDir: dir,
+		HostTokens: map[string]string{
+			hostFromUrl(srv.URL): "my-gitea-token",
+		},
+	}, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(dir, "tool"), "gitea binary")
+}
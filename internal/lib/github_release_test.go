@@ -1,8 +1,14 @@
 package lib
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"testing"
 
@@ -38,16 +44,18 @@ func TestGithubReleaseExecute(t *testing.T) {
 		dir := t.TempDir()
 
 		g := GithubRelease{
-			Name:         "godot",
-			Repo:         "nicjohnson145/godot",
-			IsArchive:    false,
-			Tag:          "v2.4.1",
+			releaseCommon: releaseCommon{
+				Name: "godot",
+				Tag:  "v2.4.1",
+			},
+			Repo: "nicjohnson145/godot",
 		}
-		require.NoError(t, g.Execute(UserConfig{
+		_, err := g.Execute(context.Background(), UserConfig{
 			BinaryDir:  dir,
 			GithubUser: ghuser,
 			GithubAuth: BasicAuth(ghuser, ghpat),
-		}, SyncOpts{}, GodotConfig{}))
+		}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 
 		checkFiles(t, dir, []string{"godot", "godot-v2.4.1"})
 	})
@@ -56,16 +64,18 @@ func TestGithubReleaseExecute(t *testing.T) {
 		dir := t.TempDir()
 
 		g := GithubRelease{
-			Name:         "rg",
-			Repo:         "BurntSushi/ripgrep",
-			IsArchive:    true,
-			Tag:          "13.0.0",
+			releaseCommon: releaseCommon{
+				Name: "rg",
+				Tag:  "13.0.0",
+			},
+			Repo: "BurntSushi/ripgrep",
 		}
-		require.NoError(t, g.Execute(UserConfig{
+		_, err := g.Execute(context.Background(), UserConfig{
 			BinaryDir:  dir,
 			GithubUser: ghuser,
 			GithubAuth: BasicAuth(ghuser, ghpat),
-		}, SyncOpts{}, GodotConfig{}))
+		}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 
 		checkFiles(t, dir, []string{"rg", "rg-13.0.0"})
 	})
@@ -74,17 +84,19 @@ func TestGithubReleaseExecute(t *testing.T) {
 		dir := t.TempDir()
 
 		g := GithubRelease{
-			Name:         "gh",
-			Repo:         "cli/cli",
-			IsArchive:    true,
-			Tag:          "v2.12.1",
-			Regex:        ".*/bin/gh$",
+			releaseCommon: releaseCommon{
+				Name:  "gh",
+				Tag:   "v2.12.1",
+				Regex: ".*/bin/gh$",
+			},
+			Repo: "cli/cli",
 		}
-		require.NoError(t, g.Execute(UserConfig{
+		_, err := g.Execute(context.Background(), UserConfig{
 			BinaryDir:  dir,
 			GithubUser: ghuser,
 			GithubAuth: BasicAuth(ghuser, ghpat),
-		}, SyncOpts{}, GodotConfig{}))
+		}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
 
 		checkFiles(t, dir, []string{"gh", "gh-v2.12.1"})
 	})
@@ -93,44 +105,39 @@ func TestGithubReleaseExecute(t *testing.T) {
 func TestGetAssetAutoDetection(t *testing.T) {
 
 	testData := []struct {
-		name      string
-		path      string
-		os        string
-		arch      string
-		want      string
-		IsArchive bool
+		name string
+		path string
+		os   string
+		arch string
+		want string
 	}{
 		{
-			name:      "rg-linux-amd64",
-			path:      "rg-13.0.0.json",
-			os:        "linux",
-			arch:      "amd64",
-			want:      "ripgrep-13.0.0-x86_64-unknown-linux-musl.tar.gz",
-			IsArchive: true,
+			name: "rg-linux-amd64",
+			path: "rg-13.0.0.json",
+			os:   "linux",
+			arch: "amd64",
+			want: "ripgrep-13.0.0-x86_64-unknown-linux-musl.tar.gz",
 		},
 		{
-			name:      "zoxide-linux-amd64",
-			path:      "zoxide-v0.8.2.json",
-			os:        "linux",
-			arch:      "amd64",
-			want:      "zoxide-0.8.2-x86_64-unknown-linux-musl.tar.gz",
-			IsArchive: true,
+			name: "zoxide-linux-amd64",
+			path: "zoxide-v0.8.2.json",
+			os:   "linux",
+			arch: "amd64",
+			want: "zoxide-0.8.2-x86_64-unknown-linux-musl.tar.gz",
 		},
 		{
-			name:      "rg-mac-amd64",
-			path:      "rg-13.0.0.json",
-			os:        "darwin",
-			arch:      "amd64",
-			want:      "ripgrep-13.0.0-x86_64-apple-darwin.tar.gz",
-			IsArchive: true,
+			name: "rg-mac-amd64",
+			path: "rg-13.0.0.json",
+			os:   "darwin",
+			arch: "amd64",
+			want: "ripgrep-13.0.0-x86_64-apple-darwin.tar.gz",
 		},
 		{
-			name:      "zoxide-mac-amd64",
-			path:      "zoxide-v0.8.2.json",
-			os:        "darwin",
-			arch:      "amd64",
-			want:      "zoxide-0.8.2-x86_64-apple-darwin.tar.gz",
-			IsArchive: true,
+			name: "zoxide-mac-amd64",
+			path: "zoxide-v0.8.2.json",
+			os:   "darwin",
+			arch: "amd64",
+			want: "zoxide-0.8.2-x86_64-apple-darwin.tar.gz",
 		},
 	}
 	for _, tc := range testData {
@@ -142,11 +149,89 @@ func TestGetAssetAutoDetection(t *testing.T) {
 			err = json.Unmarshal(data, &resp)
 			require.NoError(t, err)
 			g := GithubRelease{}
-			got, err := g.getAsset(resp, tc.os, tc.arch)
+			got, err := g.selector().selectAsset(resp.Assets, tc.os, tc.arch)
 			require.NoError(t, err)
 			require.Equal(t, tc.want, got.Name)
-			// Should also properly set that the release is an archive
-			require.Equal(t, tc.IsArchive, g.IsArchive)
 		})
 	}
 }
+
+func TestGithubReleaseApiUrl(t *testing.T) {
+	const auth = "Bearer my-enterprise-token"
+
+	newServer := func(t *testing.T) *httptest.Server {
+		t.Helper()
+
+		mux := http.NewServeMux()
+		srv := httptest.NewServer(mux)
+		t.Cleanup(srv.Close)
+
+		mux.HandleFunc("/repos/org/tool/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, auth, r.Header.Get("Authorization"))
+			fmt.Fprint(w, `{"tag_name": "v1.2.3"}`)
+		})
+		mux.HandleFunc("/repos/org/tool/releases/tags/v1.2.3", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, auth, r.Header.Get("Authorization"))
+			fmt.Fprintf(w, `{"assets": [{"name": "tool", "url": "%v/assets/1", "browser_download_url": "%v/download/tool"}]}`, srv.URL, srv.URL)
+		})
+		mux.HandleFunc("/assets/1", func(w http.ResponseWriter, r *http.Request) {
+			require.Equal(t, auth, r.Header.Get("Authorization"))
+			require.Equal(t, "application/octet-stream", r.Header.Get("Accept"))
+			fmt.Fprint(w, "#!/bin/sh\necho hello\n")
+		})
+
+		return srv
+	}
+
+	confFor := func(srv *httptest.Server, binDir string) UserConfig {
+		return UserConfig{
+			BinaryDir:  binDir,
+			GithubAuth: "Basic should-not-be-sent",
+			HostTokens: map[string]string{
+				hostFromUrl(srv.URL): "my-enterprise-token",
+			},
+		}
+	}
+
+	t.Run("latest", func(t *testing.T) {
+		srv := newServer(t)
+		g := GithubRelease{releaseCommon: releaseCommon{ApiUrl: srv.URL}, Repo: "org/tool"}
+
+		tag, err := g.GetLatestRelease(context.Background(), confFor(srv, t.TempDir()))
+		require.NoError(t, err)
+		require.Equal(t, "v1.2.3", tag)
+	})
+
+	t.Run("executor_override", func(t *testing.T) {
+		srv := newServer(t)
+		dir := t.TempDir()
+
+		g := GithubRelease{
+			releaseCommon: releaseCommon{
+				Name:   "tool",
+				Tag:    Latest,
+				ApiUrl: srv.URL,
+				AssetPatterns: map[string]map[string]string{
+					runtime.GOOS: {
+						runtime.GOARCH: "^tool$",
+					},
+				},
+			},
+			Repo: "org/tool",
+		}
+		_, err := g.Execute(context.Background(), confFor(srv, dir), SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(dir, "tool"), "#!/bin/sh\necho hello\n")
+	})
+
+	t.Run("user_config", func(t *testing.T) {
+		srv := newServer(t)
+		conf := confFor(srv, t.TempDir())
+		conf.GithubApiUrl = srv.URL
+
+		g := GithubRelease{Repo: "org/tool"}
+		tag, err := g.GetLatestRelease(context.Background(), conf)
+		require.NoError(t, err)
+		require.Equal(t, "v1.2.3", tag)
+	})
+}
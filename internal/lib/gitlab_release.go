@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	GitlabDefaultApiUrl = "https://gitlab.com/api/v4"
+)
+
+type gitlabReleaseResponse struct {
+	TagName string `json:"tag_name"`
+	Assets  struct {
+		Links []gitlabReleaseLink `json:"links"`
+	} `json:"assets"`
+}
+
+type gitlabReleaseLink struct {
+	Name           string `json:"name"`
+	Url            string `json:"url"`
+	DirectAssetUrl string `json:"direct_asset_url"`
+}
+
+var _ Executor = (*GitlabRelease)(nil)
+var _ releaseForge = (*GitlabRelease)(nil)
+var _ bundleExporter = (*GitlabRelease)(nil)
+var _ generationRecorder = (*GitlabRelease)(nil)
+
+type GitlabRelease struct {
+	releaseCommon `yaml:",inline" mapstructure:",squash"`
+	Project       string `yaml:"project" mapstructure:"project"`
+}
+
+func (g *GitlabRelease) Type() ExecutorType {
+	return ExecutorTypeGitlabRelease
+}
+
+func (g *GitlabRelease) Validate() error {
+	var errs *multierror.Error
+
+	if g.Project == "" {
+		errs = multierror.Append(errs, fmt.Errorf("project is required"))
+	}
+	errs = multierror.Append(errs, g.releaseCommon.validate())
+
+	return errs.ErrorOrNil()
+}
+
+func (g *GitlabRelease) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
+	return g.execute(ctx, conf, opts, g)
+}
+
+func (g *GitlabRelease) exportToBundle(ctx context.Context, conf UserConfig, _ GodotConfig, w *bundleWriter) error {
+	return g.export(ctx, conf, g, w)
+}
+
+func (g *GitlabRelease) apiUrl() string {
+	if g.ApiUrl != "" {
+		return strings.TrimSuffix(g.ApiUrl, "/")
+	}
+	return GitlabDefaultApiUrl
+}
+
+// projectUrl is the API url for the project, GitLab accepts the url encoded namespace path in place
+// of the numeric project ID
+func (g *GitlabRelease) projectUrl() string {
+	return fmt.Sprintf("%v/projects/%v", g.apiUrl(), url.PathEscape(g.Project))
+}
+
+func (g *GitlabRelease) authorize(conf UserConfig, req *requests.Builder) {
+	if token := conf.tokenForHost(hostFromUrl(g.apiUrl())); token != "" {
+		req.Header("PRIVATE-TOKEN", token)
+	}
+}
+
+func (g *GitlabRelease) latestTag(ctx context.Context, conf UserConfig) (string, error) {
+	var resp gitlabReleaseResponse
+	req := requests.
+		URL(g.projectUrl() + "/releases/permalink/latest").
+		ToJSON(&resp).
+		Client(conf.httpClient())
+	g.authorize(conf, req)
+	if err := req.Fetch(ctx); err != nil {
+		return "", fmt.Errorf("error getting latest release for %v: %v", g.Project, err)
+	}
+	return resp.TagName, nil
+}
+
+func (g *GitlabRelease) assetsForTag(ctx context.Context, conf UserConfig, tag string) ([]release, error) {
+	var resp gitlabReleaseResponse
+	req := requests.
+		URL(g.projectUrl() + "/releases/" + url.PathEscape(tag)).
+		ToJSON(&resp).
+		Client(conf.httpClient())
+	g.authorize(conf, req)
+	if err := req.Fetch(ctx); err != nil {
+		return nil, fmt.Errorf("error getting release %v for %v: %v", tag, g.Project, err)
+	}
+
+	assets := []release{}
+	for _, link := range resp.Assets.Links {
+		downloadUrl := link.DirectAssetUrl
+		if downloadUrl == "" {
+			downloadUrl = link.Url
+		}
+		assets = append(assets, release{
+			Name:        link.Name,
+			DownloadUrl: downloadUrl,
+			Url:         downloadUrl,
+		})
+	}
+	return assets, nil
+}
+
+// downloadRequestFunc only sends the token to GitLab itself, as release links can point at any
+// host
+func (g *GitlabRelease) downloadRequestFunc(conf UserConfig, assetUrl string) func(*requests.Builder) {
+	return func(req *requests.Builder) {
+		if sameHost(assetUrl, g.apiUrl()) {
+			g.authorize(conf, req)
+		}
+	}
+}
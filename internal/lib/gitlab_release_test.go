@@ -0,0 +1,108 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitlabReleaseExecute(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	assetName := fmt.Sprintf("tool-%v-%v", runtime.GOOS, runtime.GOARCH)
+
+	// The project path is url encoded into a single path segment
+	mux.HandleFunc("/api/v4/projects/group%2Fsub%2Ftool/releases/permalink/latest", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "my-gitlab-token", r.Header.Get("PRIVATE-TOKEN"))
+		fmt.Fprint(w, `{"tag_name": "v0.1.0"}`)
+	})
+	mux.HandleFunc("/api/v4/projects/group%2Fsub%2Ftool/releases/v0.1.0", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "my-gitlab-token", r.Header.Get("PRIVATE-TOKEN"))
+		fmt.Fprintf(w, `{"tag_name": "v0.1.0", "assets": {"links": [{"name": "%v", "direct_asset_url": "%v/downloads/%v"}]}}`, assetName, srv.URL, assetName)
+	})
+	mux.HandleFunc("/downloads/"+assetName, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "gitlab binary")
+	})
+
+	dir := t.TempDir()
+	g := GitlabRelease{
+		releaseCommon: releaseCommon{
+			Name:   "tool",
+			Tag:    Latest,
+			ApiUrl: srv.URL + "/api/v4",
+		},
+		Project: "group/sub/tool",
+	}
+	_, err := g.Execute(context.Background(), UserConfig{
+		BinaryDir: dir,
+		HostTokens: map[string]string{
+			hostFromUrl(srv.URL): "my-gitlab-token",
+		},
+	}, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(dir, "tool-v0.1.0"), "gitlab binary")
+	requireContents(t, filepath.Join(dir, "tool"), "gitlab binary")
+}
+
+func TestGitlabReleaseTokenScope(t *testing.T) {
+	assetName := fmt.Sprintf("tool-%v-%v", runtime.GOOS, runtime.GOARCH)
+
+	// external stands in for wherever a release link points, it should never see the token
+	external := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("PRIVATE-TOKEN"))
+		fmt.Fprint(w, "external binary")
+	}))
+	defer external.Close()
+
+	cases := map[string]func(gitlab string) string{
+		"external link": func(string) string {
+			return fmt.Sprintf(`{"name": "%v", "url": "%v/%v"}`, assetName, external.URL, assetName)
+		},
+		"direct asset url redirecting elsewhere": func(gitlab string) string {
+			return fmt.Sprintf(`{"name": "%v", "direct_asset_url": "%v/downloads/%v"}`, assetName, gitlab, assetName)
+		},
+	}
+	for name, link := range cases {
+		t.Run(name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			mux.HandleFunc("/api/v4/projects/tool/releases/v1.0.0", func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "my-gitlab-token", r.Header.Get("PRIVATE-TOKEN"))
+				fmt.Fprintf(w, `{"tag_name": "v1.0.0", "assets": {"links": [%v]}}`, link(srv.URL))
+			})
+			mux.HandleFunc("/downloads/"+assetName, func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "my-gitlab-token", r.Header.Get("PRIVATE-TOKEN"))
+				http.Redirect(w, r, external.URL+"/"+assetName, http.StatusFound)
+			})
+
+			dir := t.TempDir()
+			g := GitlabRelease{
+				releaseCommon: releaseCommon{
+					Name:   "tool",
+					Tag:    "v1.0.0",
+					ApiUrl: srv.URL + "/api/v4",
+				},
+				Project: "tool",
+			}
+			_, err := g.Execute(context.Background(), UserConfig{
+				BinaryDir: dir,
+				HostTokens: map[string]string{
+					hostFromUrl(srv.URL): "my-gitlab-token",
+				},
+			}, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+			requireContents(t, filepath.Join(dir, "tool"), "external binary")
+		})
+	}
+}
@@ -1,20 +1,35 @@
 package lib
 
 import (
+	"context"
+	"debug/buildinfo"
 	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 )
 
 var _ Executor = (*GoInstall)(nil)
 
+// majorVersionSuffix matches the /vN suffix of a module path, which isn't part of the binary name
+var majorVersionSuffix = regexp.MustCompile(`^v[0-9]+$`)
+
 type GoInstall struct {
-	Name    string         `yaml:"-"`
-	Package string         `yaml:"package" mapstructure:"package"`
-	Version string         `yaml:"version" mapstructure:"version"`
-	log     zerolog.Logger `yaml:"-"`
+	Name    string            `yaml:"-"`
+	Package string            `yaml:"package" mapstructure:"package"`
+	Version string            `yaml:"version" mapstructure:"version"`
+	Gobin   string            `yaml:"gobin" mapstructure:"gobin"`
+	Env     map[string]string `yaml:"env" mapstructure:"env"`
+	log     zerolog.Logger    `yaml:"-"`
 }
 
 func (g *GoInstall) SetLogger(log zerolog.Logger) {
@@ -39,23 +54,144 @@ func (g *GoInstall) Validate() error {
 	if g.Package == "" {
 		errs = multierror.Append(errs, fmt.Errorf("package is required"))
 	}
+	if strings.Contains(g.Package, "@") {
+		errs = multierror.Append(errs, fmt.Errorf("package should not include a version, use version instead"))
+	}
+	for key := range g.Env {
+		if key == "" || strings.ContainsAny(key, "= ") {
+			errs = multierror.Append(errs, fmt.Errorf("invalid environment variable name %q", key))
+		}
+	}
 
 	return errs.ErrorOrNil()
 }
 
-func (g *GoInstall) Execute(_ UserConfig, _ SyncOpts, _ GodotConfig) error {
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("go-install currently only supports linux")
+func (g *GoInstall) Execute(ctx context.Context, conf UserConfig, _ SyncOpts, godotConf GodotConfig) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return false, fmt.Errorf("go-install is not supported on windows")
+	}
+
+	goBin, err := g.goBinary(conf, godotConf)
+	if err != nil {
+		return false, err
+	}
+
+	gobin, err := g.gobin(ctx, conf, goBin)
+	if err != nil {
+		return false, err
+	}
+
+	if g.upToDate(filepath.Join(gobin, g.binaryName())) {
+		g.log.Debug().Str("package", g.Package).Msg("already installed")
+		return false, nil
 	}
-	g.log.Info().Str("package", g.Package).Msg("go installing")
 
 	version := "latest"
 	if g.Version != "" {
 		version = g.Version
 	}
-	_, _, err := runCmd("/usr/local/go/bin/go", "install", g.Package+"@"+version)
+	g.log.Info().Str("package", g.Package).Str("version", version).Msg("go installing")
+
+	argv := append(g.env(gobin), goBin, "install", g.Package+"@"+version)
+	if _, stderr, err := conf.commandRunner().Run(ctx, "env", argv...); err != nil {
+		return false, fmt.Errorf("error installing package: %v\n%v", err, stderr)
+	}
+	return true, nil
+}
+
+// goBinary finds the go binary to install with; the one installed by a golang executor in the
+// current target if there is one, otherwise whatever is on the PATH
+func (g *GoInstall) goBinary(conf UserConfig, godotConf GodotConfig) (string, error) {
+	executors, err := godotConf.ExecutorsForTarget(conf.Target)
+	if err != nil {
+		return "", fmt.Errorf("error fetching target configuration: %w", err)
+	}
+	for _, ex := range executors {
+		golang, ok := ex.(*Golang)
+		if !ok {
+			continue
+		}
+		bin := golang.goBinary(conf)
+		if _, err := os.Stat(bin); err == nil {
+			return bin, nil
+		}
+	}
+
+	bin, err := exec.LookPath("go")
 	if err != nil {
-		return fmt.Errorf("error installing package: %w", err)
+		return "", fmt.Errorf("unable to find a go binary, install one with a golang executor or add it to the PATH: %w", err)
+	}
+	return bin, nil
+}
+
+// gobin is where the binary will be installed, following the same rules as go install itself
+func (g *GoInstall) gobin(ctx context.Context, conf UserConfig, goBin string) (string, error) {
+	if g.Gobin != "" {
+		return replaceTilde(g.Gobin, conf.HomeDir), nil
+	}
+	if gobin, ok := g.Env["GOBIN"]; ok && gobin != "" {
+		return replaceTilde(gobin, conf.HomeDir), nil
+	}
+
+	argv := append(g.env(""), goBin, "env", "GOBIN", "GOPATH")
+	stdout, stderr, err := conf.commandRunner().Run(ctx, "env", argv...)
+	if err != nil {
+		return "", fmt.Errorf("error reading go environment: %v\n%v", err, stderr)
+	}
+	// go env prints one line per variable, blank when unset
+	lines := strings.Split(strings.TrimRight(stdout, "\n"), "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+		return strings.TrimSpace(lines[0]), nil
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		gopath := filepath.SplitList(strings.TrimSpace(lines[1]))[0]
+		return filepath.Join(gopath, "bin"), nil
+	}
+	return "", fmt.Errorf("unable to determine GOBIN, go env returned %q", stdout)
+}
+
+// env is the environment assignments for the go command, with GOBIN overridden when given
+func (g *GoInstall) env(gobin string) []string {
+	keys := lo.Filter(lo.Keys(g.Env), func(key string, _ int) bool {
+		return gobin == "" || key != "GOBIN"
+	})
+	sort.Strings(keys)
+	env := lo.Map(keys, func(key string, _ int) string {
+		return key + "=" + g.Env[key]
+	})
+	if gobin != "" {
+		env = append(env, "GOBIN="+gobin)
+	}
+	return env
+}
+
+// binaryName is the name of the binary go install produces for the package
+func (g *GoInstall) binaryName() string {
+	elems := strings.Split(strings.TrimSuffix(g.Package, "/"), "/")
+	name := elems[len(elems)-1]
+	if majorVersionSuffix.MatchString(name) && len(elems) > 1 {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// upToDate checks the build info embedded in an installed binary against the configured version. An
+// unpinned package is only installed when missing, and anything that go has to resolve (latest, a
+// branch, a version query) is always reinstalled
+func (g *GoInstall) upToDate(binary string) bool {
+	if strings.HasSuffix(g.Package, "...") {
+		return false
+	}
+	info, err := buildinfo.ReadFile(binary)
+	if err != nil {
+		return false
+	}
+	if info.Path != path.Clean(g.Package) {
+		g.log.Debug().Str("path", info.Path).Msg("installed binary was built from a different package")
+		return false
+	}
+	if g.Version == "" {
+		return true
 	}
-	return nil
+	return info.Main.Version == g.Version
 }
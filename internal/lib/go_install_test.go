@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"context"
+	"debug/buildinfo"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoInstallBinaryName(t *testing.T) {
+	tcs := map[string]string{
+		"golang.org/x/tools/gopls":                  "gopls",
+		"github.com/go-delve/delve/cmd/dlv":         "dlv",
+		"github.com/golangci/golangci-lint/v2":      "golangci-lint",
+		"mvdan.cc/gofumpt":                          "gofumpt",
+		"github.com/nicjohnson145/godot/cmd/godot/": "godot",
+	}
+	for pkg, want := range tcs {
+		require.Equal(t, want, (&GoInstall{Package: pkg}).binaryName(), pkg)
+	}
+}
+
+func TestGoInstallUpToDate(t *testing.T) {
+	// The test binary has build info of its own to check against
+	binary, err := os.Executable()
+	require.NoError(t, err)
+	info, err := buildinfo.ReadFile(binary)
+	require.NoError(t, err)
+
+	upToDate := func(pkg string, version string) bool {
+		g := &GoInstall{Package: pkg, Version: version}
+		g.SetLogger(zerolog.Nop())
+		return g.upToDate(binary)
+	}
+	require.True(t, upToDate(info.Path, ""))
+	require.True(t, upToDate(info.Path, info.Main.Version))
+	require.False(t, upToDate(info.Path, "v0.0.1"))
+	require.False(t, upToDate("example.com/other", ""))
+	require.False(t, upToDate(info.Path, "latest"))
+	require.False(t, (&GoInstall{Package: info.Path}).upToDate(filepath.Join(t.TempDir(), "missing")))
+}
+
+func TestGoInstallExecute(t *testing.T) {
+	home := t.TempDir()
+	goDir := buildDirectoryStructure(t, map[string]string{
+		"bin/go": "#!/bin/sh\n",
+	})
+	godotConf := GodotConfig{
+		Executors: map[string]GodotExecutor{
+			"go": {Name: "go", Type: ExecutorTypeGolang, Spec: map[string]any{
+				"version":     "1.23.4",
+				"install-dir": goDir,
+			}},
+		},
+		Targets: map[string][]string{"lab": {"go"}},
+	}
+	goBin := filepath.Join(goDir, "bin", "go")
+
+	t.Run("installs into GOPATH/bin with the golang executor's go", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"env " + goBin + " env": func(args []string) (string, string, error) {
+				return "\n" + home + "/go:/other\n", "", nil
+			},
+		}}
+		conf := UserConfig{HomeDir: home, Target: "lab", runner: runner}
+		g := &GoInstall{Package: "golang.org/x/tools/gopls", Version: "v0.16.2"}
+		_, err := g.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			[]string{
+				"env " + goBin + " env GOBIN GOPATH",
+				fmt.Sprintf("env GOBIN=%v/go/bin %v install golang.org/x/tools/gopls@v0.16.2", home, goBin),
+			},
+			runner.commands,
+		)
+	})
+
+	t.Run("gobin and env", func(t *testing.T) {
+		runner := &fakeRunner{}
+		conf := UserConfig{HomeDir: home, Target: "lab", runner: runner}
+		g := &GoInstall{
+			Package: "github.com/go-delve/delve/cmd/dlv",
+			Gobin:   "~/bin",
+			Env:     map[string]string{"GOBIN": "/ignored", "CGO_ENABLED": "0", "GOFLAGS": "-trimpath"},
+		}
+		_, err := g.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			[]string{fmt.Sprintf("env CGO_ENABLED=0 GOFLAGS=-trimpath GOBIN=%v/bin %v install github.com/go-delve/delve/cmd/dlv@latest", home, goBin)},
+			runner.commands,
+		)
+	})
+
+	t.Run("golang executors outside the target are ignored", func(t *testing.T) {
+		pathDir := buildDirectoryStructure(t, map[string]string{"go": "#!/bin/sh\n"})
+		require.NoError(t, os.Chmod(filepath.Join(pathDir, "go"), 0755))
+		t.Setenv("PATH", pathDir)
+
+		runner := &fakeRunner{}
+		conf := UserConfig{HomeDir: home, Target: "other", runner: runner}
+		g := &GoInstall{Package: "golang.org/x/tools/gopls", Gobin: "~/bin"}
+		_, err := g.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			[]string{fmt.Sprintf("env GOBIN=%v/bin %v install golang.org/x/tools/gopls@latest", home, filepath.Join(pathDir, "go"))},
+			runner.commands,
+		)
+	})
+
+	t.Run("compiler output is part of the error", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"env GOBIN": func(args []string) (string, string, error) {
+				return "", "main.go:4:2: undefined: foo", fmt.Errorf("exit status 1")
+			},
+		}}
+		conf := UserConfig{HomeDir: home, Target: "lab", runner: runner}
+		g := &GoInstall{Package: "example.com/broken", Gobin: "~/bin"}
+		_, err := g.Execute(context.Background(), conf, SyncOpts{}, godotConf)
+		require.ErrorContains(t, err, "undefined: foo")
+	})
+}
+
+func TestGoInstallValidate(t *testing.T) {
+	require.ErrorContains(t, (&GoInstall{}).Validate(), "package is required")
+	require.ErrorContains(t, (&GoInstall{Package: "mvdan.cc/gofumpt@latest"}).Validate(), "use version instead")
+	require.ErrorContains(t, (&GoInstall{Package: "mvdan.cc/gofumpt", Env: map[string]string{"A=B": "c"}}).Validate(), "invalid environment variable")
+	require.NoError(t, (&GoInstall{Package: "mvdan.cc/gofumpt", Env: map[string]string{"CGO_ENABLED": "0"}}).Validate())
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/mitchellh/mapstructure"
+	"github.com/samber/lo"
 	"gopkg.in/yaml.v2"
 )
 
@@ -35,9 +36,10 @@ func NewGodotConfigFromUserConfig(conf UserConfig) (GodotConfig, error) {
 }
 
 type GodotExecutor struct {
-	Name string
-	Type ExecutorType   `json:"type"`
-	Spec map[string]any `json:"spec"`
+	Name  string
+	Type  ExecutorType   `json:"type"`
+	Spec  map[string]any `json:"spec"`
+	Hooks Hooks          `json:"hooks"`
 }
 
 //nolint:ireturn
@@ -84,6 +86,33 @@ func (r *GodotExecutor) AsExecutor() (Executor, error) {
 	case ExecutorTypeNeovim:
 		var x Neovim
 		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeGitlabRelease:
+		var x GitlabRelease
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeGiteaRelease:
+		var x GiteaRelease
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypePackageRepo:
+		var x PackageRepo
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeCargoInstall:
+		var x CargoInstall
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypePipxInstall:
+		var x PipxInstall
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeNpmGlobal:
+		var x NpmGlobal
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeCommand:
+		var x Command
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeSystemdUserUnit:
+		var x SystemdUserUnit
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
+	case ExecutorTypeCron:
+		var x Cron
+		executor, err = decodeStructure(&x, r.Spec, r.Type.String())
 	default:
 		return nil, fmt.Errorf("programming error: unhandled executor type of '%v' with name '%v'", r.Type, r.Name)
 	}
@@ -122,12 +151,27 @@ func (r *GodotConfig) Validate() error {
 		if err := ex.Validate(); err != nil {
 			errors = multierror.Append(errors, fmt.Errorf("executor %v is invalid: %w", name, err))
 		}
+		if err := rawEx.Hooks.Validate(); err != nil {
+			errors = multierror.Append(errors, fmt.Errorf("executor %v has invalid hooks: %w", name, err))
+		}
 		// Bundles work a little differently
 		if rawEx.Type == ExecutorTypeBundle {
 			if err := r.validateBundle(name, ex); err != nil {
 				errors = multierror.Append(errors, err)
 			}
 		}
+		if pkg, ok := ex.(*SystemPackage); ok && pkg.Repo != "" {
+			if repo, ok := r.Executors[pkg.Repo]; !ok || repo.Type != ExecutorTypePackageRepo {
+				errors = multierror.Append(errors, fmt.Errorf("executor %v references unknown package-repo %v", name, pkg.Repo))
+			}
+		}
+		if cmd, ok := ex.(*Command); ok {
+			for _, tracked := range cmd.RunOnChangeOf {
+				if file, ok := r.Executors[tracked]; !ok || file.Type != ExecutorTypeConfigFile {
+					errors = multierror.Append(errors, fmt.Errorf("executor %v references unknown config-file %v", name, tracked))
+				}
+			}
+		}
 	}
 
 	return errors.ErrorOrNil()
@@ -158,7 +202,28 @@ func (r *GodotConfig) SetExecutorNames() {
 }
 
 func (r *GodotConfig) ExecutorsForTarget(name string) ([]Executor, error) {
-	return r.fetchExecutorsForSlice(r.Targets[name])
+	executors, err := r.fetchExecutorsForSlice(r.Targets[name])
+	if err != nil {
+		return nil, err
+	}
+	// System packages bring along the repos they're installed from, whether or not the target
+	// lists them
+	repos, err := r.fetchExecutorsForSlice(lo.Uniq(packageRepoNames(executors)))
+	if err != nil {
+		return nil, err
+	}
+	return applyOrdering(deduplicate(append(executors, repos...))), nil
+}
+
+// packageRepoNames are the package repos referenced by the system packages in executors
+func packageRepoNames(executors []Executor) []string {
+	names := []string{}
+	for _, ex := range executors {
+		if pkg, ok := ex.(*SystemPackage); ok && pkg.Repo != "" {
+			names = append(names, pkg.Repo)
+		}
+	}
+	return names
 }
 
 func (r *GodotConfig) fetchExecutorsForSlice(selection []string) ([]Executor, error) {
@@ -156,16 +156,17 @@ func TestAsExecutor(t *testing.T) {
 				},
 			},
 			&GithubRelease{
-				Name: "e1",
-				Repo: "http://some-repo.git",
-				Tag: "LATEST",
-				IsArchive: true,
-				Regex: "abcd",
-				AssetPatterns: map[string]map[string]string{
-					"darwin": {
-						"amd64": "mac-amd64-pattern",
+				releaseCommon: releaseCommon{
+					Name: "e1",
+					Tag: "LATEST",
+					Regex: "abcd",
+					AssetPatterns: map[string]map[string]string{
+						"darwin": {
+							"amd64": "mac-amd64-pattern",
+						},
 					},
 				},
+				Repo: "http://some-repo.git",
 			},
 		)
 	})
@@ -179,12 +180,26 @@ func TestAsExecutor(t *testing.T) {
 				Spec: map[string]any{
 					"apt": "apt-name",
 					"brew": "brew-name",
+					"pacman": "pacman-name",
+					"aur": "aur-name",
+					"nix": "nix-name",
+					"versions": map[string]any{
+						"apt": "1.2-3",
+					},
+					"hold": true,
 				},
 			},
 			&SystemPackage{
 				Name: "e1",
 				AptName: "apt-name",
 				BrewName: "brew-name",
+				PacmanName: "pacman-name",
+				AurName: "aur-name",
+				NixName: "nix-name",
+				Versions: map[string]string{
+					"apt": "1.2-3",
+				},
+				Hold: lo.ToPtr(true),
 			},
 		)
 	})
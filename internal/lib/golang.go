@@ -4,21 +4,61 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 )
 
 var _ Executor = (*Golang)(nil)
+var _ bundleExporter = (*Golang)(nil)
+var _ generationRecorder = (*Golang)(nil)
+
+const (
+	// defaultGoInstallDir is where go is installed, unless told otherwise
+	defaultGoInstallDir = "/usr/local/go"
+	// defaultGoBaseUrl serves both the release feed and the release downloads
+	defaultGoBaseUrl = "https://go.dev/dl/"
+)
+
+// goVersionRegex matches the accepted versions; latest, a specific version or a minor version
+// pattern like 1.23.x
+var goVersionRegex = regexp.MustCompile(`^(?i:latest)$|^(go)?[0-9]+(\.[0-9]+)*(\.x|(rc|beta)[0-9]+)?$`)
 
 type Golang struct {
-	Name    string         `yaml:"-"`
-	Version string         `yaml:"version" mapstructure:"version"`
-	log     zerolog.Logger `yaml:"-"`
+	Name           string         `yaml:"-"`
+	Version        string         `yaml:"version" mapstructure:"version"`
+	InstallDir     string         `yaml:"install-dir" mapstructure:"install-dir"`
+	BaseUrl        string         `yaml:"base-url" mapstructure:"base-url"`
+	Versioned      bool           `yaml:"versioned" mapstructure:"versioned"`
+	Toolchains     []string       `yaml:"toolchains" mapstructure:"toolchains"`
+	ToolchainLinks bool           `yaml:"toolchain-links" mapstructure:"toolchain-links"`
+	log            zerolog.Logger `yaml:"-"`
+	// installed is the default version left in place by the last sync, and links the symlinks it
+	// manages, for recording generations
+	installed string
+	links     []string
+}
+
+// goRelease is a single release from go.dev's release feed
+type goRelease struct {
+	Version string          `json:"version"`
+	Stable  bool            `json:"stable"`
+	Files   []goReleaseFile `json:"files"`
+}
+
+type goReleaseFile struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	Sha256   string `json:"sha256"`
+	Kind     string `json:"kind"`
 }
 
 func (g *Golang) SetLogger(log zerolog.Logger) {
@@ -42,68 +82,475 @@ func (g *Golang) Validate() error {
 
 	if g.Version == "" {
 		errs = multierror.Append(errs, fmt.Errorf("version is required"))
+	} else if !goVersionRegex.MatchString(g.Version) {
+		errs = multierror.Append(errs, fmt.Errorf("version must be latest, a version or a pattern like 1.23.x, got %v", g.Version))
+	}
+	if len(g.Toolchains) > 0 && !g.Versioned {
+		errs = multierror.Append(errs, fmt.Errorf("toolchains can only be installed when versioned"))
+	}
+	for _, toolchain := range g.Toolchains {
+		if !goVersionRegex.MatchString(toolchain) {
+			errs = multierror.Append(errs, fmt.Errorf("toolchains must be latest, a version or a pattern like 1.23.x, got %v", toolchain))
+		}
 	}
 
 	return errs.ErrorOrNil()
 }
 
-func (g *Golang) Execute(_ UserConfig, _ SyncOpts, _ GodotConfig) error {
-	if runtime.GOOS != "linux" {
-		return fmt.Errorf("golang installations only supported on linux")
+func (g *Golang) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
+	if runtime.GOOS == "windows" {
+		return false, fmt.Errorf("golang installations are not supported on windows")
 	}
 
-	g.log.Info().Str("version", g.Version).Msg("ensuring golang")
+	g.installed = ""
+	g.links = nil
+	installDir := g.installDir(conf)
+	if !g.Versioned {
+		version, installed, err := g.ensureVersion(ctx, conf, opts, g.Version, func(string) string { return installDir })
+		if err != nil || version == "" {
+			return false, err
+		}
+		g.installed = version
+		linked, err := g.linkToolchains(conf, opts, map[string]string{version: installDir})
+		return installed || linked, err
+	}
 
-	g.log.Debug().Msg("checking installed version")
-	out, _, err := runCmd("go", "version")
-	if err == nil && g.getVersionFromOutput(out) == g.Version {
-		g.log.Info().Msg("version already installed")
-		return nil
+	changed := false
+	toolchains := map[string]string{}
+	defaultVersion := ""
+	for _, version := range g.versions() {
+		resolved, installed, err := g.ensureVersion(ctx, conf, opts, version, func(v string) string { return g.toolchainDir(conf, v) })
+		if err != nil {
+			return false, err
+		}
+		if resolved == "" {
+			continue
+		}
+		changed = changed || installed
+		toolchains[resolved] = g.toolchainDir(conf, resolved)
+		if version == g.Version {
+			defaultVersion = resolved
+		}
+	}
+
+	if defaultVersion != "" {
+		moved, err := g.setDefault(ctx, conf, opts, defaultVersion)
+		if err != nil {
+			return false, fmt.Errorf("error setting default toolchain: %w", err)
+		}
+		changed = changed || moved
+		g.installed = defaultVersion
+		if dirWritable(installDir) {
+			g.links = append(g.links, g.defaultLink(conf))
+		}
 	}
+	linked, err := g.linkToolchains(conf, opts, toolchains)
+	return changed || linked, err
+}
 
-	g.log.Debug().Msg("removing existing installation")
-	// If we either don't have it, or it's the wrong version, make sure to clean out the old version
-	// first per the golang docs. Run this command through the shell so we can elivate privileges
-	_, _, err = runCmd("/bin/sh", "-c", "sudo rm -rf /usr/local/go")
+// versions are all the versions to install, the default version first
+func (g *Golang) versions() []string {
+	if !g.Versioned {
+		return []string{g.Version}
+	}
+	return lo.Uniq(append([]string{g.Version}, g.Toolchains...))
+}
+
+// ensureVersion makes sure version is installed into the directory given by dirFor, returning the
+// version it resolved to and whether it had to be installed. Nothing is returned if the install was
+// skipped
+func (g *Golang) ensureVersion(ctx context.Context, conf UserConfig, opts SyncOpts, version string, dirFor func(string) string) (string, bool, error) {
+	g.log.Info().Str("version", version).Msg("ensuring golang")
+
+	// Exact versions don't need the feed to know they're already installed
+	if exact := exactGoVersion(version); exact != "" && installedGoVersion(ctx, dirFor(exact)) == exact {
+		g.log.Info().Str("version", exact).Msg("version already installed")
+		return exact, false, nil
+	}
+
+	resolved, file, err := g.resolve(ctx, conf, version)
 	if err != nil {
-		return fmt.Errorf("error removing old golang installation: %w", err)
+		return "", false, fmt.Errorf("error resolving version: %w", err)
+	}
+	dir := dirFor(resolved)
+	if installedGoVersion(ctx, dir) == resolved {
+		g.log.Info().Str("version", resolved).Msg("version already installed")
+		return resolved, false, nil
+	}
+
+	// Installs into the home directory (or anywhere else we can write to) don't need root
+	parent := filepath.Dir(dir)
+	privileged := !dirWritable(parent)
+	if privileged && !conf.canEscalate() {
+		g.log.Warn().Str("install-dir", dir).Msg("skipping, privilege escalation is disabled")
+		return "", false, nil
+	}
+
+	tmp, err := os.MkdirTemp("", "godot-")
+	if err != nil {
+		return "", false, fmt.Errorf("unable to make temp directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	g.log.Debug().Str("version", resolved).Msg("downloading release tarball")
+	tarball := filepath.Join(tmp, file.Filename)
+	err = fetchToFile(ctx, newDownloadCache(conf), conf.downloadClient(), g.downloadUrl(file), resolved, tarball, nil, g.log)
+	if err != nil {
+		return "", false, fmt.Errorf("error downloading tarball: %w", err)
+	}
+	if err := verifySha256(tarball, file.Sha256); err != nil {
+		return "", false, fmt.Errorf("error verifying tarball: %w", err)
+	}
+
+	// Extract next to the existing installation and only then swap it into place, so an interrupted
+	// extraction doesn't leave a broken toolchain behind. The old version has to be removed rather
+	// than extracted over, per the golang docs
+	g.log.Debug().Str("install-dir", dir).Msg("extracting tarball")
+	staging := filepath.Join(parent, ".godot-go-"+resolved)
+	if privileged {
+		err = g.extractPrivileged(ctx, conf, opts.journal, tarball, staging, dir)
+	} else {
+		err = g.extract(opts.journal, tarball, staging, dir)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error unpacking tarball: %w", err)
+	}
+
+	return resolved, true, nil
+}
+
+// installedGoVersion is the version of the toolchain in dir, if there is one
+func installedGoVersion(ctx context.Context, dir string) string {
+	out, _, err := runCmd(ctx, filepath.Join(dir, "bin", "go"), "version")
+	if err != nil {
+		return ""
+	}
+	return getVersionFromOutput(out)
+}
+
+// toolchainDir is where a single version is installed, when versioned
+func (g *Golang) toolchainDir(conf UserConfig, version string) string {
+	return filepath.Join(g.installDir(conf), "go-"+version)
+}
+
+// defaultLink is the symlink to the default toolchain, when versioned. <default>/bin is what belongs
+// in the PATH
+func (g *Golang) defaultLink(conf UserConfig) string {
+	return filepath.Join(g.installDir(conf), "default")
+}
+
+// goBinary is the go binary this executor installs
+func (g *Golang) goBinary(conf UserConfig) string {
+	if g.Versioned {
+		return filepath.Join(g.defaultLink(conf), "bin", "go")
+	}
+	return filepath.Join(g.installDir(conf), "bin", "go")
+}
+
+// setDefault points the default symlink at version
+func (g *Golang) setDefault(ctx context.Context, conf UserConfig, opts SyncOpts, version string) (bool, error) {
+	link := g.defaultLink(conf)
+	// Relative, so the install directory can be moved or mounted elsewhere
+	target := "go-" + version
+	if current, err := os.Readlink(link); err == nil && current == target {
+		return false, nil
+	}
+	g.log.Info().Str("version", version).Msg("setting default toolchain")
+
+	if dirWritable(filepath.Dir(link)) {
+		return ensureSymlink(opts.journal, target, link)
+	}
+	previous, _ := os.Readlink(link)
+	if err := runEscalated(ctx, conf, "ln", "-sfn", target, link); err != nil {
+		return false, err
+	}
+	opts.journal.onRollback(func() error {
+		if previous == "" {
+			return runEscalated(context.Background(), conf, "rm", "-f", link)
+		}
+		return runEscalated(context.Background(), conf, "ln", "-sfn", previous, link)
+	})
+	return true, nil
+}
+
+// linkToolchains links a go1.X.Y binary into the binary directory for each toolchain, when asked to.
+// These are what GOTOOLCHAIN looks for in the PATH
+func (g *Golang) linkToolchains(conf UserConfig, opts SyncOpts, toolchains map[string]string) (bool, error) {
+	if !g.ToolchainLinks {
+		return false, nil
+	}
+	changed := false
+	for version, dir := range toolchains {
+		link := filepath.Join(conf.BinaryDir, "go"+version)
+		if err := ensureContainingDir(link); err != nil {
+			return false, err
+		}
+		linked, err := ensureSymlink(opts.journal, filepath.Join(dir, "bin", "go"), link)
+		if err != nil {
+			return false, fmt.Errorf("error linking toolchain %v: %w", version, err)
+		}
+		changed = changed || linked
+		g.links = append(g.links, link)
+	}
+	return changed, nil
+}
+
+// installDir is where go is installed, with the toolchain's bin directory under it
+func (g *Golang) installDir(conf UserConfig) string {
+	if g.InstallDir == "" {
+		return defaultGoInstallDir
+	}
+	return replaceTilde(g.InstallDir, conf.HomeDir)
+}
+
+// extract unpacks tarball into staging, then swaps it into installDir. The previous installation is
+// moved aside rather than removed, so a rolled back sync can put it back
+func (g *Golang) extract(j *journal, tarball string, staging string, installDir string) error {
+	if err := os.RemoveAll(staging); err != nil {
+		return err
 	}
+	defer os.RemoveAll(staging)
 
-	dir, err := os.MkdirTemp("", "godot-")
+	f, err := os.Open(tarball)
 	if err != nil {
-		return fmt.Errorf("unable to make temp directory")
+		return err
+	}
+	defer f.Close()
+	if err := untar(f, staging); err != nil {
+		return err
+	}
+
+	backup := staging + "-previous"
+	if err := os.RemoveAll(backup); err != nil {
+		return err
+	}
+	_, err = os.Lstat(installDir)
+	existed := err == nil
+	if existed {
+		if err := os.Rename(installDir, backup); err != nil {
+			return err
+		}
+	}
+	restore := func() error {
+		if err := os.RemoveAll(installDir); err != nil {
+			return err
+		}
+		if !existed {
+			return nil
+		}
+		return os.Rename(backup, installDir)
+	}
+
+	if err := os.Rename(filepath.Join(staging, "go"), installDir); err != nil {
+		return multierror.Append(err, restore()).ErrorOrNil()
+	}
+	j.onRollback(restore)
+	return j.onClose(func() error { return os.RemoveAll(backup) })
+}
+
+// extractPrivileged is extract, for install directories only root can write to
+func (g *Golang) extractPrivileged(ctx context.Context, conf UserConfig, j *journal, tarball string, staging string, installDir string) error {
+	backup := staging + "-previous"
+	_, err := os.Lstat(installDir)
+	existed := err == nil
+
+	steps := [][]string{
+		{"rm", "-rf", staging},
+		{"mkdir", "-p", staging},
+		{"tar", "-C", staging, "-xzf", tarball},
+		{"rm", "-rf", backup},
+	}
+	if existed {
+		steps = append(steps, []string{"mv", installDir, backup})
+	}
+	for _, step := range steps {
+		if err := runEscalated(ctx, conf, step...); err != nil {
+			_ = runEscalated(context.Background(), conf, "rm", "-rf", staging)
+			return err
+		}
+	}
+	restore := func() error {
+		if err := runEscalated(context.Background(), conf, "rm", "-rf", installDir); err != nil {
+			return err
+		}
+		if !existed {
+			return nil
+		}
+		return runEscalated(context.Background(), conf, "mv", backup, installDir)
 	}
-	defer os.RemoveAll(dir)
 
-	g.log.Debug().Msg("downloading release tarball")
-	filepath := path.Join(dir, g.getTarballName())
-	err = requests.
-		URL(fmt.Sprintf("https://go.dev/dl/%v", g.getTarballName())).
-		ToFile(filepath).
-		Fetch(context.Background())
+	err = runEscalated(ctx, conf, "mv", filepath.Join(staging, "go"), installDir)
+	_ = runEscalated(context.Background(), conf, "rm", "-rf", staging)
 	if err != nil {
-		return fmt.Errorf("error downloading tarball: %w", err)
+		return multierror.Append(err, restore()).ErrorOrNil()
 	}
+	j.onRollback(restore)
+	return j.onClose(func() error { return runEscalated(context.Background(), conf, "rm", "-rf", backup) })
+}
 
-	g.log.Debug().Msg("extracting tarball")
-	_, _, err = runCmd("/bin/sh", "-c", fmt.Sprintf("sudo tar -C /usr/local -xzf %v", filepath))
+// runEscalated runs the command given by args as root
+func runEscalated(ctx context.Context, conf UserConfig, args ...string) error {
+	bin, args := conf.escalate(args...)
+	if _, stderr, err := conf.commandRunner().Run(ctx, bin, args...); err != nil {
+		return fmt.Errorf("%w\n%v", err, stderr)
+	}
+	return nil
+}
+
+// dirWritable is true if dir can be written to by the current user, creating it if needs be
+func dirWritable(dir string) bool {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false
+	}
+	f, err := os.CreateTemp(dir, ".godot-")
 	if err != nil {
-		return fmt.Errorf("error unpacking tarball: %w", err)
+		return false
 	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
 
+// recordGeneration records the default version, and the symlinks to it & any other toolchains so that
+// rolling back re-points them. Unversioned installs are replaced in place, so there's nothing to
+// roll back to beyond what's recorded here
+func (g *Golang) recordGeneration(_ UserConfig, gen *Generation) error {
+	if g.installed == "" {
+		return nil
+	}
+	gen.Versions[g.Name] = g.installed
+	for _, link := range g.links {
+		if err := gen.addLink(link); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (g *Golang) getVersionFromOutput(out string) string {
-	parts := strings.Split(out, " ")
-	version := parts[2]
-	return version[2:]
+func (g *Golang) exportToBundle(ctx context.Context, conf UserConfig, _ GodotConfig, w *bundleWriter) error {
+	for _, version := range g.versions() {
+		resolved, file, err := g.resolve(ctx, conf, version)
+		if err != nil {
+			return fmt.Errorf("error resolving version: %w", err)
+		}
+		url := g.downloadUrl(file)
+		w.addRelease(g.bundleKey(version), resolved, release{
+			Name:        file.Filename,
+			DownloadUrl: url,
+			Url:         url,
+			Sha256:      file.Sha256,
+		})
+		if err := w.addDownload(ctx, url, resolved, file.Filename, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleKey is what the resolution of version is stored under in an offline bundle
+func (g *Golang) bundleKey(version string) string {
+	if version == g.Version {
+		return g.Name
+	}
+	return g.Name + "@" + version
 }
 
-func (g *Golang) getTarballName() string {
-	return fmt.Sprintf(
-		"go%v.linux-%v.tar.gz",
-		g.Version,
-		runtime.GOARCH,
-	)
+// exactGoVersion is the version to install, if it's known without consulting the release feed
+func exactGoVersion(version string) string {
+	if strings.EqualFold(version, "latest") || strings.HasSuffix(version, ".x") {
+		return ""
+	}
+	return strings.TrimPrefix(version, "go")
+}
+
+func (g *Golang) baseUrl() string {
+	if g.BaseUrl == "" {
+		return defaultGoBaseUrl
+	}
+	return strings.TrimSuffix(g.BaseUrl, "/") + "/"
+}
+
+func (g *Golang) downloadUrl(file goReleaseFile) string {
+	return g.baseUrl() + file.Filename
+}
+
+// resolve determines the concrete version to install and the file to install it from. When syncing
+// offline, the decision made at export time is used instead
+func (g *Golang) resolve(ctx context.Context, conf UserConfig, version string) (string, goReleaseFile, error) {
+	if conf.offline != nil {
+		resolved, asset, err := conf.offline.release(g.bundleKey(version))
+		if err != nil {
+			return "", goReleaseFile{}, err
+		}
+		return resolved, goReleaseFile{Filename: asset.Name, Sha256: asset.Sha256}, nil
+	}
+
+	var releases []goRelease
+	err := requests.
+		URL(g.baseUrl()).
+		Param("mode", "json").
+		Param("include", "all").
+		Client(conf.httpClient()).
+		ToJSON(&releases).
+		Fetch(ctx)
+	if err != nil {
+		return "", goReleaseFile{}, fmt.Errorf("error fetching release feed: %w", err)
+	}
+	return selectGoRelease(releases, version, runtime.GOOS, runtime.GOARCH)
+}
+
+// selectGoRelease picks the release matching version from the feed, and its archive for the given
+// platform. The feed lists the newest releases first
+func selectGoRelease(releases []goRelease, version string, goos string, goarch string) (string, goReleaseFile, error) {
+	var matches func(r goRelease) bool
+	switch {
+	case strings.EqualFold(version, "latest"):
+		matches = func(r goRelease) bool { return r.Stable }
+	case strings.HasSuffix(version, ".x"):
+		minor := "go" + strings.TrimPrefix(strings.TrimSuffix(version, ".x"), "go")
+		matches = func(r goRelease) bool {
+			return r.Stable && (r.Version == minor || strings.HasPrefix(r.Version, minor+"."))
+		}
+	default:
+		want := "go" + strings.TrimPrefix(version, "go")
+		matches = func(r goRelease) bool { return r.Version == want }
+	}
+
+	rel, ok := lo.Find(releases, matches)
+	if !ok {
+		return "", goReleaseFile{}, fmt.Errorf("no release matching %v", version)
+	}
+
+	// The feed names 32 bit arm after the only arm variant it publishes
+	arch := lo.Ternary(goarch == "arm", "armv6l", goarch)
+	file, ok := lo.Find(rel.Files, func(f goReleaseFile) bool {
+		return f.OS == goos && f.Arch == arch && f.Kind == "archive"
+	})
+	if !ok {
+		return "", goReleaseFile{}, fmt.Errorf("%v has no archive for %v/%v", rel.Version, goos, goarch)
+	}
+	return strings.TrimPrefix(rel.Version, "go"), file, nil
+}
+
+// verifySha256 checks the file at path against the expected checksum
+func verifySha256(path string, expected string) error {
+	if expected == "" {
+		return fmt.Errorf("no checksum to verify against")
+	}
+	sum, err := fileSha256(path)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, expected) {
+		return fmt.Errorf("checksum mismatch, expected %v but got %v", expected, sum)
+	}
+	return nil
+}
+
+func getVersionFromOutput(out string) string {
+	parts := strings.Split(out, " ")
+	if len(parts) < 3 {
+		return ""
+	}
+	return strings.TrimPrefix(parts[2], "go")
 }
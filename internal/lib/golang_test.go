@@ -0,0 +1,369 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGolangInstallDir(t *testing.T) {
+	conf := UserConfig{HomeDir: "/home/me"}
+	require.Equal(t, "/usr/local/go", (&Golang{}).installDir(conf))
+	require.Equal(t, "/home/me/.local/go", (&Golang{InstallDir: "~/.local/go"}).installDir(conf))
+	require.Equal(t, "/home/me/.local/go/go-1.23.4", (&Golang{InstallDir: "~/.local/go", Versioned: true}).toolchainDir(conf, "1.23.4"))
+}
+
+func TestGolangExtract(t *testing.T) {
+	tarball := buildTarGz(t, map[string]string{
+		"go/bin/go":  "new go",
+		"go/VERSION": "go1.23.4",
+	})
+
+	t.Run("user writable", func(t *testing.T) {
+		home := buildDirectoryStructure(t, map[string]string{
+			".local/go/bin/go":   "old go",
+			".local/go/leftover": "from the old version",
+		})
+		installDir := filepath.Join(home, ".local", "go")
+		staging := filepath.Join(home, ".local", ".godot-go-1.23.4")
+		require.True(t, dirWritable(filepath.Dir(installDir)))
+
+		require.NoError(t, (&Golang{Version: "1.23.4"}).extract(nil, tarball, staging, installDir))
+		requireContents(t, filepath.Join(installDir, "bin", "go"), "new go")
+		_, err := os.Stat(filepath.Join(installDir, "leftover"))
+		require.True(t, os.IsNotExist(err))
+		for _, leftover := range []string{staging, staging + "-previous"} {
+			_, err = os.Stat(leftover)
+			require.True(t, os.IsNotExist(err))
+		}
+	})
+
+	t.Run("rolled back with the sync", func(t *testing.T) {
+		home := buildDirectoryStructure(t, map[string]string{
+			".local/go/bin/go": "old go",
+		})
+		installDir := filepath.Join(home, ".local", "go")
+		staging := filepath.Join(home, ".local", ".godot-go-1.23.4")
+		fresh := filepath.Join(home, "fresh", "go")
+		require.NoError(t, os.MkdirAll(filepath.Dir(fresh), 0755))
+
+		j, err := newJournal(zerolog.Nop())
+		require.NoError(t, err)
+		require.NoError(t, (&Golang{Version: "1.23.4"}).extract(j, tarball, staging, installDir))
+		require.NoError(t, (&Golang{Version: "1.23.4"}).extract(j, tarball, filepath.Join(home, "fresh", ".godot-go-1.23.4"), fresh))
+		requireContents(t, filepath.Join(installDir, "bin", "go"), "new go")
+		requireContents(t, filepath.Join(fresh, "bin", "go"), "new go")
+
+		require.NoError(t, j.rollback())
+		require.NoError(t, j.close())
+		requireContents(t, filepath.Join(installDir, "bin", "go"), "old go")
+		_, err = os.Stat(fresh)
+		require.True(t, os.IsNotExist(err))
+		_, err = os.Stat(staging + "-previous")
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("privileged", func(t *testing.T) {
+		installDir := filepath.Join(t.TempDir(), "go")
+		require.NoError(t, os.Mkdir(installDir, 0755))
+		staging := filepath.Join(filepath.Dir(installDir), ".godot-go-1.23.4")
+		runner := &fakeRunner{}
+		conf := UserConfig{PrivilegeEscalation: PrivilegeEscalationDoas, runner: runner}
+		j, err := newJournal(zerolog.Nop())
+		require.NoError(t, err)
+
+		require.NoError(t, (&Golang{Version: "1.23.4"}).extractPrivileged(context.Background(), conf, j, tarball, staging, installDir))
+		require.Equal(t, []string{
+			"doas rm -rf " + staging,
+			"doas mkdir -p " + staging,
+			"doas tar -C " + staging + " -xzf " + tarball,
+			"doas rm -rf " + staging + "-previous",
+			"doas mv " + installDir + " " + staging + "-previous",
+			"doas mv " + staging + "/go " + installDir,
+			"doas rm -rf " + staging,
+		}, runner.commands)
+
+		runner.commands = nil
+		require.NoError(t, j.rollback())
+		require.NoError(t, j.close())
+		require.Equal(t, []string{
+			"doas rm -rf " + installDir,
+			"doas mv " + staging + "-previous " + installDir,
+			"doas rm -rf " + staging + "-previous",
+		}, runner.commands)
+	})
+}
+
+func testGoFeed(goos string, goarch string) []goRelease {
+	file := func(version string, os string, arch string) goReleaseFile {
+		return goReleaseFile{
+			Filename: fmt.Sprintf("%v.%v-%v.tar.gz", version, os, arch),
+			OS:       os,
+			Arch:     arch,
+			Version:  version,
+			Kind:     "archive",
+		}
+	}
+	release := func(version string, stable bool) goRelease {
+		return goRelease{
+			Version: version,
+			Stable:  stable,
+			Files: []goReleaseFile{
+				{Filename: version + ".src.tar.gz", Version: version, Kind: "source"},
+				file(version, goos, goarch),
+				file(version, "windows", "amd64"),
+			},
+		}
+	}
+	return []goRelease{
+		release("go1.24rc1", false),
+		release("go1.23.4", true),
+		release("go1.23.3", true),
+		release("go1.22.10", true),
+		release("go1.2", true),
+	}
+}
+
+func TestSelectGoRelease(t *testing.T) {
+	feed := testGoFeed("darwin", "arm64")
+
+	testData := []struct {
+		version string
+		want    string
+		err     string
+	}{
+		{version: "latest", want: "1.23.4"},
+		{version: "LATEST", want: "1.23.4"},
+		{version: "1.23.x", want: "1.23.4"},
+		{version: "1.22.x", want: "1.22.10"},
+		{version: "1.2.x", want: "1.2"},
+		{version: "1.23.3", want: "1.23.3"},
+		{version: "go1.23.3", want: "1.23.3"},
+		{version: "1.24rc1", want: "1.24rc1"},
+		{version: "1.21.x", err: "no release matching 1.21.x"},
+		{version: "1.23.5", err: "no release matching 1.23.5"},
+	}
+	for _, tc := range testData {
+		t.Run(tc.version, func(t *testing.T) {
+			version, file, err := selectGoRelease(feed, tc.version, "darwin", "arm64")
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, version)
+			require.Equal(t, fmt.Sprintf("go%v.darwin-arm64.tar.gz", tc.want), file.Filename)
+		})
+	}
+
+	t.Run("missing platform", func(t *testing.T) {
+		_, _, err := selectGoRelease(feed, "latest", "linux", "arm")
+		require.ErrorContains(t, err, "go1.23.4 has no archive for linux/arm")
+	})
+}
+
+// testGoBinary is a stand in for the go binary of a toolchain, that reports its version
+func testGoBinary(version string) string {
+	return fmt.Sprintf("#!/bin/sh\necho go version go%v %v/%v\n", version, runtime.GOOS, runtime.GOARCH)
+}
+
+// goReleaseServer serves the test feed and a tarball for every release in it, recording the requests
+// made to it
+type goReleaseServer struct {
+	*httptest.Server
+	feed      []goRelease
+	requested []string
+}
+
+func newGoReleaseServer(t *testing.T) *goReleaseServer {
+	t.Helper()
+
+	tarballs := map[string]string{}
+	feed := testGoFeed(runtime.GOOS, runtime.GOARCH)
+	for i, rel := range feed {
+		version := strings.TrimPrefix(rel.Version, "go")
+		for j, file := range rel.Files {
+			if file.OS != runtime.GOOS {
+				continue
+			}
+			tarball := buildTarGz(t, map[string]string{"go/bin/go": testGoBinary(version)})
+			sum, err := fileSha256(tarball)
+			require.NoError(t, err)
+			feed[i].Files[j].Sha256 = sum
+			tarballs["/"+file.Filename] = tarball
+		}
+	}
+
+	srv := &goReleaseServer{feed: feed}
+	srv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		srv.requested = append(srv.requested, r.URL.RequestURI())
+		if r.URL.Path == "/" {
+			require.Equal(t, "json", r.URL.Query().Get("mode"))
+			require.Equal(t, "all", r.URL.Query().Get("include"))
+			require.NoError(t, json.NewEncoder(w).Encode(srv.feed))
+			return
+		}
+		tarball, ok := tarballs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeFile(w, r, tarball)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGolangExecute(t *testing.T) {
+	srv := newGoReleaseServer(t)
+	goBinary := testGoBinary
+	feed := srv.feed
+
+	home := t.TempDir()
+	conf := UserConfig{HomeDir: home}
+	installed := filepath.Join(home, ".local", "go", "bin", "go")
+	golang := func(version string) *Golang {
+		g := &Golang{Version: version, InstallDir: "~/.local/go", BaseUrl: srv.URL}
+		g.SetLogger(zerolog.Nop())
+		return g
+	}
+
+	_, err := golang("1.22.x").Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	requireContents(t, installed, goBinary("1.22.10"))
+
+	t.Run("exact versions that are installed don't need the feed", func(t *testing.T) {
+		srv.requested = nil
+		_, err := golang("1.22.10").Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Empty(t, srv.requested)
+	})
+
+	t.Run("upgrades to latest", func(t *testing.T) {
+		_, err := golang("latest").Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		requireContents(t, installed, goBinary("1.23.4"))
+
+		srv.requested = nil
+		_, err = golang("latest").Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Equal(t, []string{"/?include=all&mode=json"}, srv.requested)
+	})
+
+	t.Run("checksums are verified", func(t *testing.T) {
+		for i := range feed[2].Files {
+			feed[2].Files[i].Sha256 = "0000"
+		}
+		_, err := golang("1.23.3").Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.ErrorContains(t, err, "checksum mismatch")
+		requireContents(t, installed, goBinary("1.23.4"))
+	})
+}
+
+func TestGolangVersioned(t *testing.T) {
+	srv := newGoReleaseServer(t)
+	home := t.TempDir()
+	conf := UserConfig{HomeDir: home, BinaryDir: filepath.Join(home, "bin")}
+	installDir := filepath.Join(home, ".local", "go")
+
+	g := &Golang{
+		Version:        "1.23.x",
+		InstallDir:     "~/.local/go",
+		BaseUrl:        srv.URL,
+		Versioned:      true,
+		Toolchains:     []string{"1.22.10", "1.23.3"},
+		ToolchainLinks: true,
+	}
+	g.SetLogger(zerolog.Nop())
+	changed, err := g.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	for _, version := range []string{"1.23.4", "1.22.10", "1.23.3"} {
+		requireContents(t, filepath.Join(installDir, "go-"+version, "bin", "go"), testGoBinary(version))
+		target, err := os.Readlink(filepath.Join(home, "bin", "go"+version))
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(installDir, "go-"+version, "bin", "go"), target)
+	}
+	target, err := os.Readlink(filepath.Join(installDir, "default"))
+	require.NoError(t, err)
+	require.Equal(t, "go-1.23.4", target)
+	requireContents(t, filepath.Join(installDir, "default", "bin", "go"), testGoBinary("1.23.4"))
+
+	t.Run("nothing changes when up to date", func(t *testing.T) {
+		changed, err := g.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+	})
+
+	t.Run("switching the default keeps the other toolchains", func(t *testing.T) {
+		g.Version = "1.22.10"
+		g.Toolchains = nil
+		changed, err := g.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.True(t, changed)
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(installDir, "default", "bin", "go"), testGoBinary("1.22.10"))
+		requireContents(t, filepath.Join(installDir, "go-1.23.4", "bin", "go"), testGoBinary("1.23.4"))
+	})
+
+	t.Run("rolled back with the sync", func(t *testing.T) {
+		j, err := newJournal(zerolog.Nop())
+		require.NoError(t, err)
+		defer j.close()
+
+		g.Version = "1.23.3"
+		_, err = g.Execute(context.Background(), conf, SyncOpts{journal: j}, GodotConfig{})
+		require.NoError(t, err)
+		requireContents(t, filepath.Join(installDir, "default", "bin", "go"), testGoBinary("1.23.3"))
+		require.NoError(t, j.rollback())
+		requireContents(t, filepath.Join(installDir, "default", "bin", "go"), testGoBinary("1.22.10"))
+	})
+
+	t.Run("recorded in generations", func(t *testing.T) {
+		conf := conf
+		conf.BuildLocation = t.TempDir()
+		g.Name = "go"
+		sync := func(version string) {
+			t.Helper()
+			g.Version = version
+			g.Toolchains = []string{"1.23.3"}
+			_, err := g.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+			require.NoError(t, recordGeneration(conf, []Executor{g}, []Executor{g}, zerolog.Nop()))
+		}
+
+		sync("1.22.10")
+		sync("1.23.4")
+		generations, err := listGenerations(newGenerationStore(conf))
+		require.NoError(t, err)
+		require.Len(t, generations, 2)
+		require.Equal(t, "1.22.10", generations[0].Versions[g.Name])
+		require.Equal(t, "go-1.22.10", generations[0].Links[filepath.Join(installDir, "default")])
+		require.Contains(t, generations[0].Links, filepath.Join(home, "bin", "go1.23.3"))
+		require.Equal(t, "1.23.4", generations[1].Versions[g.Name])
+
+		require.NoError(t, rollbackTo(conf, 0, zerolog.Nop()))
+		requireContents(t, filepath.Join(installDir, "default", "bin", "go"), testGoBinary("1.22.10"))
+	})
+}
+
+func TestGolangValidate(t *testing.T) {
+	for _, version := range []string{"latest", "1.23.x", "1.23.4", "go1.23.4", "1.24rc1"} {
+		require.NoError(t, (&Golang{Version: version}).Validate(), version)
+	}
+	for _, version := range []string{"", "1.23.*", "stable", "1.x.4"} {
+		require.Error(t, (&Golang{Version: version}).Validate(), version)
+	}
+	require.ErrorContains(t, (&Golang{Version: "latest", Toolchains: []string{"1.22.x"}}).Validate(), "only be installed when versioned")
+	require.ErrorContains(t, (&Golang{Version: "latest", Versioned: true, Toolchains: []string{"oldstable"}}).Validate(), "got oldstable")
+}
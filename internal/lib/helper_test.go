@@ -1,6 +1,8 @@
 package lib
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"os"
 	"path/filepath"
 	"strings"
@@ -43,3 +45,30 @@ func cleanFuncsMap(t *testing.T) {
 	delete(funcs, funcNameVaultLookup)
 }
 
+// buildTarGz writes a gzipped tarball containing the given files, all marked executable
+func buildTarGz(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	out := filepath.Join(t.TempDir(), "archive.tar.gz")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	defer f.Close()
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:     name,
+			Mode:     0755,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	return out
+}
@@ -0,0 +1,135 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+// defaultHookTimeout bounds each hook when neither the hooks nor their command executor set a timeout
+const defaultHookTimeout = 10 * time.Minute
+
+// Hooks are shell commands run around an executor during a sync. On change hooks only run when the
+// executor actually changed something
+type Hooks struct {
+	Pre      []string `yaml:"pre" json:"pre"`
+	Post     []string `yaml:"post" json:"post"`
+	OnChange []string `yaml:"on-change" json:"on-change"`
+	Timeout  string   `yaml:"timeout" json:"timeout"`
+}
+
+func (h Hooks) Validate() error {
+	var errs *multierror.Error
+
+	stages := []struct {
+		name  string
+		hooks []string
+	}{
+		{name: "pre", hooks: h.Pre},
+		{name: "post", hooks: h.Post},
+		{name: "on-change", hooks: h.OnChange},
+	}
+	for _, stage := range stages {
+		for _, hook := range stage.hooks {
+			if strings.TrimSpace(hook) == "" {
+				errs = multierror.Append(errs, fmt.Errorf("%v hooks cannot be empty", stage.name))
+			}
+		}
+	}
+	if _, err := parseDurationOr(h.Timeout, 0, "timeout"); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// hookCommand is the command each of an executor's hooks is run as. Hooks of command executors
+// share their dir & env, and their timeout unless the hooks set their own
+func hookCommand(godotConf GodotConfig, name string) (Command, error) {
+	rawEx := godotConf.Executors[name]
+	cmd := Command{Timeout: rawEx.Hooks.Timeout}
+	if rawEx.Type == ExecutorTypeCommand && rawEx.Spec != nil {
+		ex, err := rawEx.AsExecutor()
+		if err != nil {
+			return Command{}, fmt.Errorf("error with executor %v: %w", name, err)
+		}
+		if c, ok := ex.(*Command); ok {
+			cmd.Dir = c.Dir
+			cmd.Env = c.Env
+			if cmd.Timeout == "" {
+				cmd.Timeout = c.Timeout
+			}
+		}
+	}
+	if cmd.Timeout == "" {
+		cmd.Timeout = defaultHookTimeout.String()
+	}
+	return cmd, nil
+}
+
+// executorGroup is implemented by executors that run several configured executors at once, so that
+// each of their hooks still runs
+type executorGroup interface {
+	members() []string
+	memberChanged(name string) bool
+}
+
+// executeWithHooks runs ex, surrounded by the hooks configured for it
+func executeWithHooks(ctx context.Context, ex Executor, conf UserConfig, opts SyncOpts, godotConf GodotConfig, logger zerolog.Logger) error {
+	names := []string{ex.GetName()}
+	var changed bool
+	memberChanged := func(string) bool { return changed }
+	if group, ok := ex.(executorGroup); ok {
+		names = group.members()
+		memberChanged = group.memberChanged
+	}
+
+	hookCmds := make(map[string]Command, len(names))
+	for _, name := range names {
+		cmd, err := hookCommand(godotConf, name)
+		if err != nil {
+			return err
+		}
+		hookCmds[name] = cmd
+	}
+
+	for _, name := range names {
+		if err := runHooks(ctx, conf, opts, hookCmds[name], name, "pre", godotConf.Executors[name].Hooks.Pre, logger); err != nil {
+			return err
+		}
+	}
+
+	changed, err := ex.Execute(ctx, conf, opts, godotConf)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		hooks := godotConf.Executors[name].Hooks
+		if memberChanged(name) {
+			if err := runHooks(ctx, conf, opts, hookCmds[name], name, "on-change", hooks.OnChange, logger); err != nil {
+				return err
+			}
+		}
+		if err := runHooks(ctx, conf, opts, hookCmds[name], name, "post", hooks.Post, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runHooks runs each hook in turn as an inline command based on base, stopping at the first failure
+func runHooks(ctx context.Context, conf UserConfig, opts SyncOpts, base Command, name string, stage string, hooks []string, logger zerolog.Logger) error {
+	for _, hook := range hooks {
+		cmd := &Command{Name: name + "-" + stage, Run: hook, Dir: base.Dir, Env: base.Env, Timeout: base.Timeout}
+		cmd.SetLogger(logger.With().Str("name", name).Str("hook", stage).Logger())
+		if _, err := cmd.Execute(ctx, conf, opts, GodotConfig{}); err != nil {
+			return fmt.Errorf("error running %v hook: %w", stage, err)
+		}
+	}
+	return nil
+}
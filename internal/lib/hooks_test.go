@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecuteWithHooks(t *testing.T) {
+	home := t.TempDir()
+	conf := UserConfig{HomeDir: home}
+	log := filepath.Join(home, "hooks")
+	marker := filepath.Join(home, "marker")
+
+	// The command only changes anything the first time, when it creates the marker
+	cmd := &Command{Name: "setup", Run: "echo setup >> " + log + "; touch " + marker, Creates: marker}
+	godotConf := GodotConfig{Executors: map[string]GodotExecutor{
+		"setup": {Name: "setup", Type: ExecutorTypeCommand, Hooks: Hooks{
+			Pre:      []string{"echo pre >> " + log},
+			Post:     []string{"echo post >> " + log},
+			OnChange: []string{"echo on-change >> " + log},
+		}},
+	}}
+	ran := func(t *testing.T) []string {
+		t.Helper()
+		b, err := os.ReadFile(log)
+		require.NoError(t, err)
+		require.NoError(t, os.Remove(log))
+		return strings.Fields(string(b))
+	}
+
+	require.NoError(t, executeWithHooks(context.Background(), cmd, conf, SyncOpts{}, godotConf, zerolog.Nop()))
+	require.Equal(t, []string{"pre", "setup", "on-change", "post"}, ran(t))
+
+	require.NoError(t, executeWithHooks(context.Background(), cmd, conf, SyncOpts{}, godotConf, zerolog.Nop()))
+	require.Equal(t, []string{"pre", "post"}, ran(t))
+
+	t.Run("failing pre hooks stop the executor", func(t *testing.T) {
+		require.NoError(t, os.Remove(marker))
+		failing := godotConf.Executors["setup"]
+		failing.Hooks = Hooks{Pre: []string{"exit 1"}}
+		conf := GodotConfig{Executors: map[string]GodotExecutor{"setup": failing}}
+		err := executeWithHooks(context.Background(), cmd, UserConfig{HomeDir: home}, SyncOpts{}, conf, zerolog.Nop())
+		require.ErrorContains(t, err, "error running pre hook")
+		_, err = os.Stat(marker)
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestExecuteWithHooksBatch(t *testing.T) {
+	home := t.TempDir()
+	log := filepath.Join(home, "hooks")
+	runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+		"brew list": func(args []string) (string, string, error) {
+			return "git 2.45.0\n", "", nil
+		},
+	}}
+	conf := UserConfig{HomeDir: home, PackageManager: PackageManagerBrew, runner: runner}
+	godotConf := GodotConfig{Executors: map[string]GodotExecutor{
+		"git": {Name: "git", Type: ExecutorTypeSysPackage, Hooks: Hooks{
+			OnChange: []string{"echo git >> " + log},
+		}},
+		"fd": {Name: "fd", Type: ExecutorTypeSysPackage, Hooks: Hooks{
+			OnChange: []string{"echo fd >> " + log},
+		}},
+	}}
+	batch := newSystemPackageBatch([]*SystemPackage{{Name: "git", BrewName: "git"}, {Name: "fd", BrewName: "fd"}})
+	batch.SetLogger(zerolog.Nop())
+
+	require.NoError(t, executeWithHooks(context.Background(), batch, conf, SyncOpts{}, godotConf, zerolog.Nop()))
+	requireContents(t, log, "fd\n")
+}
+
+func TestHooksValidate(t *testing.T) {
+	require.NoError(t, Hooks{Pre: []string{"true"}, Timeout: "30s"}.Validate())
+	require.ErrorContains(t, Hooks{OnChange: []string{" "}}.Validate(), "on-change hooks cannot be empty")
+	require.ErrorContains(t, Hooks{Timeout: "soon"}.Validate(), `invalid timeout "soon"`)
+
+	t.Run("stages are reported in a fixed order", func(t *testing.T) {
+		hooks := Hooks{Pre: []string{""}, Post: []string{""}, OnChange: []string{""}}
+		for i := 0; i < 10; i++ {
+			errs := strings.Split(hooks.Validate().Error(), "\n")
+			require.Equal(t, []string{"pre hooks cannot be empty", "post hooks cannot be empty", "on-change hooks cannot be empty"}, lo.Filter(
+				lo.Map(errs, func(e string, _ int) string { return strings.TrimPrefix(strings.TrimSpace(e), "* ") }),
+				func(e string, _ int) bool { return strings.HasSuffix(e, "cannot be empty") },
+			))
+		}
+	})
+}
+
+func TestExecuteWithHooksTimeout(t *testing.T) {
+	home := t.TempDir()
+	conf := UserConfig{HomeDir: home}
+
+	t.Run("hung hooks are stopped", func(t *testing.T) {
+		cmd := &Command{Name: "setup", Run: "true"}
+		cmd.SetLogger(zerolog.Nop())
+		godotConf := GodotConfig{Executors: map[string]GodotExecutor{
+			"setup": {Name: "setup", Type: ExecutorTypeCommand, Hooks: Hooks{
+				Post:    []string{"exec sleep 5"},
+				Timeout: "50ms",
+			}},
+		}}
+		err := executeWithHooks(context.Background(), cmd, conf, SyncOpts{}, godotConf, zerolog.Nop())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("hooks of commands share their dir, env & timeout", func(t *testing.T) {
+		dir := filepath.Join(home, "work")
+		require.NoError(t, os.Mkdir(dir, 0755))
+		cmd := &Command{Name: "setup", Run: "true"}
+		cmd.SetLogger(zerolog.Nop())
+		godotConf := GodotConfig{Executors: map[string]GodotExecutor{
+			"setup": {
+				Name: "setup",
+				Type: ExecutorTypeCommand,
+				Spec: map[string]any{"run": "true", "dir": dir, "env": map[string]any{"GREETING": "hi"}, "timeout": "500ms"},
+				Hooks: Hooks{
+					Pre:  []string{"echo $GREETING > greeting"},
+					Post: []string{"exec sleep 5"},
+				},
+			},
+		}}
+		err := executeWithHooks(context.Background(), cmd, conf, SyncOpts{}, godotConf, zerolog.Nop())
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		requireContents(t, filepath.Join(dir, "greeting"), "hi\n")
+	})
+
+	t.Run("hooks default to a timeout", func(t *testing.T) {
+		cmd, err := hookCommand(GodotConfig{Executors: map[string]GodotExecutor{
+			"fd": {Name: "fd", Type: ExecutorTypeSysPackage},
+		}}, "fd")
+		require.NoError(t, err)
+		require.Equal(t, defaultHookTimeout.String(), cmd.Timeout)
+	})
+}
+
+func TestHooksFromConfig(t *testing.T) {
+	dir := buildDirectoryStructure(t, map[string]string{
+		"config.yaml": `executors:
+  tmux-conf:
+    type: config-file
+    spec:
+      template-name: tmux.conf
+      destination: ~/.tmux.conf
+    hooks:
+      pre:
+        - mkdir -p ~/.config
+      on-change:
+        - tmux source-file ~/.tmux.conf
+targets:
+  lab:
+    - tmux-conf
+`,
+	})
+	conf, err := NewGodotConfig(filepath.Join(dir, "config.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, Hooks{
+		Pre:      []string{"mkdir -p ~/.config"},
+		OnChange: []string{"tmux source-file ~/.tmux.conf"},
+	}, conf.Executors["tmux-conf"].Hooks)
+}
@@ -0,0 +1,368 @@
+package lib
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultHttpTimeout      = 30 * time.Second
+	defaultApiTimeout       = 2 * time.Minute
+	defaultDownloadTimeout  = 30 * time.Minute
+	defaultHttpRetries      = 3
+	defaultMaxRateLimitWait = 5 * time.Minute
+	defaultRetryBackoff     = time.Second
+	maxRetryBackoff         = 30 * time.Second
+	maxRedirects            = 10
+)
+
+// HttpConfig controls how godot talks to the network
+type HttpConfig struct {
+	Timeout          string `yaml:"timeout"`
+	ApiTimeout       string `yaml:"api-timeout"`
+	DownloadTimeout  string `yaml:"download-timeout"`
+	Retries          *int   `yaml:"retries"`
+	MaxRateLimitWait string `yaml:"max-rate-limit-wait"`
+	Proxy            string `yaml:"proxy"`
+	CACert           string `yaml:"ca-cert"`
+}
+
+var (
+	defaultClientOnce     sync.Once
+	defaultClient         *http.Client
+	defaultDownloadClient *http.Client
+
+	// tokenHeaders carry forge credentials outside of the standard Authorization header
+	tokenHeaders = []string{"PRIVATE-TOKEN"}
+)
+
+// httpClient returns the client API requests should be made through, each of which is expected to
+// finish quickly
+func (u UserConfig) httpClient() *http.Client {
+	if u.client != nil {
+		return u.client
+	}
+	buildDefaultClients()
+	return defaultClient
+}
+
+// downloadClient returns the client downloads & clones should be made through, which are given far
+// longer to finish
+func (u UserConfig) downloadClient() *http.Client {
+	if u.downloads != nil {
+		return u.downloads
+	}
+	if u.client != nil {
+		return u.client
+	}
+	buildDefaultClients()
+	return defaultDownloadClient
+}
+
+func buildDefaultClients() {
+	defaultClientOnce.Do(func() {
+		// The zero config can't fail to build
+		defaultClient, defaultDownloadClient, _ = newHttpClient(HttpConfig{}, "")
+	})
+}
+
+func parseDurationOr(s string, def time.Duration, name string) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %v %q: %w", name, s, err)
+	}
+	return d, nil
+}
+
+// newHttpClient builds the API & download clients from the user's http settings. Timeouts apply to
+// establishing a connection & waiting for a response, while the api & download timeouts bound each
+// attempt at a request made through the respective client, including reading its body
+//
+//nolint:gocyclo
+func newHttpClient(conf HttpConfig, home string) (*http.Client, *http.Client, error) {
+	timeout, err := parseDurationOr(conf.Timeout, defaultHttpTimeout, "timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	apiTimeout, err := parseDurationOr(conf.ApiTimeout, defaultApiTimeout, "api-timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	downloadTimeout, err := parseDurationOr(conf.DownloadTimeout, defaultDownloadTimeout, "download-timeout")
+	if err != nil {
+		return nil, nil, err
+	}
+	maxWait, err := parseDurationOr(conf.MaxRateLimitWait, defaultMaxRateLimitWait, "max-rate-limit-wait")
+	if err != nil {
+		return nil, nil, err
+	}
+	retries := defaultHttpRetries
+	if conf.Retries != nil {
+		retries = *conf.Retries
+	}
+	if retries < 0 {
+		return nil, nil, fmt.Errorf("retries cannot be negative")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+
+	if conf.Proxy != "" {
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid proxy %q: %w", conf.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	if conf.CACert != "" {
+		pool, err := certPool(replaceTilde(conf.CACert, home))
+		if err != nil {
+			return nil, nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    pool,
+		}
+	}
+
+	clientFor := func(timeout time.Duration) *http.Client {
+		return &http.Client{
+			CheckRedirect: checkRedirect,
+			Transport: &retryTransport{
+				base:    transport,
+				retries: retries,
+				backoff: defaultRetryBackoff,
+				maxWait: maxWait,
+				timeout: timeout,
+			},
+		}
+	}
+	return clientFor(apiTimeout), clientFor(downloadTimeout), nil
+}
+
+// checkRedirect follows the same redirect limit as net/http, while also dropping the token headers
+// that net/http doesn't know are sensitive when the redirect leaves the original host
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %v redirects", maxRedirects)
+	}
+	if req.URL.Host != via[0].URL.Host {
+		for _, header := range tokenHeaders {
+			req.Header.Del(header)
+		}
+	}
+	return nil
+}
+
+// certPool returns the system roots plus the certificates in the given PEM file
+func certPool(path string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ca-cert: %w", err)
+	}
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no certificates found in ca-cert %v", path)
+	}
+	return pool, nil
+}
+
+// useHttpClientForGit routes go-git's http(s) traffic through the same client, so proxy & CA
+// settings apply to cloning as well
+func useHttpClientForGit(c *http.Client) {
+	client.InstallProtocol("https", githttp.NewClient(c))
+	client.InstallProtocol("http", githttp.NewClient(c))
+}
+
+// retryTransport retries idempotent requests that fail in a way that's likely to be transient, and
+// waits out rate limits that will reset soon enough
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+	maxWait time.Duration
+	// timeout, if set, bounds each attempt at a request until its body is closed. Waiting between
+	// attempts doesn't count towards it
+	timeout time.Duration
+}
+
+func (r *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return r.attempt(req)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := r.attempt(req)
+
+		wait, retry, waitErr := r.retryAfter(resp, err, attempt)
+		if waitErr != nil {
+			resp.Body.Close()
+			return nil, waitErr
+		}
+		if !retry {
+			return resp, err
+		}
+		if attempt >= r.retries {
+			if err != nil || resp == nil {
+				return resp, err
+			}
+			if wait, limited := rateLimitReset(resp); limited {
+				resp.Body.Close()
+				return nil, fmt.Errorf("rate limited by %v, resets in %v", req.URL.Host, wait.Round(time.Second))
+			}
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		log.Warn().Str("url", req.URL.Redacted()).Dur("wait", wait).Int("attempt", attempt+1).Msg("request failed, retrying")
+		if err := sleepContext(req.Context(), wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// attempt makes a single attempt at req, bounded by the timeout
+func (r *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if r.timeout <= 0 {
+		return r.base.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+	resp, err := r.base.RoundTrip(req.WithContext(ctx))
+	if err != nil || resp == nil {
+		cancel()
+		return resp, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the context of an attempt once its body has been read
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
+
+// retryAfter decides if a request should be retried, and how long to wait before doing so
+func (r *retryTransport) retryAfter(resp *http.Response, err error, attempt int) (time.Duration, bool, error) {
+	if err != nil {
+		// Our own cancellation isn't something to retry
+		if errors.Is(err, context.Canceled) {
+			return 0, false, nil
+		}
+		return r.backoffFor(attempt), true, nil
+	}
+
+	if wait, limited := rateLimitReset(resp); limited {
+		if wait > r.maxWait {
+			return 0, false, fmt.Errorf("rate limited by %v, resets in %v which is longer than max-rate-limit-wait of %v", resp.Request.URL.Host, wait.Round(time.Second), r.maxWait)
+		}
+		return wait, true, nil
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+	default:
+		return 0, false, nil
+	}
+
+	if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		if wait > r.maxWait {
+			return 0, false, fmt.Errorf("%v asked to retry in %v which is longer than max-rate-limit-wait of %v", resp.Request.URL.Host, wait, r.maxWait)
+		}
+		return wait, true, nil
+	}
+	return r.backoffFor(attempt), true, nil
+}
+
+// backoffFor returns an exponential backoff with jitter for the given attempt
+func (r *retryTransport) backoffFor(attempt int) time.Duration {
+	wait := r.backoff << attempt
+	if wait > maxRetryBackoff || wait <= 0 {
+		wait = maxRetryBackoff
+	}
+	//nolint:gosec
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// rateLimitReset detects GitHub style rate limiting, returning how long until the limit resets
+func rateLimitReset(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return 0, false
+	}
+	reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	wait := time.Until(time.Unix(reset, 0))
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, true
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or a date
+func parseRetryAfter(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(s); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(s); err == nil {
+		wait := time.Until(t)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,227 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/stretchr/testify/require"
+)
+
+// roundTripFunc lets a plain function stand in for a transport
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryTransport(t *testing.T) {
+	newClient := func(retries int, maxWait time.Duration) *http.Client {
+		return &http.Client{
+			Transport: &retryTransport{
+				base:    http.DefaultTransport,
+				retries: retries,
+				backoff: time.Millisecond,
+				maxWait: maxWait,
+			},
+		}
+	}
+
+	// failing responds with the given handler for the first n requests, then succeeds
+	failing := func(n int, fail http.HandlerFunc) (*httptest.Server, *int) {
+		calls := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls <= n {
+				fail(w, r)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		t.Cleanup(srv.Close)
+		return srv, &calls
+	}
+
+	fetch := func(client *http.Client, url string, method string) (string, error) {
+		var body string
+		err := requests.URL(url).Method(method).Client(client).ToString(&body).Fetch(context.Background())
+		return body, err
+	}
+
+	t.Run("transient failures are retried", func(t *testing.T) {
+		srv, calls := failing(2, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		body, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "ok", body)
+		require.Equal(t, 3, *calls)
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		srv, calls := failing(10, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+		_, err := fetch(newClient(2, time.Minute), srv.URL, http.MethodGet)
+		require.Error(t, err)
+		require.True(t, requests.HasStatusErr(err, http.StatusServiceUnavailable))
+		require.Equal(t, 3, *calls)
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		})
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.Error(t, err)
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("non idempotent requests are not retried", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodPost)
+		require.Error(t, err)
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("retry after is respected", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+		start := time.Now()
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, 2, *calls)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+	})
+
+	t.Run("rate limits that reset soon are waited out", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Unix()))
+			w.WriteHeader(http.StatusForbidden)
+		})
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("rate limits that reset too late are reported", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", fmt.Sprint(time.Now().Add(time.Hour).Unix()))
+			w.WriteHeader(http.StatusForbidden)
+		})
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "rate limited by")
+		require.Contains(t, err.Error(), "max-rate-limit-wait")
+		require.Equal(t, 1, *calls)
+	})
+
+	t.Run("transport errors are returned once retries run out", func(t *testing.T) {
+		for _, retries := range []int{0, 2} {
+			calls := 0
+			client := &http.Client{
+				Transport: &retryTransport{
+					base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+						calls++
+						return nil, fmt.Errorf("connection refused")
+					}),
+					retries: retries,
+					backoff: time.Millisecond,
+					maxWait: time.Minute,
+				},
+			}
+			_, err := fetch(client, "http://example.invalid", http.MethodGet)
+			require.ErrorContains(t, err, "connection refused")
+			require.Equal(t, retries+1, calls)
+		}
+	})
+
+	t.Run("attempts that take too long are retried", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		})
+		client := newClient(1, time.Minute)
+		client.Transport.(*retryTransport).timeout = 100 * time.Millisecond
+		body, err := fetch(client, srv.URL, http.MethodGet)
+		require.NoError(t, err)
+		require.Equal(t, "ok", body)
+		require.Equal(t, 2, *calls)
+	})
+
+	t.Run("forbidden without rate limiting is not retried", func(t *testing.T) {
+		srv, calls := failing(1, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-RateLimit-Remaining", "42")
+			w.WriteHeader(http.StatusForbidden)
+		})
+		_, err := fetch(newClient(3, time.Minute), srv.URL, http.MethodGet)
+		require.True(t, requests.HasStatusErr(err, http.StatusForbidden))
+		require.Equal(t, 1, *calls)
+	})
+}
+
+func TestNewHttpClient(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		client, downloads, err := newHttpClient(HttpConfig{}, "")
+		require.NoError(t, err)
+		transport := client.Transport.(*retryTransport)
+		require.Equal(t, defaultApiTimeout, transport.timeout)
+		require.Equal(t, defaultHttpRetries, transport.retries)
+		require.Equal(t, defaultMaxRateLimitWait, transport.maxWait)
+		require.Equal(t, defaultDownloadTimeout, downloads.Transport.(*retryTransport).timeout)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		retries := 0
+		client, downloads, err := newHttpClient(HttpConfig{
+			Timeout:          "5s",
+			ApiTimeout:       "20s",
+			DownloadTimeout:  "1h",
+			Retries:          &retries,
+			MaxRateLimitWait: "10s",
+			Proxy:            "http://proxy.example.com:3128",
+		}, "")
+		require.NoError(t, err)
+		require.Equal(t, time.Hour, downloads.Transport.(*retryTransport).timeout)
+		transport := client.Transport.(*retryTransport)
+		require.Equal(t, 20*time.Second, transport.timeout)
+		require.Equal(t, 0, transport.retries)
+		require.Equal(t, 10*time.Second, transport.maxWait)
+
+		base := transport.base.(*http.Transport)
+		require.Equal(t, 5*time.Second, base.ResponseHeaderTimeout)
+		req := httptest.NewRequest(http.MethodGet, "https://example.com", nil)
+		proxy, err := base.Proxy(req)
+		require.NoError(t, err)
+		require.Equal(t, "proxy.example.com:3128", proxy.Host)
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, _, err := newHttpClient(HttpConfig{Timeout: "soon"}, "")
+		require.Error(t, err)
+
+		_, _, err = newHttpClient(HttpConfig{ApiTimeout: "soon"}, "")
+		require.Error(t, err)
+
+		_, _, err = newHttpClient(HttpConfig{CACert: "/does/not/exist.pem"}, "")
+		require.Error(t, err)
+
+		dir := buildDirectoryStructure(t, map[string]string{"ca.pem": "not a cert"})
+		_, _, err = newHttpClient(HttpConfig{CACert: dir + "/ca.pem"}, "")
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "no certificates found"))
+	})
+}
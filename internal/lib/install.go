@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// InstallModeBinary installs a single executable (or the list of binaries) out of a download
+	InstallModeBinary = "binary"
+	// InstallModeDirectory installs the entire contents of an archive as a directory
+	InstallModeDirectory = "directory"
+)
+
+// installSpec is the set of options shared by every executor that installs something it downloads
+type installSpec struct {
+	Name            string
+	Regex           string
+	Binaries        []Binary
+	InstallMode     string
+	StripComponents int
+	Links           []string
+}
+
+func (i installSpec) Validate() error {
+	var errs *multierror.Error
+
+	switch i.InstallMode {
+	case "", InstallModeBinary:
+		if i.StripComponents != 0 {
+			errs = multierror.Append(errs, fmt.Errorf("strip-components requires install-mode %v", InstallModeDirectory))
+		}
+		if len(i.Links) > 0 {
+			errs = multierror.Append(errs, fmt.Errorf("links requires install-mode %v", InstallModeDirectory))
+		}
+	case InstallModeDirectory:
+		if len(i.Binaries) > 0 {
+			errs = multierror.Append(errs, fmt.Errorf("binaries cannot be used with install-mode %v, use links instead", InstallModeDirectory))
+		}
+		if i.Regex != "" {
+			errs = multierror.Append(errs, fmt.Errorf("regex cannot be used with install-mode %v", InstallModeDirectory))
+		}
+		if i.StripComponents < 0 {
+			errs = multierror.Append(errs, fmt.Errorf("strip-components cannot be negative"))
+		}
+		for _, link := range i.Links {
+			if !validRelPath(link) {
+				errs = multierror.Append(errs, fmt.Errorf("link %v must be a relative path inside the archive", link))
+			}
+			if path.Base(link) == i.Name {
+				errs = multierror.Append(errs, fmt.Errorf("link %v conflicts with the directory symlink %v", link, i.Name))
+			}
+		}
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unknown install-mode %v, must be one of %v or %v", i.InstallMode, InstallModeBinary, InstallModeDirectory))
+	}
+
+	if err := validateBinaries(i.Binaries); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// installDownload installs the contents of url according to spec, into the versioned location for
+// the given tag, reporting whether anything changed
+func installDownload(ctx context.Context, conf UserConfig, opts SyncOpts, spec installSpec, tag string, url string, downloadName string, requestFunc func(*requests.Builder), log zerolog.Logger) (bool, error) {
+	dest, err := getDestination(conf, spec.Name, tag)
+	if err != nil {
+		return false, err
+	}
+
+	symlink, err := getSymlinkName(conf, spec.Name, tag)
+	if err != nil {
+		return false, err
+	}
+
+	if spec.InstallMode == InstallModeDirectory {
+		changed, err := downloadAndUnpackDirectory(ctx, directoryOpts{
+			Name:            spec.Name,
+			DownloadName:    downloadName,
+			FinalDest:       dest,
+			Url:             url,
+			Version:         tag,
+			RequestFunc:     requestFunc,
+			SymlinkName:     symlink,
+			Cache:           newDownloadCache(conf),
+			Client:          conf.downloadClient(),
+			StripComponents: spec.StripComponents,
+			Links:           spec.Links,
+			LinkDir:         conf.BinaryDir,
+			Journal:         opts.journal,
+		}, log)
+		if err != nil {
+			return false, fmt.Errorf("error during download/unpack: %w", err)
+		}
+		return changed, nil
+	}
+
+	searchFunc, err := regexSearchFunc(spec.Regex)
+	if err != nil {
+		return false, err
+	}
+
+	installs, err := binaryInstalls(conf, tag, spec.Binaries)
+	if err != nil {
+		return false, err
+	}
+
+	changed, err := downloadAndSymlinkBinary(ctx, downloadOpts{
+		Name:         spec.Name,
+		DownloadName: downloadName,
+		FinalDest:    dest,
+		Url:          url,
+		Version:      tag,
+		RequestFunc:  requestFunc,
+		SearchFunc:   searchFunc,
+		SymlinkName:  symlink,
+		Cache:        newDownloadCache(conf),
+		Client:       conf.downloadClient(),
+		Binaries:     installs,
+		Journal:      opts.journal,
+	}, log)
+	if err != nil {
+		return false, fmt.Errorf("error during download/symlink: %w", err)
+	}
+	return changed, nil
+}
+
+func regexSearchFunc(pattern string) (searchFunc, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile executable regex: %v", err)
+	}
+
+	return func(path string) (bool, error) {
+		return regex.MatchString(path), nil
+	}, nil
+}
+
+type directoryOpts struct {
+	Name            string
+	DownloadName    string
+	FinalDest       string
+	Url             string
+	Version         string
+	RequestFunc     func(*requests.Builder)
+	SymlinkName     string
+	Cache           downloadCache
+	Client          *http.Client
+	StripComponents int
+	// Links are paths relative to the extracted directory that should be symlinked into LinkDir
+	Links   []string
+	LinkDir string
+	Journal *journal
+}
+
+// downloadAndUnpackDirectory extracts a whole archive into a versioned directory, and symlinks both
+// the directory itself and any requested entries inside of it
+func downloadAndUnpackDirectory(ctx context.Context, opts directoryOpts, logger zerolog.Logger) (bool, error) {
+	exists, err := pathExists(opts.FinalDest)
+	if err != nil {
+		return false, fmt.Errorf("unable to check existance of %v: %w", opts.FinalDest, err)
+	}
+
+	changed := false
+	if exists {
+		logger.Info().Str("name", opts.Name).Msg("already exists, skipping download")
+	} else {
+		if err := opts.Journal.record(opts.FinalDest); err != nil {
+			return false, err
+		}
+		if err := downloadToDirectory(ctx, opts, logger); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	linked, err := ensureSymlink(opts.Journal, opts.FinalDest, opts.SymlinkName)
+	if err != nil {
+		return false, err
+	}
+	changed = changed || linked
+
+	for _, link := range opts.Links {
+		target := filepath.Join(opts.FinalDest, filepath.FromSlash(link))
+		targetExists, err := pathExists(target)
+		if err != nil {
+			return false, fmt.Errorf("unable to check existance of %v: %w", target, err)
+		}
+		if !targetExists {
+			return false, fmt.Errorf("link %v does not exist in the extracted archive", link)
+		}
+		linked, err := ensureSymlink(opts.Journal, target, filepath.Join(opts.LinkDir, path.Base(link)))
+		if err != nil {
+			return false, err
+		}
+		changed = changed || linked
+	}
+
+	return changed, nil
+}
+
+func downloadToDirectory(ctx context.Context, opts directoryOpts, logger zerolog.Logger) error {
+	logger.Info().Str("name", opts.Name).Msg("downloading")
+
+	dir, err := os.MkdirTemp("", "godot-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp directory")
+	}
+	defer os.RemoveAll(dir)
+
+	downloadPath := filepath.Join(dir, opts.DownloadName)
+	if err := fetchToFile(ctx, opts.Cache, opts.Client, opts.Url, opts.Version, downloadPath, opts.RequestFunc, logger); err != nil {
+		return err
+	}
+
+	// Extract next to the final destination and then move it into place, so a failed extraction
+	// doesn't leave behind a partial directory that looks installed
+	if err := ensureContainingDir(opts.FinalDest); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(filepath.Dir(opts.FinalDest), ".godot-"+opts.Name+"-")
+	if err != nil {
+		return fmt.Errorf("unable to make staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if err := extractArchive(ctx, downloadPath, staging, opts.StripComponents, logger); err != nil {
+		return fmt.Errorf("error extracting archive: %w", err)
+	}
+	if err := os.Chmod(staging, 0755); err != nil {
+		return fmt.Errorf("error setting directory permissions: %w", err)
+	}
+	if err := os.Rename(staging, opts.FinalDest); err != nil {
+		return fmt.Errorf("error moving extracted archive into place: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectoryInstall(t *testing.T) {
+	archive := buildTarGz(t, map[string]string{
+		"tool-v1.0.0/bin/tool":        "tool",
+		"tool-v1.0.0/share/tool/data": "data",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	u := UrlDownload{
+		Name:            "toolkit",
+		Tag:             "v1.0.0",
+		LinuxUrl:        srv.URL + "/tool.tar.gz",
+		MacUrl:          srv.URL + "/tool.tar.gz",
+		InstallMode:     InstallModeDirectory,
+		StripComponents: 1,
+		Links:           []string{"bin/tool"},
+	}
+	require.NoError(t, u.Validate())
+	_, err := u.Execute(context.Background(), UserConfig{BinaryDir: dir}, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(dir, "toolkit-v1.0.0", "bin", "tool"), "tool")
+	requireContents(t, filepath.Join(dir, "toolkit-v1.0.0", "share", "tool", "data"), "data")
+	requireContents(t, filepath.Join(dir, "toolkit", "bin", "tool"), "tool")
+	requireContents(t, filepath.Join(dir, "tool"), "tool")
+
+	// Nothing should be left over from staging the extraction
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
+
+func TestInstallSpecValidate(t *testing.T) {
+	require.NoError(t, installSpec{InstallMode: InstallModeDirectory, StripComponents: 1, Links: []string{"bin/nvim"}}.Validate())
+	require.NoError(t, installSpec{Binaries: []Binary{{Name: "a", Path: "a"}}}.Validate())
+
+	err := installSpec{InstallMode: "bogus"}.Validate()
+	require.ErrorContains(t, err, "unknown install-mode bogus")
+
+	err = installSpec{StripComponents: 1, Links: []string{"bin/foo"}}.Validate()
+	require.ErrorContains(t, err, "strip-components requires install-mode directory")
+	require.ErrorContains(t, err, "links requires install-mode directory")
+
+	err = installSpec{Name: "nvim", InstallMode: InstallModeDirectory, Links: []string{"bin/nvim"}}.Validate()
+	require.ErrorContains(t, err, "conflicts with the directory symlink")
+
+	err = installSpec{InstallMode: InstallModeDirectory, Binaries: []Binary{{Name: "a", Path: "a"}}, Links: []string{"../escape"}}.Validate()
+	require.ErrorContains(t, err, "binaries cannot be used")
+	require.ErrorContains(t, err, "must be a relative path")
+}
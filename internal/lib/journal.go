@@ -0,0 +1,197 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+// journal records the state of everything a sync is about to change, so that a failed sync can put
+// the machine back the way it found it. A nil journal records nothing, so executors can be run
+// outside of a sync without one
+type journal struct {
+	dir      string
+	entries  []journalEntry
+	seen     map[string]bool
+	cleanups []func() error
+	log      zerolog.Logger
+}
+
+type journalEntry struct {
+	path string
+	// existed is false when path was created by the sync, and so should be removed on rollback
+	existed bool
+	dir     bool
+	mode    os.FileMode
+	// link is the target of path, if it was a symlink
+	link string
+	// backup is a copy of path, if it was a regular file
+	backup string
+	// undo, if set, is used to roll back instead of restoring path
+	undo func() error
+}
+
+func newJournal(logger zerolog.Logger) (*journal, error) {
+	dir, err := os.MkdirTemp("", "godot-journal-")
+	if err != nil {
+		return nil, fmt.Errorf("unable to make journal directory: %w", err)
+	}
+	return &journal{
+		dir:  dir,
+		seen: map[string]bool{},
+		log:  logger,
+	}, nil
+}
+
+// record snapshots path before it is changed. Only the first snapshot of a path is kept, so rolling
+// back restores it to how it was before the sync started
+func (j *journal) record(path string) error {
+	if j == nil || j.seen[path] {
+		return nil
+	}
+
+	entry := journalEntry{path: path}
+	info, err := os.Lstat(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return fmt.Errorf("error checking %v: %w", path, err)
+	case info.Mode()&os.ModeSymlink != 0:
+		entry.existed = true
+		entry.link, err = os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("error reading symlink %v: %w", path, err)
+		}
+	case info.IsDir():
+		// Directories are only ever created or replaced, never changed in place
+		entry.existed = true
+		entry.dir = true
+		entry.mode = info.Mode().Perm()
+	default:
+		entry.existed = true
+		entry.mode = info.Mode().Perm()
+		entry.backup = filepath.Join(j.dir, fmt.Sprint(len(j.entries)))
+		if err := copyFile(path, entry.backup, entry.mode); err != nil {
+			return fmt.Errorf("error backing up %v: %w", path, err)
+		}
+	}
+
+	j.seen[path] = true
+	j.entries = append(j.entries, entry)
+	return nil
+}
+
+// onRollback registers undo to be run on rollback, for changes that can't be captured by a snapshot
+// of a path
+func (j *journal) onRollback(undo func() error) {
+	if j == nil {
+		return
+	}
+	j.entries = append(j.entries, journalEntry{undo: undo})
+}
+
+// onClose registers cleanup to be run once the journal is closed, for backups kept elsewhere that a
+// rollback may still need. Without a journal there's nothing to roll back to, so it's run right away
+func (j *journal) onClose(cleanup func() error) error {
+	if j == nil {
+		return cleanup()
+	}
+	j.cleanups = append(j.cleanups, cleanup)
+	return nil
+}
+
+// rollback undoes everything recorded in the journal, most recent first
+func (j *journal) rollback() error {
+	if j == nil {
+		return nil
+	}
+
+	var errs *multierror.Error
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		entry := j.entries[i]
+		if entry.path != "" {
+			j.log.Debug().Str("path", entry.path).Msg("rolling back")
+		}
+		if err := entry.restore(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	j.entries = nil
+	j.seen = map[string]bool{}
+	return errs.ErrorOrNil()
+}
+
+// close discards the journal's backups
+func (j *journal) close() error {
+	if j == nil {
+		return nil
+	}
+	var errs *multierror.Error
+	for _, cleanup := range j.cleanups {
+		errs = multierror.Append(errs, cleanup())
+	}
+	j.cleanups = nil
+	return multierror.Append(errs, os.RemoveAll(j.dir)).ErrorOrNil()
+}
+
+func (e journalEntry) restore() error {
+	if e.undo != nil {
+		return e.undo()
+	}
+
+	if !e.existed {
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("error removing %v: %w", e.path, err)
+		}
+		return nil
+	}
+
+	if e.dir {
+		if info, err := os.Lstat(e.path); err == nil && info.IsDir() {
+			return nil
+		}
+		if err := os.RemoveAll(e.path); err != nil {
+			return fmt.Errorf("error removing %v: %w", e.path, err)
+		}
+		if err := os.MkdirAll(e.path, e.mode); err != nil {
+			return fmt.Errorf("error recreating directory %v: %w", e.path, err)
+		}
+		return nil
+	}
+
+	if e.link != "" {
+		if err := createSymlink(e.link, e.path); err != nil {
+			return fmt.Errorf("error restoring symlink %v: %w", e.path, err)
+		}
+		return nil
+	}
+
+	if err := copyFile(e.backup, e.path, e.mode); err != nil {
+		return fmt.Errorf("error restoring %v: %w", e.path, err)
+	}
+	return nil
+}
+
+func copyFile(src string, dest string, perm os.FileMode) error {
+	sfile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sfile.Close()
+
+	// A directory may have been put in place of the file
+	if info, err := os.Lstat(dest); err == nil && info.IsDir() {
+		if err := os.RemoveAll(dest); err != nil {
+			return err
+		}
+	}
+
+	return writeAtomic(dest, perm, func(w io.Writer) error {
+		_, err := io.Copy(w, sfile)
+		return err
+	})
+}
@@ -0,0 +1,141 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	dir := buildDirectoryStructure(t, map[string]string{
+		"file":   "original",
+		"target": "target",
+		"dir/":   "",
+	})
+	file := filepath.Join(dir, "file")
+	link := filepath.Join(dir, "link")
+	created := filepath.Join(dir, "created")
+	subdir := filepath.Join(dir, "dir")
+	require.NoError(t, os.Symlink(filepath.Join(dir, "target"), link))
+
+	j, err := newJournal(zerolog.Nop())
+	require.NoError(t, err)
+	defer j.close()
+
+	for _, p := range []string{file, link, created, subdir} {
+		require.NoError(t, j.record(p))
+	}
+	// Only the first snapshot counts
+	require.NoError(t, os.WriteFile(file, []byte("changed"), 0644))
+	require.NoError(t, j.record(file))
+
+	require.NoError(t, os.WriteFile(file, []byte("changed again"), 0644))
+	require.NoError(t, createSymlink(file, link))
+	require.NoError(t, os.MkdirAll(filepath.Join(created, "nested"), 0755))
+	require.NoError(t, os.Remove(subdir))
+	require.NoError(t, createSymlink(file, subdir))
+
+	undone := false
+	j.onRollback(func() error {
+		undone = true
+		return nil
+	})
+
+	require.NoError(t, j.rollback())
+	require.True(t, undone)
+	requireContents(t, file, "original")
+	linkTarget, err := os.Readlink(link)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "target"), linkTarget)
+	_, err = os.Stat(created)
+	require.True(t, os.IsNotExist(err))
+	info, err := os.Lstat(subdir)
+	require.NoError(t, err)
+	require.True(t, info.IsDir())
+}
+
+func TestNilJournal(t *testing.T) {
+	var j *journal
+	require.NoError(t, j.record("/does/not/matter"))
+	j.onRollback(func() error { return nil })
+	require.NoError(t, j.rollback())
+	require.NoError(t, j.close())
+
+	// Without a journal there's nothing to keep backups around for
+	cleaned := false
+	require.NoError(t, j.onClose(func() error {
+		cleaned = true
+		return nil
+	}))
+	require.True(t, cleaned)
+}
+
+func TestSyncRollback(t *testing.T) {
+	defer cleanFuncsMap(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	dotfiles := initRepo(t, map[string]string{
+		"templates/conf": "new config",
+		"config.yaml": dedent.Dedent(`
+			executors:
+			  conf:
+			    type: config-file
+			    spec:
+			      template-name: conf
+			      destination: "~/.config/conf"
+			  tool:
+			    type: url-download
+			    spec:
+			      linux-url: ` + srv.URL + `/tool
+			      mac-url: ` + srv.URL + `/tool
+			targets:
+			  lab:
+			    - conf
+			    - tool
+		`),
+	})
+
+	home := buildDirectoryStructure(t, map[string]string{
+		".config/conf": "old config",
+	})
+	conf := UserConfig{
+		Target:        "lab",
+		DotfilesURL:   dotfiles,
+		HomeDir:       home,
+		BinaryDir:     filepath.Join(home, "bin"),
+		CloneLocation: filepath.Join(home, "dotfiles"),
+		BuildLocation: filepath.Join(home, "rendered"),
+		CacheDir:      filepath.Join(home, "cache"),
+	}
+
+	t.Run("failures roll back", func(t *testing.T) {
+		err := syncFromConf(context.Background(), conf, SyncOpts{NoVault: true}, zerolog.Nop())
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "error during execution of tool")
+
+		info, err := os.Lstat(filepath.Join(home, ".config", "conf"))
+		require.NoError(t, err)
+		require.True(t, info.Mode().IsRegular())
+		requireContents(t, filepath.Join(home, ".config", "conf"), "old config")
+		_, err = os.Stat(filepath.Join(home, "rendered", "conf"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("unless asked not to", func(t *testing.T) {
+		cleanFuncsMap(t)
+		err := syncFromConf(context.Background(), conf, SyncOpts{NoVault: true, NoRollback: true}, zerolog.Nop())
+		require.Error(t, err)
+		requireContents(t, filepath.Join(home, ".config", "conf"), "new config")
+	})
+}
@@ -0,0 +1,51 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNeovimRecordsResolvedTag(t *testing.T) {
+	assets := map[string]string{
+		"linux/amd64":  "nvim-linux64.tar.gz",
+		"darwin/arm64": "nvim-macos-arm64.tar.gz",
+	}
+	asset, ok := assets[runtime.GOOS+"/"+runtime.GOARCH]
+	if !ok {
+		t.Skip("neovim isn't published for " + runtime.GOOS + "/" + runtime.GOARCH)
+	}
+
+	archive := buildTarGz(t, map[string]string{"nvim/bin/nvim": "nvim"})
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/repos/neovim/neovim/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name": "v0.10.0"}`)
+	})
+	mux.HandleFunc("/repos/neovim/neovim/releases/tags/v0.10.0", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"assets": [{"name": "%v", "url": "%v/assets/1", "browser_download_url": "%v/download"}]}`, asset, srv.URL, srv.URL)
+	})
+	mux.HandleFunc("/assets/1", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	})
+
+	conf := UserConfig{BinaryDir: t.TempDir(), GithubApiUrl: srv.URL}
+	n := &Neovim{Name: "neovim", Tag: Latest}
+	n.SetLogger(zerolog.Nop())
+	_, err := n.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	requireContents(t, filepath.Join(conf.BinaryDir, "neovim-v0.10.0", "bin", "nvim"), "nvim")
+
+	gen := newGeneration("")
+	require.NoError(t, n.recordGeneration(conf, gen))
+	require.Equal(t, map[string]string{"neovim": "v0.10.0"}, gen.Versions)
+	require.Equal(t, Latest, n.Tag)
+}
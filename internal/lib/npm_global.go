@@ -0,0 +1,98 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+var _ Executor = (*NpmGlobal)(nil)
+
+type NpmGlobal struct {
+	Name    string         `yaml:"-"`
+	Package string         `yaml:"package" mapstructure:"package"`
+	Version string         `yaml:"version" mapstructure:"version"`
+	log     zerolog.Logger `yaml:"-"`
+}
+
+func (n *NpmGlobal) SetLogger(log zerolog.Logger) {
+	n.log = log
+}
+
+func (n *NpmGlobal) Type() ExecutorType {
+	return ExecutorTypeNpmGlobal
+}
+
+func (n *NpmGlobal) GetName() string {
+	return n.Name
+}
+
+func (n *NpmGlobal) SetName(s string) {
+	n.Name = s
+}
+
+func (n *NpmGlobal) Validate() error {
+	var errs *multierror.Error
+
+	if n.Package == "" {
+		errs = multierror.Append(errs, fmt.Errorf("package is required"))
+	}
+	// Scoped packages start with an @, anything after that is a version
+	if strings.Contains(strings.TrimPrefix(n.Package, "@"), "@") {
+		errs = multierror.Append(errs, fmt.Errorf("package should not include a version, use version instead"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (n *NpmGlobal) Execute(ctx context.Context, conf UserConfig, _ SyncOpts, _ GodotConfig) (bool, error) {
+	runner := conf.commandRunner()
+
+	// npm ls exits non-zero for problems like unmet peer dependencies, but still lists what's
+	// installed
+	stdout, stderr, err := runner.Run(ctx, "npm", "ls", "--global", "--depth=0", "--json")
+	installed, parseErr := parseNpmList(stdout)
+	if parseErr != nil {
+		if err != nil {
+			return false, fmt.Errorf("error listing global packages: %v\n%v", err, stderr)
+		}
+		return false, parseErr
+	}
+	version, ok := installed[n.Package]
+	if ok && (n.Version == "" || n.Version == version) {
+		n.log.Debug().Str("package", n.Package).Str("version", version).Msg("already installed")
+		return false, nil
+	}
+
+	n.log.Info().Str("package", n.Package).Msg("npm installing")
+	spec := n.Package
+	if n.Version != "" {
+		spec += "@" + n.Version
+	}
+	if _, stderr, err := runner.Run(ctx, "npm", "install", "--global", spec); err != nil {
+		return false, fmt.Errorf("error installing package: %v\n%v", err, stderr)
+	}
+	return true, nil
+}
+
+// parseNpmList reads the package versions out of `npm ls --json`
+func parseNpmList(out string) (map[string]string, error) {
+	var list struct {
+		Dependencies map[string]struct {
+			Version string `json:"version"`
+		} `json:"dependencies"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("error parsing npm ls: %w", err)
+	}
+
+	installed := map[string]string{}
+	for name, dep := range list.Dependencies {
+		installed[name] = dep.Version
+	}
+	return installed, nil
+}
@@ -0,0 +1,77 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testNpmList = `{
+  "name": "lib",
+  "dependencies": {
+    "typescript": {"version": "5.4.5"},
+    "@biomejs/biome": {"version": "1.8.1"}
+  }
+}`
+
+func TestNpmGlobalExecute(t *testing.T) {
+	tcs := []struct {
+		name    string
+		install *NpmGlobal
+		want    []string
+	}{
+		{
+			name:    "installed",
+			install: &NpmGlobal{Package: "typescript"},
+			want:    []string{"npm ls --global --depth=0 --json"},
+		},
+		{
+			name:    "scoped and pinned",
+			install: &NpmGlobal{Package: "@biomejs/biome", Version: "1.8.1"},
+			want:    []string{"npm ls --global --depth=0 --json"},
+		},
+		{
+			name:    "different version",
+			install: &NpmGlobal{Package: "@biomejs/biome", Version: "1.9.0"},
+			want:    []string{"npm ls --global --depth=0 --json", "npm install --global @biomejs/biome@1.9.0"},
+		},
+		{
+			name:    "missing",
+			install: &NpmGlobal{Package: "prettier"},
+			want:    []string{"npm ls --global --depth=0 --json", "npm install --global prettier"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+				"npm ls": func(args []string) (string, string, error) {
+					// Problems with the installed packages are reported alongside the listing
+					return testNpmList, "npm ERR! invalid: typescript", fmt.Errorf("exit status 1")
+				},
+			}}
+			conf := UserConfig{runner: runner}
+			changed, err := tc.install.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, runner.commands)
+			require.Equal(t, len(tc.want) > 1, changed)
+		})
+	}
+
+	t.Run("npm failing to list is an error", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"npm ls": func(args []string) (string, string, error) {
+				return "", "npm: command not found", fmt.Errorf("exit status 127")
+			},
+		}}
+		_, err := (&NpmGlobal{Package: "prettier"}).Execute(context.Background(), UserConfig{runner: runner}, SyncOpts{}, GodotConfig{})
+		require.ErrorContains(t, err, "command not found")
+	})
+}
+
+func TestNpmGlobalValidate(t *testing.T) {
+	require.ErrorContains(t, (&NpmGlobal{}).Validate(), "package is required")
+	require.ErrorContains(t, (&NpmGlobal{Package: "prettier@3"}).Validate(), "use version instead")
+	require.NoError(t, (&NpmGlobal{Package: "@biomejs/biome"}).Validate())
+}
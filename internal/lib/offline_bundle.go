@@ -0,0 +1,393 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/mholt/archives"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+const (
+	bundleManifestName = "manifest.json"
+	bundleCacheDir     = "cache"
+	bundleReposDir     = "repos"
+	bundleVersion      = 1
+)
+
+// networkExecutorTypes are executors that hand off to tools which do their own downloading, so they
+// can't be captured in an offline bundle
+var networkExecutorTypes = []ExecutorType{
+	ExecutorTypeSysPackage,
+	ExecutorTypeGoInstall,
+	ExecutorTypePackageRepo,
+	ExecutorTypeCargoInstall,
+	ExecutorTypePipxInstall,
+	ExecutorTypeNpmGlobal,
+}
+
+// bundleManifest records everything resolved at export time, so that a sync from the bundle makes
+// the exact same decisions without talking to the network
+type bundleManifest struct {
+	Version     int                          `json:"version"`
+	Target      string                       `json:"target"`
+	OS          string                       `json:"os"`
+	Arch        string                       `json:"arch"`
+	Created     time.Time                    `json:"created"`
+	DotfilesURL string                       `json:"dotfiles-url"`
+	Releases    map[string]bundledRelease    `json:"releases"`
+	Repos       map[string]string            `json:"repos"`
+	Vault       map[string]map[string]string `json:"vault,omitempty"`
+	Skipped     []string                     `json:"skipped,omitempty"`
+}
+
+type bundledRelease struct {
+	Tag   string  `json:"tag"`
+	Asset release `json:"asset"`
+}
+
+// bundleExporter is implemented by executors that need something fetched ahead of time in order to
+// run from an offline bundle
+type bundleExporter interface {
+	exportToBundle(ctx context.Context, conf UserConfig, godotConf GodotConfig, w *bundleWriter) error
+}
+
+type BundleExportOpts struct {
+	Target     string
+	Output     string
+	AllowVault bool
+	Logger     zerolog.Logger
+}
+
+func BundleExport(ctx context.Context, opts BundleExportOpts) error {
+	conf, err := NewOverrideableConfig(ConfigOverrides{
+		IgnoreVault: !opts.AllowVault,
+	})
+	if err != nil {
+		return fmt.Errorf("error getting config: %w", err)
+	}
+	if opts.Target != "" {
+		conf.Target = opts.Target
+	}
+	return exportBundle(ctx, conf, opts)
+}
+
+// bundleWriter accumulates the contents of a bundle in a staging directory
+type bundleWriter struct {
+	Dir      string
+	Manifest bundleManifest
+	Cache    downloadCache
+	Client   *http.Client
+	log      zerolog.Logger
+}
+
+func (w *bundleWriter) addDownload(ctx context.Context, url string, version string, name string, requestFunc func(*requests.Builder)) error {
+	return w.Cache.ensure(ctx, w.Client, url, version, name, requestFunc, w.log)
+}
+
+func (w *bundleWriter) addRelease(name string, tag string, asset release) {
+	w.Manifest.Releases[name] = bundledRelease{
+		Tag:   tag,
+		Asset: asset,
+	}
+}
+
+// addRepo mirrors the repo at url into the bundle. Every ref & tag is kept so that pinned commits
+// can still be checked out offline
+func (w *bundleWriter) addRepo(ctx context.Context, url string, auth *githttp.BasicAuth) error {
+	if _, ok := w.Manifest.Repos[url]; ok {
+		return nil
+	}
+	w.log.Info().Str("url", url).Msg("bundling git repo")
+
+	rel := path.Join(bundleReposDir, urlKey(url))
+	opts := &git.CloneOptions{
+		URL:  url,
+		Tags: git.AllTags,
+	}
+	if auth != nil {
+		opts.Auth = auth
+	}
+	if _, err := git.PlainCloneContext(ctx, filepath.Join(w.Dir, filepath.FromSlash(rel)), true, opts); err != nil {
+		return fmt.Errorf("error cloning %v: %w", url, err)
+	}
+	w.Manifest.Repos[url] = rel
+	return nil
+}
+
+//nolint:gocognit
+func exportBundle(ctx context.Context, conf UserConfig, opts BundleExportOpts) error {
+	logger := opts.Logger
+	useInProcessFileTransport()
+	useHttpClientForGit(conf.downloadClient())
+
+	staging, err := os.MkdirTemp("", "godot-bundle-")
+	if err != nil {
+		return fmt.Errorf("unable to make staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	w := &bundleWriter{
+		Dir: staging,
+		Manifest: bundleManifest{
+			Version:     bundleVersion,
+			Target:      conf.Target,
+			OS:          runtime.GOOS,
+			Arch:        runtime.GOARCH,
+			Created:     time.Now().UTC(),
+			DotfilesURL: conf.DotfilesURL,
+			Releases:    map[string]bundledRelease{},
+			Repos:       map[string]string{},
+		},
+		// Anything already in the local caches is reused rather than downloaded again
+		Cache: downloadCache{
+			Dir:    filepath.Join(staging, bundleCacheDir),
+			Shared: newDownloadCache(conf).dirs(),
+		},
+		Client: conf.downloadClient(),
+		log:    logger,
+	}
+
+	if opts.AllowVault {
+		w.Manifest.Vault = map[string]map[string]string{}
+		conf.VaultConfig.Client = &recordingVaultClient{
+			client: conf.VaultConfig.Client,
+			values: w.Manifest.Vault,
+		}
+	}
+
+	dotfiles := dotfilesRepo(conf)
+	if err := w.addRepo(ctx, conf.DotfilesURL, dotfiles.authFromConfig(conf)); err != nil {
+		return fmt.Errorf("error bundling dotfiles repo: %w", err)
+	}
+
+	// Work from a checkout of the bundled dotfiles, rather than whatever happens to be cloned locally
+	worktree, err := os.MkdirTemp("", "godot-bundle-dotfiles-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp directory: %w", err)
+	}
+	defer os.RemoveAll(worktree)
+	_, err = git.PlainCloneContext(ctx, worktree, false, &git.CloneOptions{
+		URL: filepath.Join(staging, filepath.FromSlash(w.Manifest.Repos[conf.DotfilesURL])),
+	})
+	if err != nil {
+		return fmt.Errorf("error checking out bundled dotfiles: %w", err)
+	}
+	conf.CloneLocation = worktree
+
+	godotConf, err := NewGodotConfigFromUserConfig(conf)
+	if err != nil {
+		return fmt.Errorf("error loading godot config; %w", err)
+	}
+	executors, err := godotConf.ExecutorsForTarget(conf.Target)
+	if err != nil {
+		return fmt.Errorf("error fetching target configuration: %w", err)
+	}
+
+	for _, ex := range executors {
+		if lo.Contains(networkExecutorTypes, ex.Type()) {
+			logger.Warn().Str("name", ex.GetName()).Msg("cannot be bundled, will be skipped when syncing offline")
+			w.Manifest.Skipped = append(w.Manifest.Skipped, ex.GetName())
+			continue
+		}
+		exporter, ok := ex.(bundleExporter)
+		if !ok {
+			continue
+		}
+		ex.SetLogger(logger)
+		if err := exporter.exportToBundle(ctx, conf, godotConf, w); err != nil {
+			return fmt.Errorf("error bundling %v: %w", ex.GetName(), err)
+		}
+	}
+
+	b, err := json.MarshalIndent(w.Manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshalling manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(staging, bundleManifestName), b, 0600); err != nil {
+		return fmt.Errorf("error writing manifest: %w", err)
+	}
+
+	logger.Info().Str("output", opts.Output).Msg("writing bundle")
+	return writeBundleArchive(ctx, staging, opts.Output)
+}
+
+func writeBundleArchive(ctx context.Context, dir string, output string) error {
+	files, err := archives.FilesFromDisk(ctx, nil, map[string]string{
+		dir + string(os.PathSeparator): "",
+	})
+	if err != nil {
+		return fmt.Errorf("error collecting bundle contents: %w", err)
+	}
+
+	// Write next to the output and move it into place, so a failed export never looks complete. The
+	// bundle can hold resolved vault secrets, so only the user gets to read it
+	err = writeAtomic(output, 0600, func(w io.Writer) error {
+		return (archives.Tar{}).Archive(ctx, w, files)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing bundle: %w", err)
+	}
+	return nil
+}
+
+// offlineBundle is an extracted bundle that a sync is being served from
+type offlineBundle struct {
+	Dir      string
+	Manifest bundleManifest
+}
+
+// openBundle extracts the bundle at path into a temporary directory. The returned func removes it
+// again
+func openBundle(ctx context.Context, bundlePath string, logger zerolog.Logger) (*offlineBundle, func(), error) {
+	dir, err := os.MkdirTemp("", "godot-bundle-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to make temp directory: %w", err)
+	}
+	cleanup := func() {
+		os.RemoveAll(dir)
+	}
+
+	if err := extractArchive(ctx, bundlePath, dir, 0, logger); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error extracting bundle: %w", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, bundleManifestName))
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error reading bundle manifest: %w", err)
+	}
+	var manifest bundleManifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error parsing bundle manifest: %w", err)
+	}
+	if manifest.Version != bundleVersion {
+		cleanup()
+		return nil, nil, fmt.Errorf("unsupported bundle version %v", manifest.Version)
+	}
+
+	useInProcessFileTransport()
+	return &offlineBundle{Dir: dir, Manifest: manifest}, cleanup, nil
+}
+
+// apply points the user config & sync options at the contents of the bundle
+func (o *offlineBundle) apply(conf UserConfig, opts SyncOpts, logger zerolog.Logger) (UserConfig, SyncOpts, error) {
+	if o.Manifest.OS != runtime.GOOS || o.Manifest.Arch != runtime.GOARCH {
+		return conf, opts, fmt.Errorf("bundle was exported for %v/%v, cannot be used on %v/%v", o.Manifest.OS, o.Manifest.Arch, runtime.GOOS, runtime.GOARCH)
+	}
+
+	if conf.Target != o.Manifest.Target {
+		logger.Info().Str("target", o.Manifest.Target).Msg("using target from bundle")
+	}
+	conf.Target = o.Manifest.Target
+	conf.DotfilesURL = o.Manifest.DotfilesURL
+	conf.SharedCacheDirs = append(append([]string{}, conf.SharedCacheDirs...), filepath.Join(o.Dir, bundleCacheDir))
+	conf.offline = o
+
+	if o.Manifest.Vault != nil {
+		conf.VaultConfig.Client = bundleVaultClient{values: o.Manifest.Vault}
+	} else {
+		opts.NoVault = true
+	}
+
+	return conf, opts, nil
+}
+
+func (o *offlineBundle) release(name string) (string, release, error) {
+	r, ok := o.Manifest.Releases[name]
+	if !ok {
+		return "", release{}, fmt.Errorf("release for %v is not in the offline bundle", name)
+	}
+	return r.Tag, r.Asset, nil
+}
+
+func (o *offlineBundle) repoPath(url string) (string, error) {
+	rel, ok := o.Manifest.Repos[url]
+	if !ok {
+		return "", fmt.Errorf("repo %v is not in the offline bundle", url)
+	}
+	return filepath.Join(o.Dir, filepath.FromSlash(rel)), nil
+}
+
+// useInProcessFileTransport serves local repos through go-git itself rather than shelling out to
+// git-upload-pack, so bundled repos work on machines without git installed
+func useInProcessFileTransport() {
+	client.InstallProtocol("file", server.NewServer(localRepoLoader{}))
+}
+
+// localRepoLoader loads both bare repos and the .git directory of regular checkouts
+type localRepoLoader struct{}
+
+func (localRepoLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	for _, dir := range []string{filepath.Join(ep.Path, git.GitDirName), ep.Path} {
+		fs := osfs.New(dir)
+		if _, err := fs.Stat("HEAD"); err == nil {
+			return filesystem.NewStorage(fs, cache.NewObjectLRUDefault()), nil
+		}
+	}
+	return nil, transport.ErrRepositoryNotFound
+}
+
+var _ VaultClient = (*recordingVaultClient)(nil)
+
+// recordingVaultClient remembers every value read through it, so they can be stored in a bundle
+type recordingVaultClient struct {
+	client VaultClient
+	values map[string]map[string]string
+}
+
+func (r *recordingVaultClient) Initialized() bool {
+	return r.client != nil && r.client.Initialized()
+}
+
+func (r *recordingVaultClient) ReadKey(path string, key string) (string, error) {
+	val, err := r.client.ReadKey(path, key)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := r.values[path]; !ok {
+		r.values[path] = map[string]string{}
+	}
+	r.values[path][key] = val
+	return val, nil
+}
+
+var _ VaultClient = (*bundleVaultClient)(nil)
+
+// bundleVaultClient serves the vault values captured when a bundle was exported
+type bundleVaultClient struct {
+	values map[string]map[string]string
+}
+
+func (b bundleVaultClient) Initialized() bool {
+	return true
+}
+
+func (b bundleVaultClient) ReadKey(path string, key string) (string, error) {
+	val, ok := b.values[path][key]
+	if !ok {
+		return "", fmt.Errorf("key %v at vault path %v was not captured when the bundle was exported", key, path)
+	}
+	return val, nil
+}
@@ -0,0 +1,149 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/lithammer/dedent"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo creates a git repo containing the given files, with a single commit
+func initRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := buildDirectoryStructure(t, files)
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	w, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, w.AddGlob("."))
+	_, err = w.Commit("initial", &git.CommitOptions{
+		Author: &object.Signature{Name: "godot", Email: "godot@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+	return dir
+}
+
+func TestOfflineBundle(t *testing.T) {
+	defer cleanFuncsMap(t)
+
+	downloads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		_, _ = w.Write([]byte("#!/bin/sh\necho tool\n"))
+	}))
+
+	other := initRepo(t, map[string]string{"README.md": "other"})
+	dotfiles := initRepo(t, map[string]string{
+		"templates/conf": `password={{ VaultLookup "secret/data/app" "password" }}`,
+		"config.yaml": dedent.Dedent(`
+			executors:
+			  conf:
+			    type: config-file
+			    spec:
+			      template-name: conf
+			      destination: "~/.config/conf"
+			  tool:
+			    type: url-download
+			    spec:
+			      linux-url: ` + srv.URL + `/tool
+			      mac-url: ` + srv.URL + `/tool
+			  other:
+			    type: git-repo
+			    spec:
+			      url: ` + other + `
+			      location: "~/other"
+			  pkg:
+			    type: sys-package
+			    spec:
+			      apt: some-package
+			targets:
+			  lab:
+			    - conf
+			    - tool
+			    - other
+			    - pkg
+		`),
+	})
+
+	output := filepath.Join(t.TempDir(), "bundle.tar")
+	exportConf := UserConfig{
+		Target:      "lab",
+		DotfilesURL: dotfiles,
+		CacheDir:    t.TempDir(),
+		VaultConfig: VaultConfig{
+			Client: &MockVaultClient{
+				ReadKeyFunc: func(path string, key string) (string, error) {
+					return path + "/" + key, nil
+				},
+			},
+		},
+	}
+	require.NoError(t, exportBundle(context.Background(), exportConf, BundleExportOpts{
+		Output:     output,
+		AllowVault: true,
+		Logger:     zerolog.Nop(),
+	}))
+	require.Equal(t, 1, downloads)
+	// The bundle holds vault values, so nobody else should be able to read it
+	info, err := os.Stat(output)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Nothing should be fetched from here on out
+	srv.Close()
+	cleanFuncsMap(t)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = openBundle(cancelled, output, zerolog.Nop())
+	require.ErrorIs(t, err, context.Canceled)
+	require.ErrorIs(t, writeBundleArchive(cancelled, t.TempDir(), filepath.Join(t.TempDir(), "bundle.tar")), context.Canceled)
+
+	bundle, cleanup, err := openBundle(context.Background(), output, zerolog.Nop())
+	require.NoError(t, err)
+	defer cleanup()
+	require.Equal(t, []string{"pkg"}, bundle.Manifest.Skipped)
+
+	home := t.TempDir()
+	conf, opts, err := bundle.apply(UserConfig{
+		Target:        "some-other-target",
+		DotfilesURL:   "https://example.com/not-used",
+		HomeDir:       home,
+		BinaryDir:     filepath.Join(home, "bin"),
+		CloneLocation: filepath.Join(home, "dotfiles"),
+		BuildLocation: filepath.Join(home, "rendered"),
+		CacheDir:      filepath.Join(home, "cache"),
+	}, SyncOpts{}, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, "lab", conf.Target)
+	require.False(t, opts.NoVault)
+
+	require.NoError(t, syncFromConf(context.Background(), conf, opts, zerolog.Nop()))
+
+	requireContents(t, filepath.Join(home, ".config", "conf"), "password=secret/data/app/password")
+	requireContents(t, filepath.Join(home, "bin", "tool"), "#!/bin/sh\necho tool\n")
+	requireContents(t, filepath.Join(home, "other", "README.md"), "other")
+
+	// Clones from the bundle should still point at the real remote
+	repo, err := git.PlainOpen(filepath.Join(home, "other"))
+	require.NoError(t, err)
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	require.NoError(t, err)
+	require.Equal(t, []string{other}, remote.Config().URLs)
+
+	// And a second sync should pull from the bundle too
+	require.NoError(t, syncFromConf(context.Background(), conf, opts, zerolog.Nop()))
+
+	_, err = os.Stat(filepath.Join(home, "dotfiles", "config.yaml"))
+	require.NoError(t, err)
+}
@@ -0,0 +1,343 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+// Where package repositories are configured, variables so they can be pointed elsewhere in tests
+var (
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+	aptKeyringsDir = "/etc/apt/keyrings"
+	yumReposDir    = "/etc/yum.repos.d"
+)
+
+var _ Executor = (*PackageRepo)(nil)
+
+// PackageRepo configures a third party package repository, so that system packages can be installed
+// from it. Only the section for the machine's package manager is used
+type PackageRepo struct {
+	Name string         `yaml:"-"`
+	Apt  *AptRepo       `yaml:"apt" mapstructure:"apt"`
+	Dnf  *DnfRepo       `yaml:"dnf" mapstructure:"dnf"`
+	Brew *BrewTap       `yaml:"brew" mapstructure:"brew"`
+	log  zerolog.Logger `yaml:"-"`
+}
+
+type AptRepo struct {
+	Ppa           string   `yaml:"ppa" mapstructure:"ppa"`
+	Url           string   `yaml:"url" mapstructure:"url"`
+	Suite         string   `yaml:"suite" mapstructure:"suite"`
+	Components    []string `yaml:"components" mapstructure:"components"`
+	Architectures []string `yaml:"architectures" mapstructure:"architectures"`
+	KeyUrl        string   `yaml:"key-url" mapstructure:"key-url"`
+	KeyFile       string   `yaml:"key-file" mapstructure:"key-file"`
+}
+
+type DnfRepo struct {
+	RepoUrl string `yaml:"repo-url" mapstructure:"repo-url"`
+	BaseUrl string `yaml:"base-url" mapstructure:"base-url"`
+	KeyUrl  string `yaml:"key-url" mapstructure:"key-url"`
+}
+
+type BrewTap struct {
+	Tap string `yaml:"tap" mapstructure:"tap"`
+	Url string `yaml:"url" mapstructure:"url"`
+}
+
+func (p *PackageRepo) SetLogger(log zerolog.Logger) {
+	p.log = log
+}
+
+func (p *PackageRepo) Type() ExecutorType {
+	return ExecutorTypePackageRepo
+}
+
+func (p *PackageRepo) GetName() string {
+	return p.Name
+}
+
+func (p *PackageRepo) SetName(n string) {
+	p.Name = n
+}
+
+func (p *PackageRepo) Validate() error {
+	var errs *multierror.Error
+
+	if p.Apt == nil && p.Dnf == nil && p.Brew == nil {
+		errs = multierror.Append(errs, fmt.Errorf("one of apt, dnf or brew is required"))
+	}
+	if p.Apt != nil {
+		switch {
+		case p.Apt.Ppa != "" && p.Apt.Url != "":
+			errs = multierror.Append(errs, fmt.Errorf("apt: only one of ppa or url can be given"))
+		case p.Apt.Ppa == "" && p.Apt.Url == "":
+			errs = multierror.Append(errs, fmt.Errorf("apt: one of ppa or url is required"))
+		case p.Apt.Url != "" && (p.Apt.KeyUrl == "") == (p.Apt.KeyFile == ""):
+			errs = multierror.Append(errs, fmt.Errorf("apt: exactly one of key-url or key-file is required"))
+		}
+	}
+	if p.Dnf != nil && (p.Dnf.RepoUrl == "") == (p.Dnf.BaseUrl == "") {
+		errs = multierror.Append(errs, fmt.Errorf("dnf: exactly one of repo-url or base-url is required"))
+	}
+	if p.Brew != nil && p.Brew.Tap == "" {
+		errs = multierror.Append(errs, fmt.Errorf("brew: tap is required"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (p *PackageRepo) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
+	if conf.PackageManager != PackageManagerBrew && !conf.canEscalate() {
+		p.log.Warn().Msg("skipping, privilege escalation is disabled")
+		return false, nil
+	}
+
+	var changed bool
+	var err error
+	switch {
+	case conf.PackageManager == PackageManagerApt && p.Apt != nil:
+		changed, err = p.executeApt(ctx, conf, opts)
+	case (conf.PackageManager == PackageManagerDnf || conf.PackageManager == PackageManagerYum) && p.Dnf != nil:
+		changed, err = p.executeDnf(ctx, conf, opts)
+	case conf.PackageManager == PackageManagerBrew && p.Brew != nil:
+		changed, err = p.executeBrew(ctx, conf)
+	default:
+		p.log.Debug().Str("package-manager", conf.PackageManager).Msg("no repo configured for package manager, skipping")
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error during execution: %w", err)
+	}
+	return changed, nil
+}
+
+func (p *PackageRepo) executeApt(ctx context.Context, conf UserConfig, opts SyncOpts) (bool, error) {
+	runner := conf.commandRunner()
+	if p.Apt.Ppa != "" {
+		return p.addPpa(ctx, conf)
+	}
+
+	key, err := p.fetchKey(ctx, conf, p.Apt.KeyUrl, p.Apt.KeyFile)
+	if err != nil {
+		return false, err
+	}
+	// Armored keys must keep their extension for apt to read them
+	keyring := filepath.Join(aptKeyringsDir, p.Name+lo.Ternary(isArmoredKey(key), ".asc", ".gpg"))
+	keyChanged, err := installRootFile(ctx, conf, opts.journal, keyring, key)
+	if err != nil {
+		return false, fmt.Errorf("error installing keyring: %w", err)
+	}
+
+	source, err := p.aptSource(keyring)
+	if err != nil {
+		return false, err
+	}
+	sourceChanged, err := installRootFile(ctx, conf, opts.journal, filepath.Join(aptSourcesDir, p.Name+".list"), []byte(source))
+	if err != nil {
+		return false, fmt.Errorf("error installing source list: %w", err)
+	}
+
+	if !keyChanged && !sourceChanged {
+		p.log.Info().Msg("repo already configured")
+		return false, nil
+	}
+	p.log.Info().Msg("updating package lists")
+	bin, args := conf.escalate("apt-get", "update")
+	if _, stderr, err := runner.Run(ctx, bin, args...); err != nil {
+		return false, fmt.Errorf("error updating package lists: %v\n%v", err, stderr)
+	}
+	return true, nil
+}
+
+// aptSource is the one line source list entry for the repo, signed by keyring
+func (p *PackageRepo) aptSource(keyring string) (string, error) {
+	suite := p.Apt.Suite
+	if suite == "" {
+		b, err := os.ReadFile(osReleasePath)
+		if err != nil {
+			return "", fmt.Errorf("error reading %v: %w", osReleasePath, err)
+		}
+		fields := parseOsRelease(string(b))
+		suite = lo.Ternary(fields["VERSION_CODENAME"] != "", fields["VERSION_CODENAME"], fields["UBUNTU_CODENAME"])
+		if suite == "" {
+			return "", fmt.Errorf("unable to determine release codename, suite is required")
+		}
+	}
+	components := lo.Ternary(len(p.Apt.Components) > 0, p.Apt.Components, []string{"main"})
+
+	options := []string{}
+	if len(p.Apt.Architectures) > 0 {
+		options = append(options, "arch="+strings.Join(p.Apt.Architectures, ","))
+	}
+	options = append(options, "signed-by="+keyring)
+
+	return fmt.Sprintf(
+		"# Managed by godot\ndeb [%v] %v %v %v\n",
+		strings.Join(options, " "),
+		p.Apt.Url,
+		suite,
+		strings.Join(components, " "),
+	), nil
+}
+
+// addPpa adds a launchpad PPA, unless a source list for it already exists
+func (p *PackageRepo) addPpa(ctx context.Context, conf UserConfig) (bool, error) {
+	ppa := strings.TrimPrefix(p.Apt.Ppa, "ppa:")
+	entries, err := os.ReadDir(aptSourcesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("error reading %v: %w", aptSourcesDir, err)
+	}
+	for _, entry := range entries {
+		b, err := os.ReadFile(filepath.Join(aptSourcesDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if strings.Contains(string(b), "ppa.launchpadcontent.net/"+ppa+"/") || strings.Contains(string(b), "ppa.launchpad.net/"+ppa+"/") {
+			p.log.Info().Str("ppa", ppa).Msg("ppa already added")
+			return false, nil
+		}
+	}
+
+	p.log.Info().Str("ppa", ppa).Msg("adding ppa")
+	bin, args := conf.escalate("add-apt-repository", "-y", "ppa:"+ppa)
+	if _, stderr, err := conf.commandRunner().Run(ctx, bin, args...); err != nil {
+		return false, fmt.Errorf("error adding ppa %v: %v\n%v", ppa, err, stderr)
+	}
+	return true, nil
+}
+
+func (p *PackageRepo) executeDnf(ctx context.Context, conf UserConfig, opts SyncOpts) (bool, error) {
+	var contents []byte
+	if p.Dnf.RepoUrl != "" {
+		var buf bytes.Buffer
+		if err := requests.URL(p.Dnf.RepoUrl).Client(conf.httpClient()).ToBytesBuffer(&buf).Fetch(ctx); err != nil {
+			return false, fmt.Errorf("error downloading repo file: %w", err)
+		}
+		contents = buf.Bytes()
+	} else {
+		lines := []string{
+			"# Managed by godot",
+			"[" + p.Name + "]",
+			"name=" + p.Name,
+			"baseurl=" + p.Dnf.BaseUrl,
+			"enabled=1",
+			"gpgcheck=" + lo.Ternary(p.Dnf.KeyUrl != "", "1", "0"),
+		}
+		if p.Dnf.KeyUrl != "" {
+			lines = append(lines, "gpgkey="+p.Dnf.KeyUrl)
+		}
+		contents = []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	changed, err := installRootFile(ctx, conf, opts.journal, filepath.Join(yumReposDir, p.Name+".repo"), contents)
+	if err != nil {
+		return false, fmt.Errorf("error installing repo file: %w", err)
+	}
+	if !changed {
+		p.log.Info().Msg("repo already configured")
+	}
+	return changed, nil
+}
+
+func (p *PackageRepo) executeBrew(ctx context.Context, conf UserConfig) (bool, error) {
+	runner := conf.commandRunner()
+	stdout, stderr, err := runner.Run(ctx, "brew", "tap")
+	if err != nil {
+		return false, fmt.Errorf("error listing taps: %v\n%v", err, stderr)
+	}
+	if lo.Contains(strings.Fields(stdout), strings.ToLower(p.Brew.Tap)) {
+		p.log.Info().Str("tap", p.Brew.Tap).Msg("already tapped")
+		return false, nil
+	}
+
+	args := []string{"tap", p.Brew.Tap}
+	if p.Brew.Url != "" {
+		args = append(args, p.Brew.Url)
+	}
+	p.log.Info().Str("tap", p.Brew.Tap).Msg("tapping")
+	if _, stderr, err := runner.Run(ctx, "brew", args...); err != nil {
+		return false, fmt.Errorf("error tapping %v: %v\n%v", p.Brew.Tap, err, stderr)
+	}
+	return true, nil
+}
+
+// fetchKey reads a signing key from the dotfiles repo, or downloads it
+func (p *PackageRepo) fetchKey(ctx context.Context, conf UserConfig, url string, file string) ([]byte, error) {
+	if file != "" {
+		b, err := os.ReadFile(filepath.Join(conf.CloneLocation, file))
+		if err != nil {
+			return nil, fmt.Errorf("error reading key: %w", err)
+		}
+		return b, nil
+	}
+
+	var buf bytes.Buffer
+	if err := requests.URL(url).Client(conf.httpClient()).ToBytesBuffer(&buf).Fetch(ctx); err != nil {
+		return nil, fmt.Errorf("error downloading key: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func isArmoredKey(key []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(key), []byte("-----BEGIN PGP"))
+}
+
+// installRootFile places contents at dest as root, returning if anything changed. The previous
+// contents are restored if the sync is rolled back
+func installRootFile(ctx context.Context, conf UserConfig, j *journal, dest string, contents []byte) (bool, error) {
+	previous, err := os.ReadFile(dest)
+	existed := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("error reading %v: %w", dest, err)
+	}
+	if existed && bytes.Equal(previous, contents) {
+		return false, nil
+	}
+
+	if err := rootInstall(ctx, conf, dest, contents); err != nil {
+		return false, err
+	}
+	j.onRollback(func() error {
+		// The sync's context may well be cancelled by the time of a rollback
+		if existed {
+			return rootInstall(context.Background(), conf, dest, previous)
+		}
+		bin, args := conf.escalate("rm", "-f", dest)
+		if _, stderr, err := conf.commandRunner().Run(context.Background(), bin, args...); err != nil {
+			return fmt.Errorf("error removing %v: %v\n%v", dest, err, stderr)
+		}
+		return nil
+	})
+	return true, nil
+}
+
+func rootInstall(ctx context.Context, conf UserConfig, dest string, contents []byte) error {
+	tmp, err := os.CreateTemp("", "godot-")
+	if err != nil {
+		return fmt.Errorf("unable to make temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing temp file: %w", err)
+	}
+
+	bin, args := conf.escalate("install", "-D", "-m", "0644", tmp.Name(), dest)
+	if _, stderr, err := conf.commandRunner().Run(ctx, bin, args...); err != nil {
+		return fmt.Errorf("error installing %v: %v\n%v", dest, err, stderr)
+	}
+	return nil
+}
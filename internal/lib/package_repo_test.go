@@ -0,0 +1,233 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+const testArmoredKey = "-----BEGIN PGP PUBLIC KEY BLOCK-----\nsome key\n-----END PGP PUBLIC KEY BLOCK-----\n"
+
+// setupPackageRepoDirs points the package repo locations at temp directories, returning a runner
+// that installs & removes files for real, without sudo
+func setupPackageRepoDirs(t *testing.T) *fakeRunner {
+	t.Helper()
+
+	oldSources, oldKeyrings, oldRepos, oldOsRelease := aptSourcesDir, aptKeyringsDir, yumReposDir, osReleasePath
+	t.Cleanup(func() {
+		aptSourcesDir, aptKeyringsDir, yumReposDir, osReleasePath = oldSources, oldKeyrings, oldRepos, oldOsRelease
+	})
+
+	dir := t.TempDir()
+	aptSourcesDir = filepath.Join(dir, "sources.list.d")
+	aptKeyringsDir = filepath.Join(dir, "keyrings")
+	yumReposDir = filepath.Join(dir, "yum.repos.d")
+	osReleasePath = filepath.Join(dir, "os-release")
+	require.NoError(t, os.WriteFile(osReleasePath, []byte("ID=ubuntu\nVERSION_CODENAME=noble\n"), 0644))
+
+	return &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+		"sudo install": func(args []string) (string, string, error) {
+			src, dest := args[len(args)-2], args[len(args)-1]
+			require.NoError(t, os.MkdirAll(filepath.Dir(dest), 0755))
+			return "", "", copyFile(src, dest, 0644)
+		},
+		"sudo rm": func(args []string) (string, string, error) {
+			return "", "", os.Remove(args[len(args)-1])
+		},
+	}}
+}
+
+func TestPackageRepoApt(t *testing.T) {
+	runner := setupPackageRepoDirs(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(testArmoredKey))
+	}))
+	defer srv.Close()
+
+	conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+	repo := &PackageRepo{
+		Name: "docker",
+		Apt: &AptRepo{
+			Url:           "https://download.docker.com/linux/ubuntu",
+			Components:    []string{"stable"},
+			Architectures: []string{"amd64"},
+			KeyUrl:        srv.URL + "/gpg",
+		},
+	}
+	repo.SetLogger(zerolog.Nop())
+
+	j, err := newJournal(zerolog.Nop())
+	require.NoError(t, err)
+	defer j.close()
+
+	_, err = repo.Execute(context.Background(), conf, SyncOpts{journal: j}, GodotConfig{})
+	require.NoError(t, err)
+	keyring := filepath.Join(aptKeyringsDir, "docker.asc")
+	requireContents(t, keyring, testArmoredKey)
+	requireContents(
+		t,
+		filepath.Join(aptSourcesDir, "docker.list"),
+		"# Managed by godot\ndeb [arch=amd64 signed-by="+keyring+"] https://download.docker.com/linux/ubuntu noble stable\n",
+	)
+	require.Contains(t, runner.commands, "sudo apt-get update")
+
+	t.Run("nothing to do when already configured", func(t *testing.T) {
+		runner.commands = nil
+		_, err := repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Empty(t, runner.commands)
+	})
+
+	t.Run("rolls back", func(t *testing.T) {
+		require.NoError(t, j.rollback())
+		_, err := os.Stat(keyring)
+		require.True(t, os.IsNotExist(err))
+		_, err = os.Stat(filepath.Join(aptSourcesDir, "docker.list"))
+		require.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestPackageRepoAptKeyFile(t *testing.T) {
+	runner := setupPackageRepoDirs(t)
+	clone := buildDirectoryStructure(t, map[string]string{
+		"keys/hashicorp.gpg": "binary key",
+	})
+
+	conf := UserConfig{PackageManager: PackageManagerApt, CloneLocation: clone, runner: runner}
+	repo := &PackageRepo{
+		Name: "hashicorp",
+		Apt: &AptRepo{
+			Url:     "https://apt.releases.hashicorp.com",
+			Suite:   "jammy",
+			KeyFile: "keys/hashicorp.gpg",
+		},
+	}
+	_, err := repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	keyring := filepath.Join(aptKeyringsDir, "hashicorp.gpg")
+	requireContents(t, keyring, "binary key")
+	requireContents(
+		t,
+		filepath.Join(aptSourcesDir, "hashicorp.list"),
+		"# Managed by godot\ndeb [signed-by="+keyring+"] https://apt.releases.hashicorp.com jammy main\n",
+	)
+}
+
+func TestPackageRepoPpa(t *testing.T) {
+	runner := setupPackageRepoDirs(t)
+	conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+	repo := &PackageRepo{Name: "neovim", Apt: &AptRepo{Ppa: "ppa:neovim-ppa/unstable"}}
+
+	_, err := repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"sudo add-apt-repository -y ppa:neovim-ppa/unstable"}, runner.commands)
+
+	runner.commands = nil
+	require.NoError(t, os.MkdirAll(aptSourcesDir, 0755))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(aptSourcesDir, "neovim-ppa-ubuntu-unstable-noble.sources"),
+		[]byte("Types: deb\nURIs: https://ppa.launchpadcontent.net/neovim-ppa/unstable/ubuntu/\n"),
+		0644,
+	))
+	_, err = repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	require.Empty(t, runner.commands)
+}
+
+func TestPackageRepoDnf(t *testing.T) {
+	runner := setupPackageRepoDirs(t)
+	conf := UserConfig{PackageManager: PackageManagerYum, runner: runner}
+	repo := &PackageRepo{
+		Name: "kubernetes",
+		Dnf: &DnfRepo{
+			BaseUrl: "https://pkgs.k8s.io/core:/stable:/v1.30/rpm/",
+			KeyUrl:  "https://pkgs.k8s.io/core:/stable:/v1.30/rpm/repodata/repomd.xml.key",
+		},
+	}
+	_, err := repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	requireContents(t, filepath.Join(yumReposDir, "kubernetes.repo"), `# Managed by godot
+[kubernetes]
+name=kubernetes
+baseurl=https://pkgs.k8s.io/core:/stable:/v1.30/rpm/
+enabled=1
+gpgcheck=1
+gpgkey=https://pkgs.k8s.io/core:/stable:/v1.30/rpm/repodata/repomd.xml.key
+`)
+
+	t.Run("skipped for other package managers", func(t *testing.T) {
+		runner.commands = nil
+		conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+		_, err := repo.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Empty(t, runner.commands)
+	})
+}
+
+func TestPackageRepoBrew(t *testing.T) {
+	runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+		"brew tap": func(args []string) (string, string, error) {
+			return "homebrew/bundle\nhashicorp/tap\n", "", nil
+		},
+	}}
+	conf := UserConfig{PackageManager: PackageManagerBrew, runner: runner}
+
+	_, err := (&PackageRepo{Brew: &BrewTap{Tap: "hashicorp/tap"}}).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"brew tap"}, runner.commands)
+
+	runner.commands = nil
+	_, err = (&PackageRepo{Brew: &BrewTap{Tap: "me/tools", Url: "https://git.example.com/me/tools"}}).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"brew tap", "brew tap me/tools https://git.example.com/me/tools"}, runner.commands)
+}
+
+func TestPackageRepoValidate(t *testing.T) {
+	require.ErrorContains(t, (&PackageRepo{}).Validate(), "one of apt, dnf or brew is required")
+	require.ErrorContains(t, (&PackageRepo{Apt: &AptRepo{Url: "https://example.com"}}).Validate(), "exactly one of key-url or key-file")
+	require.ErrorContains(t, (&PackageRepo{Apt: &AptRepo{Ppa: "a/b", Url: "https://example.com"}}).Validate(), "only one of ppa or url")
+	require.ErrorContains(t, (&PackageRepo{Dnf: &DnfRepo{}}).Validate(), "exactly one of repo-url or base-url")
+	require.ErrorContains(t, (&PackageRepo{Brew: &BrewTap{}}).Validate(), "tap is required")
+	require.NoError(t, (&PackageRepo{Apt: &AptRepo{Ppa: "a/b"}, Brew: &BrewTap{Tap: "a/b"}}).Validate())
+}
+
+func TestPackageRepoDependencies(t *testing.T) {
+	conf := GodotConfig{
+		Executors: map[string]GodotExecutor{
+			"docker": {Name: "docker", Type: ExecutorTypePackageRepo, Spec: map[string]any{
+				"brew": map[string]any{"tap": "docker/tap"},
+			}},
+			"docker-ce": {Name: "docker-ce", Type: ExecutorTypeSysPackage, Spec: map[string]any{
+				"apt":  "docker-ce",
+				"repo": "docker",
+			}},
+			"conf": {Name: "conf", Type: ExecutorTypeConfigFile, Spec: map[string]any{
+				"template-name": "conf",
+				"destination":   "~/.conf",
+			}},
+		},
+		Targets: map[string][]string{
+			"lab": {"conf", "docker-ce"},
+		},
+	}
+	require.NoError(t, conf.Validate())
+
+	executors, err := conf.ExecutorsForTarget("lab")
+	require.NoError(t, err)
+	names := []string{}
+	for _, ex := range executors {
+		names = append(names, ex.GetName())
+	}
+	require.Equal(t, []string{"docker", "conf", "docker-ce"}, names)
+
+	t.Run("unknown repos are invalid", func(t *testing.T) {
+		conf.Executors["docker-ce"].Spec["repo"] = "conf"
+		require.ErrorContains(t, conf.Validate(), "references unknown package-repo conf")
+	})
+}
@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var _ Executor = (*PipxInstall)(nil)
+
+const (
+	PipxInstallerPipx = "pipx"
+	PipxInstallerUv   = "uv"
+)
+
+// pythonNameSeparators are collapsed when normalizing package names, see PEP 503
+var pythonNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+type PipxInstall struct {
+	Name      string         `yaml:"-"`
+	Package   string         `yaml:"package" mapstructure:"package"`
+	Version   string         `yaml:"version" mapstructure:"version"`
+	Installer string         `yaml:"installer" mapstructure:"installer"`
+	log       zerolog.Logger `yaml:"-"`
+}
+
+func (p *PipxInstall) SetLogger(log zerolog.Logger) {
+	p.log = log
+}
+
+func (p *PipxInstall) Type() ExecutorType {
+	return ExecutorTypePipxInstall
+}
+
+func (p *PipxInstall) GetName() string {
+	return p.Name
+}
+
+func (p *PipxInstall) SetName(s string) {
+	p.Name = s
+}
+
+func (p *PipxInstall) Validate() error {
+	var errs *multierror.Error
+
+	if p.Package == "" {
+		errs = multierror.Append(errs, fmt.Errorf("package is required"))
+	}
+	if strings.ContainsAny(p.Package, "=<>~!") {
+		errs = multierror.Append(errs, fmt.Errorf("package should not include a version, use version instead"))
+	}
+	if p.Installer != "" && !lo.Contains([]string{PipxInstallerPipx, PipxInstallerUv}, p.Installer) {
+		errs = multierror.Append(errs, fmt.Errorf("installer must be one of %v or %v", PipxInstallerPipx, PipxInstallerUv))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (p *PipxInstall) Execute(ctx context.Context, conf UserConfig, _ SyncOpts, _ GodotConfig) (bool, error) {
+	installed, err := p.installed(ctx, conf)
+	if err != nil {
+		return false, err
+	}
+	version, ok := installed[normalizePythonName(p.packageName())]
+	if ok && (p.Version == "" || p.Version == version) {
+		p.log.Debug().Str("package", p.Package).Str("version", version).Msg("already installed")
+		return false, nil
+	}
+
+	p.log.Info().Str("package", p.Package).Str("installer", p.installer()).Msg("installing python tool")
+	spec := p.Package
+	if p.Version != "" {
+		spec += "==" + p.Version
+	}
+	args := []string{"install", "--force", spec}
+	if p.installer() == PipxInstallerUv {
+		args = append([]string{"tool"}, args...)
+	}
+	if _, stderr, err := conf.commandRunner().Run(ctx, p.binary(conf), args...); err != nil {
+		return false, fmt.Errorf("error installing package: %v\n%v", err, stderr)
+	}
+	return true, nil
+}
+
+func (p *PipxInstall) installer() string {
+	if p.Installer == "" {
+		return PipxInstallerPipx
+	}
+	return p.Installer
+}
+
+func (p *PipxInstall) binary(conf UserConfig) string {
+	name := p.installer()
+	return findTool(name, filepath.Join(conf.HomeDir, ".local", "bin", name), filepath.Join(conf.HomeDir, ".cargo", "bin", name))
+}
+
+// packageName is the package without any extras, i.e black[d] is black
+func (p *PipxInstall) packageName() string {
+	name, _, _ := strings.Cut(p.Package, "[")
+	return name
+}
+
+// installed returns the versions of the installed tools, keyed by their normalized name
+func (p *PipxInstall) installed(ctx context.Context, conf UserConfig) (map[string]string, error) {
+	args := []string{"list", "--json"}
+	if p.installer() == PipxInstallerUv {
+		args = []string{"tool", "list"}
+	}
+	stdout, stderr, err := conf.commandRunner().Run(ctx, p.binary(conf), args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing installed tools: %v\n%v", err, stderr)
+	}
+
+	if p.installer() == PipxInstallerUv {
+		return parseUvToolList(stdout), nil
+	}
+	return parsePipxList(stdout)
+}
+
+func normalizePythonName(name string) string {
+	return pythonNameSeparators.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// parsePipxList reads the package versions out of `pipx list --json`
+func parsePipxList(out string) (map[string]string, error) {
+	var list struct {
+		Venvs map[string]struct {
+			Metadata struct {
+				MainPackage struct {
+					Package        string `json:"package"`
+					PackageVersion string `json:"package_version"`
+				} `json:"main_package"`
+			} `json:"metadata"`
+		} `json:"venvs"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		return nil, fmt.Errorf("error parsing pipx list: %w", err)
+	}
+
+	installed := map[string]string{}
+	for _, venv := range list.Venvs {
+		pkg := venv.Metadata.MainPackage
+		installed[normalizePythonName(pkg.Package)] = pkg.PackageVersion
+	}
+	return installed, nil
+}
+
+// parseUvToolList reads the package versions out of `uv tool list`, which looks like
+//
+//	black v24.4.2
+//	- black
+//	- blackd
+func parseUvToolList(out string) map[string]string {
+	installed := map[string]string{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] == "-" {
+			continue
+		}
+		installed[normalizePythonName(fields[0])] = strings.TrimPrefix(fields[1], "v")
+	}
+	return installed
+}
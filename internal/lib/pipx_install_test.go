@@ -0,0 +1,88 @@
+package lib
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPipxList = `{
+  "pipx_spec_version": "0.1",
+  "venvs": {
+    "black": {
+      "metadata": {
+        "main_package": {"package": "black", "package_version": "24.4.2"}
+      }
+    },
+    "pre-commit": {
+      "metadata": {
+        "main_package": {"package": "Pre_Commit", "package_version": "3.7.1"}
+      }
+    }
+  }
+}`
+
+func TestParsePipxList(t *testing.T) {
+	installed, err := parsePipxList(testPipxList)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"black": "24.4.2", "pre-commit": "3.7.1"}, installed)
+}
+
+func TestParseUvToolList(t *testing.T) {
+	out := "black v24.4.2\n- black\n- blackd\nruff v0.4.8\n- ruff\n"
+	require.Equal(t, map[string]string{"black": "24.4.2", "ruff": "0.4.8"}, parseUvToolList(out))
+}
+
+func TestPipxInstallExecute(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	home := t.TempDir()
+
+	tcs := []struct {
+		name    string
+		install *PipxInstall
+		want    []string
+	}{
+		{
+			name:    "installed, with a differently spelt name",
+			install: &PipxInstall{Package: "pre.commit", Version: "3.7.1"},
+			want:    []string{"pipx list --json"},
+		},
+		{
+			name:    "extras are ignored for the installed check",
+			install: &PipxInstall{Package: "black[d]"},
+			want:    []string{"pipx list --json"},
+		},
+		{
+			name:    "different version",
+			install: &PipxInstall{Package: "black", Version: "24.8.0"},
+			want:    []string{"pipx list --json", "pipx install --force black==24.8.0"},
+		},
+		{
+			name:    "uv",
+			install: &PipxInstall{Package: "ruff", Installer: PipxInstallerUv},
+			want:    []string{"uv tool list", "uv tool install --force ruff"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+				"pipx list": func(args []string) (string, string, error) {
+					return testPipxList, "", nil
+				},
+			}}
+			conf := UserConfig{HomeDir: home, runner: runner}
+			changed, err := tc.install.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, runner.commands)
+			require.Equal(t, len(tc.want) > 1, changed)
+		})
+	}
+}
+
+func TestPipxInstallValidate(t *testing.T) {
+	require.ErrorContains(t, (&PipxInstall{}).Validate(), "package is required")
+	require.ErrorContains(t, (&PipxInstall{Package: "black==24.4.2"}).Validate(), "use version instead")
+	require.ErrorContains(t, (&PipxInstall{Package: "black", Installer: "pip"}).Validate(), "installer must be one of")
+	require.NoError(t, (&PipxInstall{Package: "black[d]", Installer: PipxInstallerUv}).Validate())
+}
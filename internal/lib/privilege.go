@@ -0,0 +1,63 @@
+package lib
+
+import (
+	"os"
+	"strings"
+
+	"github.com/samber/lo"
+)
+
+// How commands that need root are run
+const (
+	PrivilegeEscalationSudo = "sudo"
+	PrivilegeEscalationDoas = "doas"
+	// PrivilegeEscalationNone runs commands as is, for when godot is already running as root
+	PrivilegeEscalationNone = "none"
+	// PrivilegeEscalationSkip skips anything that would need root
+	PrivilegeEscalationSkip = "skip"
+)
+
+var validPrivilegeEscalations = []string{
+	PrivilegeEscalationSudo,
+	PrivilegeEscalationDoas,
+	PrivilegeEscalationNone,
+	PrivilegeEscalationSkip,
+}
+
+func isValidPrivilegeEscalation(s string) bool {
+	return lo.Contains(validPrivilegeEscalations, s)
+}
+
+// defaultPrivilegeEscalation is sudo, unless we're already root (i.e in a container) where sudo
+// often isn't installed
+func defaultPrivilegeEscalation() string {
+	if os.Geteuid() == 0 {
+		return PrivilegeEscalationNone
+	}
+	return PrivilegeEscalationSudo
+}
+
+// escalate wraps argv, which may start with environment assignments, so that it runs as root
+func (u UserConfig) escalate(argv ...string) (string, []string) {
+	// Only sudo understands leading environment assignments itself
+	hasEnv := strings.Contains(argv[0], "=")
+	switch u.PrivilegeEscalation {
+	case PrivilegeEscalationDoas:
+		if hasEnv {
+			argv = append([]string{"env"}, argv...)
+		}
+		return "doas", argv
+	case PrivilegeEscalationNone, PrivilegeEscalationSkip:
+		if hasEnv {
+			return "env", argv
+		}
+		return argv[0], argv[1:]
+	default:
+		return "sudo", argv
+	}
+}
+
+// canEscalate is false when anything needing root should be skipped
+func (u UserConfig) canEscalate() bool {
+	return u.PrivilegeEscalation != PrivilegeEscalationSkip
+}
@@ -0,0 +1,203 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/rs/zerolog"
+)
+
+const (
+	progressBarWidth   = 30
+	progressBarRefresh = 200 * time.Millisecond
+	progressLogRefresh = 5 * time.Second
+)
+
+// progress reports how far along a long running copy is. On a terminal it draws a progress bar,
+// otherwise it logs the byte count periodically. Nothing is reported for copies that finish before
+// the first refresh, so small files stay quiet
+type progress struct {
+	label    string
+	total    int64
+	current  int64
+	tty      bool
+	out      io.Writer
+	log      zerolog.Logger
+	enabled  bool
+	started  time.Time
+	last     time.Time
+	reported bool
+	mu       sync.Mutex
+}
+
+// newProgress creates a progress reporter for copying total bytes, or an unknown amount if total is
+// negative. Progress is only reported when the logger would show info messages
+func newProgress(label string, total int64, logger zerolog.Logger) *progress {
+	now := time.Now()
+	return &progress{
+		label:   label,
+		total:   total,
+		tty:     isTerminal(os.Stderr),
+		out:     os.Stderr,
+		log:     logger,
+		enabled: logger.GetLevel() <= zerolog.InfoLevel,
+		started: now,
+		last:    now,
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.current += int64(len(b))
+	if !p.enabled {
+		return len(b), nil
+	}
+
+	refresh := progressLogRefresh
+	if p.tty {
+		refresh = progressBarRefresh
+	}
+	if now := time.Now(); now.Sub(p.last) >= refresh {
+		p.last = now
+		p.report()
+	}
+	return len(b), nil
+}
+
+// Done finishes the progress report, terminating the progress bar if one was drawn
+func (p *progress) Done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.reported {
+		return
+	}
+	if p.tty {
+		p.report()
+		fmt.Fprintln(p.out)
+		return
+	}
+	p.log.Info().Str("name", p.label).Str("size", FormatBytes(p.current)).Dur("took", time.Since(p.started).Round(time.Millisecond)).Msg("finished")
+}
+
+func (p *progress) report() {
+	p.reported = true
+	if !p.tty {
+		event := p.log.Info().Str("name", p.label).Str("done", FormatBytes(p.current))
+		if p.total > 0 {
+			event = event.Str("total", FormatBytes(p.total)).Str("percent", fmt.Sprintf("%.0f%%", p.percent()*100))
+		}
+		event.Msg("in progress")
+		return
+	}
+
+	if p.total <= 0 {
+		fmt.Fprintf(p.out, "\r%v %v", p.label, FormatBytes(p.current))
+		return
+	}
+	filled := int(p.percent() * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	fmt.Fprintf(p.out, "\r%v [%v] %v / %v %3.0f%%", p.label, bar, FormatBytes(p.current), FormatBytes(p.total), p.percent()*100)
+}
+
+func (p *progress) percent() float64 {
+	if p.total <= 0 {
+		return 0
+	}
+	pct := float64(p.current) / float64(p.total)
+	if pct > 1 {
+		pct = 1
+	}
+	return pct
+}
+
+// FormatBytes formats n as a human readable size, i.e 1.5 MiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// toFileWithProgress is requests.ToFile, reporting progress as the body is written
+func toFileWithProgress(dest string, label string, logger zerolog.Logger) requests.ResponseHandler {
+	return func(res *http.Response) error {
+		f, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		p := newProgress(label, res.ContentLength, logger)
+		defer p.Done()
+		if _, err := io.Copy(io.MultiWriter(f, p), res.Body); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+}
+
+// progressFile reports progress as a file is read. It supports random access so that formats such
+// as zip can still be read through it
+type progressFile struct {
+	file     *os.File
+	progress *progress
+}
+
+// openWithProgress opens path for reading, reporting progress against its size. Done must be called
+// once reading is finished
+func openWithProgress(path string, label string, logger zerolog.Logger) (*progressFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var size int64 = -1
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return &progressFile{file: f, progress: newProgress(label, size, logger)}, nil
+}
+
+func (p *progressFile) Read(b []byte) (int, error) {
+	n, err := p.file.Read(b)
+	_, _ = p.progress.Write(b[:n])
+	return n, err
+}
+
+func (p *progressFile) ReadAt(b []byte, off int64) (int, error) {
+	n, err := p.file.ReadAt(b, off)
+	_, _ = p.progress.Write(b[:n])
+	return n, err
+}
+
+func (p *progressFile) Seek(offset int64, whence int) (int64, error) {
+	return p.file.Seek(offset, whence)
+}
+
+// Done finishes the progress report and closes the file
+func (p *progressFile) Done() error {
+	p.progress.Done()
+	return p.file.Close()
+}
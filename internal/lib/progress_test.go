@@ -0,0 +1,91 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "512 B", FormatBytes(512))
+	require.Equal(t, "1.5 KiB", FormatBytes(1536))
+	require.Equal(t, "50.0 MiB", FormatBytes(50*1024*1024))
+}
+
+func TestProgress(t *testing.T) {
+	// stale makes the next write report, rather than waiting for the refresh interval
+	stale := func(p *progress) {
+		p.last = time.Now().Add(-time.Hour)
+	}
+
+	t.Run("bar on a terminal", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		p := newProgress("downloading nvim.tar.gz", 100, zerolog.New(out).Level(zerolog.InfoLevel))
+		p.tty = true
+		p.out = out
+
+		stale(p)
+		_, _ = p.Write(make([]byte, 50))
+		require.Contains(t, out.String(), "downloading nvim.tar.gz [===============               ] 50 B / 100 B  50%")
+
+		_, _ = p.Write(make([]byte, 50))
+		p.Done()
+		require.True(t, strings.HasSuffix(out.String(), "100 B / 100 B 100%\n"))
+	})
+
+	t.Run("log lines otherwise", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		p := newProgress("downloading go.tar.gz", 2048, zerolog.New(out).Level(zerolog.InfoLevel))
+		p.tty = false
+
+		stale(p)
+		_, _ = p.Write(make([]byte, 1024))
+		p.Done()
+		require.Contains(t, out.String(), `"done":"1.0 KiB","total":"2.0 KiB","percent":"50%","message":"in progress"`)
+		require.Contains(t, out.String(), `"message":"finished"`)
+	})
+
+	t.Run("quick copies are silent", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		p := newProgress("downloading tool", 10, zerolog.New(out).Level(zerolog.InfoLevel))
+		p.tty = false
+		_, _ = p.Write(make([]byte, 10))
+		p.Done()
+		require.Empty(t, out.String())
+	})
+
+	t.Run("disabled below info", func(t *testing.T) {
+		out := new(bytes.Buffer)
+		p := newProgress("downloading tool", 10, zerolog.New(out).Level(zerolog.WarnLevel))
+		p.tty = true
+		p.out = out
+		stale(p)
+		_, _ = p.Write(make([]byte, 10))
+		p.Done()
+		require.Empty(t, out.String())
+	})
+}
+
+func TestToFileWithProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("some content"))
+	}))
+	defer srv.Close()
+
+	dest := filepath.Join(t.TempDir(), "out")
+	err := requests.
+		URL(srv.URL).
+		Handle(toFileWithProgress(dest, "downloading out", zerolog.Nop())).
+		Fetch(context.Background())
+	require.NoError(t, err)
+	requireContents(t, dest, "some content")
+}
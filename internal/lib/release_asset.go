@@ -0,0 +1,295 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+)
+
+var (
+	regexMusl     = regexp.MustCompile("(?i)musl")
+	regexLinuxPkg = regexp.MustCompile(`(?i)(\.deb|\.rpm|\.apk)$`)
+
+	osRegexMap = map[string]*regexp.Regexp{
+		"windows": regexp.MustCompile(`(?i)(windows|win)`),
+		"linux":   regexp.MustCompile("(?i)linux"),
+		"darwin":  regexp.MustCompile(`(?i)(darwin|mac(os)?|apple|osx)`),
+	}
+
+	archRegexMap = map[string]*regexp.Regexp{
+		"386":   regexp.MustCompile(`(?i)(i?386|x86_32|amd32|x32)`),
+		"amd64": regexp.MustCompile(`(?i)(x86_64|amd64|x64)`),
+		"arm64": regexp.MustCompile(`(?i)(arm64|aarch64)`),
+	}
+)
+
+type release struct {
+	Name        string `json:"name"`
+	DownloadUrl string `json:"browser_download_url"`
+	Url         string `json:"url"`
+	// Sha256 is only known for some sources, i.e the go release feed
+	Sha256 string `json:"sha256,omitempty"`
+}
+
+// releaseForge is implemented by anything that hosts releases with downloadable assets. Asset
+// selection, downloading and symlinking are shared, so a new forge only needs to know how to talk
+// to its own API
+type releaseForge interface {
+	latestTag(ctx context.Context, conf UserConfig) (string, error)
+	assetsForTag(ctx context.Context, conf UserConfig, tag string) ([]release, error)
+	// downloadRequestFunc prepares the request for the asset at url. Assets aren't always hosted by
+	// the forge itself, so credentials should only be attached for the forge's own host
+	downloadRequestFunc(conf UserConfig, url string) func(*requests.Builder)
+}
+
+// releaseCommon is the configuration shared by every release executor. Selecting, downloading and
+// installing the asset is the same for all of them, only finding it differs between forges
+type releaseCommon struct {
+	Name            string                       `yaml:"-"`
+	Tag             string                       `yaml:"tag" mapstructure:"tag"`
+	Regex           string                       `yaml:"regex" mapstructure:"regex"`
+	ApiUrl          string                       `yaml:"api-url" mapstructure:"api-url"`
+	AssetPatterns   map[string]map[string]string `yaml:"asset-patterns" mapstructure:"asset-patterns"`
+	Binaries        []Binary                     `yaml:"binaries" mapstructure:"binaries"`
+	InstallMode     string                       `yaml:"install-mode" mapstructure:"install-mode"`
+	StripComponents int                          `yaml:"strip-components" mapstructure:"strip-components"`
+	Links           []string                     `yaml:"links" mapstructure:"links"`
+	log             zerolog.Logger               `yaml:"-"`
+}
+
+func (r *releaseCommon) SetLogger(log zerolog.Logger) {
+	r.log = log
+}
+
+func (r *releaseCommon) GetName() string {
+	return r.Name
+}
+
+func (r *releaseCommon) SetName(n string) {
+	r.Name = n
+}
+
+func (r *releaseCommon) recordGeneration(conf UserConfig, gen *Generation) error {
+	return gen.addInstall(conf, r.installSpec(), r.Tag)
+}
+
+func (r *releaseCommon) installSpec() installSpec {
+	return installSpec{
+		Name:            r.Name,
+		Regex:           r.Regex,
+		Binaries:        r.Binaries,
+		InstallMode:     r.InstallMode,
+		StripComponents: r.StripComponents,
+		Links:           r.Links,
+	}
+}
+
+func (r *releaseCommon) selector() assetSelector {
+	return assetSelector{
+		AssetPatterns: r.AssetPatterns,
+		log:           r.log,
+	}
+}
+
+// validate checks everything but the forge specific fields, which are left to the embedding type
+func (r *releaseCommon) validate() error {
+	var errs *multierror.Error
+
+	if r.Tag == "" {
+		errs = multierror.Append(errs, fmt.Errorf("tag is required"))
+	}
+	if r.Regex != "" {
+		_, err := regexp.Compile(r.Regex)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("unable to compile regex: %w", err))
+		}
+	}
+	if err := r.installSpec().Validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// resolve determines the asset to install from forge, pinning Tag to the concrete tag it came from
+func (r *releaseCommon) resolve(ctx context.Context, conf UserConfig, forge releaseForge) (release, error) {
+	tag, asset, err := resolveReleaseAsset(ctx, conf, forge, r.Name, r.Tag, r.selector())
+	if err != nil {
+		return release{}, fmt.Errorf("error determining release: %w", err)
+	}
+	r.Tag = tag
+	return asset, nil
+}
+
+func (r *releaseCommon) execute(ctx context.Context, conf UserConfig, opts SyncOpts, forge releaseForge) (bool, error) {
+	r.log.Info().Str("release", r.Name).Msg("ensuring release")
+	asset, err := r.resolve(ctx, conf, forge)
+	if err != nil {
+		return false, err
+	}
+	return installReleaseAsset(ctx, conf, opts, forge, r.installSpec(), r.Tag, asset, r.log)
+}
+
+func (r *releaseCommon) export(ctx context.Context, conf UserConfig, forge releaseForge, w *bundleWriter) error {
+	return exportReleaseAsset(ctx, conf, forge, r.Name, r.Tag, r.selector(), w)
+}
+
+// resolveReleaseAsset determines the concrete tag (resolving LATEST) and the asset to download for
+// the current platform. When syncing offline, the decision made at export time is used instead
+func resolveReleaseAsset(ctx context.Context, conf UserConfig, forge releaseForge, name string, tag string, selector assetSelector) (string, release, error) {
+	if conf.offline != nil {
+		return conf.offline.release(name)
+	}
+
+	if tag == Latest {
+		latest, err := forge.latestTag(ctx, conf)
+		if err != nil {
+			return "", release{}, fmt.Errorf("error determining latest release: %w", err)
+		}
+		tag = latest
+	}
+
+	assets, err := forge.assetsForTag(ctx, conf, tag)
+	if err != nil {
+		return "", release{}, err
+	}
+
+	asset, err := selector.selectAsset(assets, runtime.GOOS, runtime.GOARCH)
+	if err != nil {
+		return "", release{}, fmt.Errorf("error determing asset: %w", err)
+	}
+	return tag, asset, nil
+}
+
+// installReleaseAsset installs the given asset of a release according to spec, reporting whether
+// anything changed
+func installReleaseAsset(ctx context.Context, conf UserConfig, opts SyncOpts, forge releaseForge, spec installSpec, tag string, asset release, log zerolog.Logger) (bool, error) {
+	return installDownload(ctx, conf, opts, spec, tag, asset.Url, path.Base(asset.DownloadUrl), forge.downloadRequestFunc(conf, asset.Url), log)
+}
+
+// exportReleaseAsset resolves a release and downloads its asset into an offline bundle
+func exportReleaseAsset(ctx context.Context, conf UserConfig, forge releaseForge, name string, tag string, selector assetSelector, w *bundleWriter) error {
+	tag, asset, err := resolveReleaseAsset(ctx, conf, forge, name, tag, selector)
+	if err != nil {
+		return fmt.Errorf("error determining release: %w", err)
+	}
+	w.addRelease(name, tag, asset)
+	return w.addDownload(ctx, asset.Url, tag, path.Base(asset.DownloadUrl), forge.downloadRequestFunc(conf, asset.Url))
+}
+
+// assetSelector picks the single asset of a release that's appropriate for a given OS &
+// architecture, either through user specified patterns or through auto detection
+type assetSelector struct {
+	AssetPatterns map[string]map[string]string
+	log           zerolog.Logger
+}
+
+func (a assetSelector) userPattern(userOs string, userArch string) string {
+	if osPatterns, ok := a.AssetPatterns[userOs]; ok {
+		if archPattern, ok := osPatterns[userArch]; ok {
+			return archPattern
+		}
+	}
+	return ""
+}
+
+// TODO: reduce the complexity of this function
+//
+//nolint:gocyclo
+func (a assetSelector) selectAsset(allAssets []release, userOs string, userArch string) (release, error) {
+	// Try to lookup a specific pattern, if its available
+	pat := a.userPattern(userOs, userArch)
+
+	if pat != "" {
+		a.log.Debug().Str("pattern", pat).Msg("using user specified pattern")
+		userRegex, err := regexp.Compile(pat)
+		if err != nil {
+			return release{}, fmt.Errorf("error compiling user specified regex: %v", err)
+		}
+		assets := a.filterAssets(allAssets, userRegex, true)
+		if len(assets) != 1 {
+			return release{}, fmt.Errorf("expected 1 matching asset for pattern %v, got %v", pat, len(assets))
+		}
+
+		return assets[0], nil
+	}
+
+	noMatchErr := func(matchType string) (release, error) {
+		return release{}, fmt.Errorf("enable to auto detect release name, no assets match pre-defined patterns for %v", matchType)
+	}
+
+	// Otherwise, lets try to detect it
+	osPat, ok := osRegexMap[userOs]
+	if !ok {
+		return release{}, fmt.Errorf("unsupported OS of %v", userOs)
+	}
+	assets := a.filterAssets(allAssets, osPat, true)
+	if len(assets) == 0 {
+		return noMatchErr("OS")
+	}
+	if len(assets) == 1 {
+		// If there's only one matching asset by OS, then we're done here
+		a.log.Debug().Str("asset", assets[0].Name).Msg("reached a single asset after OS matching")
+		return assets[0], nil
+	}
+
+	// If we're got more than 1, then lets try to narrow it down by architecture
+	archPat, ok := archRegexMap[userArch]
+	if !ok {
+		return release{}, fmt.Errorf("unsupported architecture of %v", userArch)
+	}
+	assets = a.filterAssets(assets, archPat, true)
+	if len(assets) == 0 {
+		return noMatchErr("architecture")
+	}
+	if len(assets) == 1 {
+		// If there's only one, then we're done here
+		a.log.Debug().Str("asset", assets[0].Name).Msg("reached a single asset after architecture matching")
+		return assets[0], nil
+	}
+
+	// If we're not linux, then I don't have any more tricks up my sleeve
+	if userOs != "linux" {
+		return release{}, fmt.Errorf("unable to auto-detect release asset, please specify an OS/Arch pattern")
+	}
+
+	// But if we are, lets filter off any non-MUSL or deb/rpm
+	assets = a.filterAssets(assets, regexLinuxPkg, false)
+	if len(assets) == 0 {
+		return noMatchErr("non linux packages")
+	}
+	if len(assets) == 1 {
+		a.log.Debug().Str("asset", assets[0].Name).Msg("reached a single asset after package filtering")
+		return assets[0], nil
+	}
+
+	// If we've still got multiples, prefer statically linked binaries
+	assets = a.filterAssets(assets, regexMusl, true)
+	if len(assets) == 0 {
+		return noMatchErr("musl static linking")
+	}
+	if len(assets) == 1 {
+		// If there's only one, then we're done here
+		a.log.Debug().Str("asset", assets[0].Name).Msg("reached a single asset after musl filtering")
+		return assets[0], nil
+	}
+
+	return release{}, fmt.Errorf("enable to auto-detect release asset, please specify an OS/Arch pattern")
+}
+
+func (a assetSelector) filterAssets(assets []release, pat *regexp.Regexp, match bool) []release {
+	matches := []release{}
+	for _, r := range assets {
+		if pat.MatchString(r.Name) == match {
+			matches = append(matches, r)
+		}
+	}
+
+	return matches
+}
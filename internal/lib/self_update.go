@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rs/zerolog"
@@ -12,37 +13,38 @@ type SelfUpdateOpts struct {
 	IgnoreVault bool
 }
 
-func SelfUpdate(opts SelfUpdateOpts) error {
+func SelfUpdate(ctx context.Context, opts SelfUpdateOpts) error {
 	conf, err := NewOverrideableConfig(ConfigOverrides{
 		IgnoreVault: opts.IgnoreVault,
 	})
 	if err != nil {
 		return fmt.Errorf("error getting config: %w", err)
 	}
-	return selfUpdateWithConfig(conf, opts.CurrentVersion, opts.Logger)
+	return selfUpdateWithConfig(ctx, conf, opts.CurrentVersion, opts.Logger)
 }
 
-func selfUpdateWithConfig(conf UserConfig, currentVersion string, logger zerolog.Logger) error {
+func selfUpdateWithConfig(ctx context.Context, conf UserConfig, currentVersion string, logger zerolog.Logger) error {
 	godot := GithubRelease{
-		Name:           "godot",
-		Repo:           "nicjohnson145/godot",
-		IsArchive:      false,
-		AssetPatterns: map[string]map[string]string{
-			"darwin": {
-				"amd64": "^godot_darwin_amd64$",
-				"arm64": "^godot_darwin_arm64$",
-			},
-			"linux": {
-				"amd64": "^godot_linux_amd64$",
-				"arm64": "^godot_linux_arm64$",
-			},
-			"windows": {
-				"amd64": "^godot_windows_amd64.exe$",
+		releaseCommon: releaseCommon{
+			Name: "godot",
+			AssetPatterns: map[string]map[string]string{
+				"darwin": {
+					"amd64": "^godot_darwin_amd64$",
+					"arm64": "^godot_darwin_arm64$",
+				},
+				"linux": {
+					"amd64": "^godot_linux_amd64$",
+					"arm64": "^godot_linux_arm64$",
+				},
+				"windows": {
+					"amd64": "^godot_windows_amd64.exe$",
+				},
 			},
 		},
+		Repo: "nicjohnson145/godot",
 	}
 
-	latest, err := godot.GetLatestRelease(conf)
+	latest, err := godot.GetLatestRelease(ctx, conf)
 	if err != nil {
 		return fmt.Errorf("error determining latest release: %w", err)
 	}
@@ -55,7 +57,7 @@ func selfUpdateWithConfig(conf UserConfig, currentVersion string, logger zerolog
 
 	logger.Info().Str("version", latest).Msg("newer version found, updating")
 	godot.Tag = "v" + latest
-	if err := godot.Execute(conf, SyncOpts{}, GodotConfig{}); err != nil {
+	if _, err := godot.Execute(ctx, conf, SyncOpts{}, GodotConfig{}); err != nil {
 		return fmt.Errorf("error executing self update: %w", err)
 	}
 	return nil
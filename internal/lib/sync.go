@@ -1,6 +1,7 @@
 package lib
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/rs/zerolog"
@@ -8,10 +9,15 @@ import (
 )
 
 type SyncOpts struct {
-	Quick     bool
-	Ignore    []string
-	NoVault   bool
-	Executors []string
+	Quick      bool
+	Ignore     []string
+	NoVault    bool
+	Executors  []string
+	FromBundle string
+	// NoRollback leaves the changes made by executors that ran before a failure in place
+	NoRollback bool
+
+	journal *journal
 }
 
 func (s *SyncOpts) Validate() error {
@@ -23,17 +29,32 @@ func (s *SyncOpts) Validate() error {
 	return nil
 }
 
-func Sync(opts SyncOpts, logger zerolog.Logger) error {
+func Sync(ctx context.Context, opts SyncOpts, logger zerolog.Logger) error {
 	if err := opts.Validate(); err != nil {
 		return err
 	}
 	conf, err := NewOverrideableConfig(ConfigOverrides{
-		IgnoreVault: opts.NoVault,
+		// Any vault values needed offline were captured in the bundle
+		IgnoreVault: opts.NoVault || opts.FromBundle != "",
 	})
 	if err != nil {
 		return fmt.Errorf("error getting config: %w", err)
 	}
+
+	if opts.FromBundle != "" {
+		bundle, cleanup, err := openBundle(ctx, opts.FromBundle, logger)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		conf, opts, err = bundle.apply(conf, opts, logger)
+		if err != nil {
+			return err
+		}
+	}
+
 	return syncFromConf(
+		ctx,
 		conf,
 		opts,
 		logger,
@@ -48,7 +69,9 @@ func executorsFromOpts(opts SyncOpts) []ExecutorType {
 		executorStrings = ExecutorTypeNames()
 	}
 	if opts.Quick {
-		executorStrings = lo.Filter(executorStrings, func(s string, _ int) bool { return s != ExecutorTypeSysPackage.String() })
+		executorStrings = lo.Filter(executorStrings, func(s string, _ int) bool {
+			return s != ExecutorTypeSysPackage.String() && s != ExecutorTypePackageRepo.String()
+		})
 	}
 
 	return lo.Map(executorStrings, func(s string, _ int) ExecutorType {
@@ -61,8 +84,9 @@ func executorsFromOpts(opts SyncOpts) []ExecutorType {
 	})
 }
 
-func syncFromConf(userConf UserConfig, opts SyncOpts, logger zerolog.Logger) error {
-	if err := ensureDotfilesRepo(userConf, logger); err != nil {
+func syncFromConf(ctx context.Context, userConf UserConfig, opts SyncOpts, logger zerolog.Logger) error {
+	useHttpClientForGit(userConf.downloadClient())
+	if err := ensureDotfilesRepo(ctx, userConf, logger); err != nil {
 		return fmt.Errorf("error ensuring dotfiles repo: %w", err)
 	}
 	godotConf, err := NewGodotConfigFromUserConfig(userConf)
@@ -74,35 +98,84 @@ func syncFromConf(userConf UserConfig, opts SyncOpts, logger zerolog.Logger) err
 		return fmt.Errorf("error fetching target configuration: %w", err)
 	}
 	executorTypes := executorsFromOpts(opts)
+	// Package repos are needed by the system packages being installed, even when only sys-packages
+	// were asked for
+	requiredRepos := packageRepoNames(lo.Filter(executors, func(ex Executor, _ int) bool {
+		return lo.Contains(executorTypes, ex.Type()) && !lo.Contains(opts.Ignore, ex.GetName())
+	}))
 
+	selected := []Executor{}
 	for _, ex := range executors {
 		if lo.Contains(opts.Ignore, ex.GetName()) {
 			logger.Debug().Str("name", ex.GetName()).Msg("ignoring due to command line arg")
 			continue
 		}
-		if !lo.Contains(executorTypes, ex.Type()) {
+		if !lo.Contains(executorTypes, ex.Type()) && !lo.Contains(requiredRepos, ex.GetName()) {
 			logger.Debug().Str("name", ex.GetName()).Msg("ignoring due to command line arg")
 			continue
 		}
+		if userConf.offline != nil && lo.Contains(networkExecutorTypes, ex.Type()) {
+			logger.Warn().Str("name", ex.GetName()).Msg("skipping, requires network access")
+			continue
+		}
+		selected = append(selected, ex)
+	}
+	selected = batchSystemPackages(selected)
+
+	if !opts.NoRollback {
+		j, err := newJournal(logger)
+		if err != nil {
+			return err
+		}
+		defer j.close()
+		opts.journal = j
+	}
 
+	for i, ex := range selected {
+		if err := ctx.Err(); err != nil {
+			return rollbackSync(opts, fmt.Errorf("sync interrupted before %v: %w", ex.GetName(), err), logger)
+		}
+		logger.Info().Str("name", ex.GetName()).Str("type", ex.Type().String()).Msgf("executor %v/%v", i+1, len(selected))
 		ex.SetLogger(logger)
-		if err := ex.Execute(userConf, opts, godotConf); err != nil {
-			return fmt.Errorf("error during execution of %v: %w", ex.GetName(), err)
+		if err := executeWithHooks(ctx, ex, userConf, opts, godotConf, logger); err != nil {
+			return rollbackSync(opts, fmt.Errorf("error during execution of %v: %w", ex.GetName(), err), logger)
 		}
 	}
 
+	// Generations are for rolling back, don't fail an otherwise successful sync over one
+	if err := recordGeneration(userConf, selected, executors, logger); err != nil {
+		logger.Warn().Err(err).Msg("unable to record generation")
+	}
+
 	return nil
 }
 
-func ensureDotfilesRepo(conf UserConfig, logger zerolog.Logger) error {
-	dotfiles := GitRepo{
+// rollbackSync undoes the changes made by the executors that ran before err, returning err along
+// with anything that couldn't be rolled back
+func rollbackSync(opts SyncOpts, err error, logger zerolog.Logger) error {
+	if opts.journal == nil {
+		return err
+	}
+	logger.Warn().Err(err).Msg("sync failed, rolling back changes")
+	if rbErr := opts.journal.rollback(); rbErr != nil {
+		return fmt.Errorf("%w (rollback also failed: %v)", err, rbErr)
+	}
+	return err
+}
+
+func dotfilesRepo(conf UserConfig) GitRepo {
+	return GitRepo{
 		URL:         conf.DotfilesURL,
 		Location:    conf.CloneLocation,
 		Private:     true,
 		TrackLatest: true,
 	}
+}
+
+func ensureDotfilesRepo(ctx context.Context, conf UserConfig, logger zerolog.Logger) error {
+	dotfiles := dotfilesRepo(conf)
 	dotfiles.SetLogger(logger)
-	if err := dotfiles.Execute(conf, SyncOpts{}, GodotConfig{}); err != nil {
+	if _, err := dotfiles.Execute(ctx, conf, SyncOpts{}, GodotConfig{}); err != nil {
 		return fmt.Errorf("error ensuring dotfiles repo: %w", err)
 	}
 	return nil
@@ -26,6 +26,15 @@ func TestExecutorsFromOpts(t *testing.T) {
 				ExecutorTypeGoInstall,
 				ExecutorTypeConfigDir,
 				ExecutorTypeNeovim,
+				ExecutorTypeGitlabRelease,
+				ExecutorTypeGiteaRelease,
+				ExecutorTypePackageRepo,
+				ExecutorTypeCargoInstall,
+				ExecutorTypePipxInstall,
+				ExecutorTypeNpmGlobal,
+				ExecutorTypeCommand,
+				ExecutorTypeSystemdUserUnit,
+				ExecutorTypeCron,
 			},
 		},
 		{
@@ -56,6 +65,14 @@ func TestExecutorsFromOpts(t *testing.T) {
 				ExecutorTypeGoInstall,
 				ExecutorTypeConfigDir,
 				ExecutorTypeNeovim,
+				ExecutorTypeGitlabRelease,
+				ExecutorTypeGiteaRelease,
+				ExecutorTypeCargoInstall,
+				ExecutorTypePipxInstall,
+				ExecutorTypeNpmGlobal,
+				ExecutorTypeCommand,
+				ExecutorTypeSystemdUserUnit,
+				ExecutorTypeCron,
 			},
 		},
 	}
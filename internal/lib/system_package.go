@@ -1,7 +1,14 @@
 package lib
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+	"strings"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
@@ -9,26 +16,111 @@ import (
 )
 
 const (
-	PackageManagerApt  = "apt"
-	PackageManagerBrew = "brew"
+	PackageManagerApt    = "apt"
+	PackageManagerBrew   = "brew"
+	PackageManagerDnf    = "dnf"
+	PackageManagerYum    = "yum"
+	PackageManagerPacman = "pacman"
+	PackageManagerApk    = "apk"
+	PackageManagerZypper = "zypper"
+	PackageManagerNix    = "nix"
 )
 
 var validPackageManagers = []string{
 	PackageManagerApt,
 	PackageManagerBrew,
+	PackageManagerDnf,
+	PackageManagerYum,
+	PackageManagerPacman,
+	PackageManagerApk,
+	PackageManagerZypper,
+	PackageManagerNix,
 }
 
 func isValidPackageManager(s string) bool {
 	return lo.Contains(validPackageManagers, s)
 }
 
+// osReleasePath is where the distribution is read from when detecting the package manager
+var osReleasePath = "/etc/os-release"
+
+// detectPackageManager picks the package manager for the current machine, falling back to apt on
+// linux distributions that aren't recognized
+func detectPackageManager() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return PackageManagerBrew
+	case "linux":
+		b, err := os.ReadFile(osReleasePath)
+		if err != nil {
+			return PackageManagerApt
+		}
+		return packageManagerForOsRelease(string(b), func(bin string) bool {
+			_, err := exec.LookPath(bin)
+			return err == nil
+		})
+	}
+	return ""
+}
+
+// packageManagerForOsRelease picks the package manager from the contents of /etc/os-release, based
+// on the distribution's ID or the distributions it's like
+func packageManagerForOsRelease(contents string, installed func(bin string) bool) string {
+	fields := parseOsRelease(contents)
+	ids := append([]string{fields["ID"]}, strings.Fields(fields["ID_LIKE"])...)
+	for _, id := range ids {
+		switch {
+		case id == "debian" || id == "ubuntu":
+			return PackageManagerApt
+		case id == "fedora" || id == "rhel" || id == "centos":
+			// Older RHEL derivatives only have yum
+			if !installed(PackageManagerDnf) && installed(PackageManagerYum) {
+				return PackageManagerYum
+			}
+			return PackageManagerDnf
+		case id == "arch":
+			return PackageManagerPacman
+		case id == "alpine":
+			return PackageManagerApk
+		case id == "suse" || strings.HasPrefix(id, "opensuse") || id == "sles":
+			return PackageManagerZypper
+		case id == "nixos":
+			return PackageManagerNix
+		}
+	}
+	return PackageManagerApt
+}
+
+func parseOsRelease(contents string) map[string]string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(contents, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		fields[key] = strings.Trim(value, `"'`)
+	}
+	return fields
+}
+
 var _ Executor = (*SystemPackage)(nil)
 
 type SystemPackage struct {
-	Name     string         `yaml:"-"`
-	AptName  string         `yaml:"apt" mapstructure:"apt"`
-	BrewName string         `yaml:"brew" mapstructure:"brew"`
-	log      zerolog.Logger `yaml:"-"`
+	Name       string            `yaml:"-"`
+	AptName    string            `yaml:"apt" mapstructure:"apt"`
+	BrewName   string            `yaml:"brew" mapstructure:"brew"`
+	DnfName    string            `yaml:"dnf" mapstructure:"dnf"`
+	YumName    string            `yaml:"yum" mapstructure:"yum"`
+	PacmanName string            `yaml:"pacman" mapstructure:"pacman"`
+	AurName    string            `yaml:"aur" mapstructure:"aur"`
+	ApkName    string            `yaml:"apk" mapstructure:"apk"`
+	ZypperName string            `yaml:"zypper" mapstructure:"zypper"`
+	NixName    string            `yaml:"nix" mapstructure:"nix"`
+	Repo       string            `yaml:"repo" mapstructure:"repo"`
+	Versions   map[string]string `yaml:"versions" mapstructure:"versions"`
+	Absent     bool              `yaml:"absent" mapstructure:"absent"`
+	Hold       *bool             `yaml:"hold" mapstructure:"hold"`
+	log        zerolog.Logger    `yaml:"-"`
 }
 
 func (s *SystemPackage) SetLogger(log zerolog.Logger) {
@@ -42,61 +134,608 @@ func (s *SystemPackage) Type() ExecutorType {
 func (s *SystemPackage) Validate() error {
 	var errs *multierror.Error
 
-	if s.AptName == "" && s.BrewName == "" {
-		errs = multierror.Append(errs, fmt.Errorf("one of apt or brew is required"))
+	if lo.EveryBy(validPackageManagers, func(m string) bool { return s.nameFor(m) == "" }) && s.AurName == "" {
+		errs = multierror.Append(errs, fmt.Errorf("one of %v or aur is required", strings.Join(validPackageManagers, ", ")))
+	}
+	for manager := range s.Versions {
+		if !lo.Contains(versionedPackageManagers, manager) {
+			errs = multierror.Append(errs, fmt.Errorf("versions: cannot pin versions for %v, only %v", manager, strings.Join(versionedPackageManagers, ", ")))
+		}
+	}
+	if s.Absent && len(s.Versions) > 0 {
+		errs = multierror.Append(errs, fmt.Errorf("versions cannot be pinned for an absent package"))
+	}
+	if s.Hold != nil && s.AptName == "" {
+		errs = multierror.Append(errs, fmt.Errorf("hold is only supported for apt"))
 	}
 
 	return errs.ErrorOrNil()
 }
 
-func (s *SystemPackage) Execute(conf UserConfig, _ SyncOpts, _ GodotConfig) error {
-	if conf.PackageManager == "" {
-		return fmt.Errorf("eackage manager not configured, cannot install system packages")
+// Execute installs just this package. During a sync, packages are installed together by a
+// systemPackageBatch instead
+func (s *SystemPackage) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
+	batch := newSystemPackageBatch([]*SystemPackage{s})
+	batch.SetLogger(s.log)
+	return batch.Execute(ctx, conf, opts, godotConf)
+}
+
+func (s *SystemPackage) GetName() string {
+	return s.Name
+}
+
+func (s *SystemPackage) SetName(n string) {
+	s.Name = n
+}
+
+// nameFor is the name of the package for the given package manager. dnf & yum share a package
+// repository, so either name is used for both
+func (s *SystemPackage) nameFor(manager string) string {
+	switch manager {
+	case PackageManagerApt:
+		return s.AptName
+	case PackageManagerBrew:
+		return s.BrewName
+	case PackageManagerDnf:
+		return lo.Ternary(s.DnfName != "", s.DnfName, s.YumName)
+	case PackageManagerYum:
+		return lo.Ternary(s.YumName != "", s.YumName, s.DnfName)
+	case PackageManagerPacman:
+		return s.PacmanName
+	case PackageManagerApk:
+		return s.ApkName
+	case PackageManagerZypper:
+		return s.ZypperName
+	case PackageManagerNix:
+		return s.NixName
+	}
+	return ""
+}
+
+// packageRef resolves the package to install with the configured package manager
+func (s *SystemPackage) packageRef(conf UserConfig) (packageRef, error) {
+	manager := conf.PackageManager
+	if !isValidPackageManager(manager) {
+		return packageRef{}, fmt.Errorf("unknown package manager %v", manager)
+	}
+
+	name := s.nameFor(manager)
+	// Packages only in the AUR go through a helper, which handles privilege escalation itself
+	if manager == PackageManagerPacman && name == "" && s.AurName != "" {
+		if conf.AurHelper == "" {
+			return packageRef{}, fmt.Errorf("%v is only in the AUR, but no aur-helper is configured", s.AurName)
+		}
+		return packageRef{executor: s.GetName(), manager: packageManagerAur, name: s.AurName, absent: s.Absent}, nil
+	}
+	if name == "" {
+		return packageRef{}, fmt.Errorf("no configured name for %v", manager)
+	}
+	if manager == PackageManagerNix && !strings.Contains(name, "#") {
+		// Bare names are assumed to come from nixpkgs
+		name = "nixpkgs#" + name
+	}
+
+	ref := packageRef{executor: s.GetName(), manager: manager, name: name, absent: s.Absent}
+	version := s.Versions[manager]
+	if manager == PackageManagerBrew && version != "" {
+		// Versioned formulae are packages in their own right
+		ref.name = name + "@" + version
+	} else {
+		ref.version = version
 	}
+	if manager == PackageManagerApt {
+		ref.hold = s.Hold
+	}
+	return ref, nil
+}
+
+// privilegedPackageManagers are the package managers that need root. AUR helpers escalate themselves
+var privilegedPackageManagers = []string{
+	PackageManagerApt,
+	PackageManagerDnf,
+	PackageManagerYum,
+	PackageManagerPacman,
+	PackageManagerApk,
+	PackageManagerZypper,
+}
 
-	s.log.Info().Str("name", s.GetName()).Msg("installing")
-	var err error
-	switch conf.PackageManager {
+// versionedPackageManagers are the package managers that can install a specific version of a package
+var versionedPackageManagers = []string{
+	PackageManagerApt,
+	PackageManagerBrew,
+	PackageManagerDnf,
+	PackageManagerYum,
+	PackageManagerZypper,
+}
+
+// packageManagerAur installs packages through the configured AUR helper
+const packageManagerAur = "aur"
+
+// packageRef is a single package to install, and what installs it
+type packageRef struct {
+	executor string
+	manager  string
+	name     string
+	// version is the pinned version, if any
+	version string
+	absent  bool
+	hold    *bool
+}
+
+// spec is how the package is named to the package manager's install command
+func (r packageRef) spec() string {
+	if r.version == "" {
+		return r.name
+	}
+	switch r.manager {
+	case PackageManagerDnf, PackageManagerYum:
+		return r.name + "-" + r.version
+	default:
+		return r.name + "=" + r.version
+	}
+}
+
+// versionMatches is true if the installed version satisfies the pinned one. Pins may leave off the
+// package's revision, i.e 2.45.0 is satisfied by 2.45.0-1
+func versionMatches(installed string, pinned string) bool {
+	return pinned == "" || installed == pinned || strings.HasPrefix(installed, pinned+"-")
+}
+
+// installArgs is the command that installs names in a single transaction
+func installArgs(conf UserConfig, manager string, names []string) (string, []string) {
+	switch manager {
 	case PackageManagerApt:
-		err = s.executeApt()
+		args := []string{"DEBIAN_FRONTEND=noninteractive", "apt", "install", "-y"}
+		// Pinning may mean going back a version
+		if lo.SomeBy(names, func(n string) bool { return strings.Contains(n, "=") }) {
+			args = append(args, "--allow-downgrades")
+		}
+		return conf.escalate(append(args, names...)...)
 	case PackageManagerBrew:
-		err = s.executeBrew()
+		return "brew", append([]string{"install"}, names...)
+	case PackageManagerDnf, PackageManagerYum:
+		return conf.escalate(append([]string{manager, "install", "-y"}, names...)...)
+	case PackageManagerPacman:
+		return conf.escalate(append([]string{"pacman", "-S", "--needed", "--noconfirm"}, names...)...)
+	case packageManagerAur:
+		return conf.AurHelper, append([]string{"-S", "--needed", "--noconfirm"}, names...)
+	case PackageManagerApk:
+		return conf.escalate(append([]string{"apk", "add"}, names...)...)
+	case PackageManagerZypper:
+		return conf.escalate(append([]string{"zypper", "--non-interactive", "install"}, names...)...)
 	default:
-		err = fmt.Errorf("enknown package manager %v", conf.PackageManager)
+		return "nix", append([]string{"profile", "install"}, names...)
 	}
-	if err != nil {
-		return fmt.Errorf("error during execution: %w", err)
+}
+
+// removeArgs is the command that removes names in a single transaction
+func removeArgs(conf UserConfig, manager string, names []string) (string, []string) {
+	switch manager {
+	case PackageManagerApt:
+		return conf.escalate(append([]string{"DEBIAN_FRONTEND=noninteractive", "apt", "remove", "-y"}, names...)...)
+	case PackageManagerBrew:
+		return "brew", append([]string{"uninstall"}, names...)
+	case PackageManagerDnf, PackageManagerYum:
+		return conf.escalate(append([]string{manager, "remove", "-y"}, names...)...)
+	case PackageManagerPacman, packageManagerAur:
+		return conf.escalate(append([]string{"pacman", "-R", "--noconfirm"}, names...)...)
+	case PackageManagerApk:
+		return conf.escalate(append([]string{"apk", "del"}, names...)...)
+	case PackageManagerZypper:
+		return conf.escalate(append([]string{"zypper", "--non-interactive", "remove"}, names...)...)
+	default:
+		// Profile elements are named after the attribute they were installed from
+		return "nix", append([]string{"profile", "remove"}, lo.Map(names, func(n string, _ int) string {
+			_, attr, _ := strings.Cut(n, "#")
+			return attr
+		})...)
+	}
+}
+
+// installedPackages checks which of names are already installed, querying the package manager once,
+// returning the installed version of each (which may be empty, if the package manager doesn't say).
+// Failing queries are treated as nothing being installed, as a missing package makes most of them
+// exit non-zero anyway
+func installedPackages(ctx context.Context, runner CommandRunner, manager string, names []string) map[string]string {
+	installed := map[string]string{}
+
+	var stdout string
+	switch manager {
+	case PackageManagerApt:
+		stdout, _, _ = runner.Run(ctx, "dpkg-query", append([]string{"-W", "-f=${Package}\t${Status}\t${Version}\n"}, names...)...)
+		for _, line := range strings.Split(stdout, "\n") {
+			fields := strings.Split(line, "\t")
+			if len(fields) != 3 {
+				continue
+			}
+			name, _, _ := strings.Cut(fields[0], ":")
+			if lo.Contains(names, name) && strings.HasSuffix(fields[1], "install ok installed") {
+				installed[name] = fields[2]
+			}
+		}
+	case PackageManagerBrew:
+		// Tapped formulae are listed by their short name
+		stdout, _, _ = runner.Run(ctx, "brew", append([]string{"list", "--versions"}, names...)...)
+		short := lo.KeyBy(names, func(n string) string { return path.Base(n) })
+		for _, fields := range outputFields(stdout) {
+			if name, ok := short[fields[0]]; ok {
+				installed[name] = lastField(fields)
+			}
+		}
+	case PackageManagerDnf, PackageManagerYum, PackageManagerZypper:
+		stdout, _, _ = runner.Run(ctx, "rpm", append([]string{"-q", "--qf", "%{NAME}\t%{VERSION}-%{RELEASE}\n"}, names...)...)
+		for _, line := range strings.Split(stdout, "\n") {
+			// Missing packages are reported as "package x is not installed", so stick to tab separated
+			// lines
+			name, version, ok := strings.Cut(line, "\t")
+			if ok && lo.Contains(names, name) {
+				installed[name] = version
+			}
+		}
+	case PackageManagerPacman, packageManagerAur:
+		stdout, _, _ = runner.Run(ctx, "pacman", append([]string{"-Q"}, names...)...)
+		for _, fields := range outputFields(stdout) {
+			if lo.Contains(names, fields[0]) {
+				installed[fields[0]] = lastField(fields)
+			}
+		}
+	case PackageManagerApk:
+		stdout, _, _ = runner.Run(ctx, "apk", append([]string{"info", "-e"}, names...)...)
+		for _, fields := range outputFields(stdout) {
+			if lo.Contains(names, fields[0]) {
+				installed[fields[0]] = ""
+			}
+		}
+	case PackageManagerNix:
+		stdout, _, _ = runner.Run(ctx, "nix", "profile", "list", "--json")
+		for _, name := range names {
+			if nixProfileContains(stdout, name) {
+				installed[name] = ""
+			}
+		}
+	}
+	return installed
+}
+
+// lastField is the last of fields, where package managers list the version
+func lastField(fields []string) string {
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[len(fields)-1]
+}
+
+func outputFields(stdout string) [][]string {
+	lines := [][]string{}
+	for _, line := range strings.Split(stdout, "\n") {
+		if fields := strings.Fields(line); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+	return lines
+}
+
+// nixProfileContains is true if the output of `nix profile list --json` includes the installable
+// ref, i.e nixpkgs#ripgrep
+func nixProfileContains(profile string, ref string) bool {
+	flake, attr, _ := strings.Cut(ref, "#")
+
+	var parsed struct {
+		Elements json.RawMessage `json:"elements"`
+	}
+	if err := json.Unmarshal([]byte(profile), &parsed); err != nil {
+		return false
+	}
+	type element struct {
+		AttrPath    string `json:"attrPath"`
+		OriginalUrl string `json:"originalUrl"`
+	}
+	// Newer versions of nix key the elements by name, older ones list them
+	elements := []element{}
+	byName := map[string]element{}
+	if err := json.Unmarshal(parsed.Elements, &byName); err == nil {
+		elements = lo.Values(byName)
+	} else if err := json.Unmarshal(parsed.Elements, &elements); err != nil {
+		return false
 	}
 
+	return lo.ContainsBy(elements, func(e element) bool {
+		matchesAttr := e.AttrPath == attr || strings.HasSuffix(e.AttrPath, "."+attr)
+		matchesFlake := e.OriginalUrl == flake || e.OriginalUrl == "flake:"+flake
+		return matchesAttr && matchesFlake
+	})
+}
+
+var _ Executor = (*systemPackageBatch)(nil)
+
+// systemPackageBatch installs every system package of a sync together. Installed state is queried
+// once, and only the missing packages are installed, in a single transaction
+type systemPackageBatch struct {
+	Packages []*SystemPackage
+	log      zerolog.Logger
+	// changed are the names of the system package executors that had something to do
+	changed map[string]bool
+}
+
+func newSystemPackageBatch(packages []*SystemPackage) *systemPackageBatch {
+	return &systemPackageBatch{Packages: packages}
+}
+
+// batchSystemPackages replaces every system package in executors with a single batch, run where the
+// first of them would have been
+func batchSystemPackages(executors []Executor) []Executor {
+	packages := []*SystemPackage{}
+	for _, ex := range executors {
+		if pkg, ok := ex.(*SystemPackage); ok {
+			packages = append(packages, pkg)
+		}
+	}
+	if len(packages) == 0 {
+		return executors
+	}
+
+	batched := []Executor{}
+	added := false
+	for _, ex := range executors {
+		if _, ok := ex.(*SystemPackage); !ok {
+			batched = append(batched, ex)
+			continue
+		}
+		if !added {
+			batched = append(batched, newSystemPackageBatch(packages))
+			added = true
+		}
+	}
+	return batched
+}
+
+func (b *systemPackageBatch) SetLogger(log zerolog.Logger) {
+	b.log = log
+}
+
+func (b *systemPackageBatch) Type() ExecutorType {
+	return ExecutorTypeSysPackage
+}
+
+func (b *systemPackageBatch) Validate() error {
 	return nil
 }
 
-func (s *SystemPackage) GetName() string {
-	return s.Name
+func (b *systemPackageBatch) GetName() string {
+	if len(b.Packages) == 1 {
+		return b.Packages[0].GetName()
+	}
+	return "system-packages"
 }
 
-func (s *SystemPackage) SetName(n string) {
-	s.Name = n
+func (b *systemPackageBatch) SetName(string) {}
+
+func (b *systemPackageBatch) members() []string {
+	return lo.Map(b.Packages, func(p *SystemPackage, _ int) string { return p.GetName() })
+}
+
+func (b *systemPackageBatch) memberChanged(name string) bool {
+	return b.changed[name]
 }
 
-func (s *SystemPackage) executeApt() error {
-	if s.AptName == "" {
-		return fmt.Errorf("no configured name for apt")
+// markChanged records every executor that wants any of names as changed
+func (b *systemPackageBatch) markChanged(refs []packageRef, names ...string) {
+	if b.changed == nil {
+		b.changed = map[string]bool{}
 	}
-	_, stderr, err := runCmd("/bin/sh", "-c", fmt.Sprintf("sudo DEBIAN_FRONTEND=noninteractive apt install -y %v", s.AptName))
-	if err != nil {
-		return fmt.Errorf("error during installation: %v\n%v", err, stderr)
+	for _, ref := range refs {
+		if lo.Contains(names, ref.name) {
+			b.changed[ref.executor] = true
+		}
+	}
+}
+
+func (b *systemPackageBatch) Execute(ctx context.Context, conf UserConfig, _ SyncOpts, _ GodotConfig) (bool, error) {
+	if conf.PackageManager == "" {
+		return false, fmt.Errorf("package manager not configured, cannot install system packages")
+	}
+	b.changed = map[string]bool{}
+
+	var errs *multierror.Error
+	groups := map[string][]packageRef{}
+	for _, pkg := range b.Packages {
+		ref, err := pkg.packageRef(conf)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%v: %w", pkg.GetName(), err))
+			continue
+		}
+		groups[ref.manager] = append(groups[ref.manager], ref)
+	}
+	for _, refs := range groups {
+		if err := conflictingRefs(refs); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return false, fmt.Errorf("error during execution: %w", err)
+	}
+
+	// Regular packages first, as AUR packages may depend on them
+	runner := conf.commandRunner()
+	for _, manager := range []string{conf.PackageManager, packageManagerAur} {
+		if len(groups[manager]) == 0 {
+			continue
+		}
+		if !conf.canEscalate() && lo.Contains(privilegedPackageManagers, manager) {
+			b.log.Warn().Str("package-manager", manager).Msg("skipping, privilege escalation is disabled")
+			continue
+		}
+		if err := b.apply(ctx, conf, runner, manager, groups[manager]); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		return false, fmt.Errorf("error during execution: %w", err)
 	}
+	return len(b.changed) > 0, nil
+}
+
+// conflictingRefs catches the same package being asked for by more than one executor in ways that
+// can't both be satisfied
+func conflictingRefs(refs []packageRef) error {
+	var errs *multierror.Error
+	byName := map[string]packageRef{}
+	for _, ref := range refs {
+		other, ok := byName[ref.name]
+		if !ok {
+			byName[ref.name] = ref
+			continue
+		}
+		switch {
+		case ref.absent != other.absent:
+			errs = multierror.Append(errs, fmt.Errorf("%v is both required and absent (%v, %v)", ref.name, other.executor, ref.executor))
+		case ref.version != other.version:
+			errs = multierror.Append(errs, fmt.Errorf("%v is pinned to different versions (%v, %v)", ref.name, other.executor, ref.executor))
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+// apply brings the packages for a single package manager into the requested state
+func (b *systemPackageBatch) apply(ctx context.Context, conf UserConfig, runner CommandRunner, manager string, refs []packageRef) error {
+	names := lo.Uniq(lo.Map(refs, func(r packageRef, _ int) string { return r.name }))
+	installed := installedPackages(ctx, runner, manager, names)
+
+	var errs *multierror.Error
+	if err := b.install(ctx, conf, runner, manager, refs, installed); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := b.remove(ctx, conf, runner, manager, refs, installed); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if manager == PackageManagerApt {
+		if err := b.hold(ctx, conf, runner, refs); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+func (b *systemPackageBatch) install(ctx context.Context, conf UserConfig, runner CommandRunner, manager string, refs []packageRef, installed map[string]string) error {
+	missing := []string{}
+	missingNames := []string{}
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.absent || seen[ref.name] {
+			continue
+		}
+		seen[ref.name] = true
+
+		version, ok := installed[ref.name]
+		switch {
+		case !ok:
+			missing = append(missing, ref.spec())
+			missingNames = append(missingNames, ref.name)
+		case !versionMatches(version, ref.version):
+			b.log.Info().Str("package", ref.name).Str("installed", version).Str("pinned", ref.version).Msg("installed version differs from pin")
+			missing = append(missing, ref.spec())
+			missingNames = append(missingNames, ref.name)
+		default:
+			b.log.Info().Str("package", ref.name).Msg("already installed")
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	b.log.Info().Strs("packages", missing).Msg("installing")
+	bin, args := installArgs(conf, manager, missing)
+	_, stderr, err := runner.Run(ctx, bin, args...)
+	if err == nil {
+		for _, name := range missing {
+			b.log.Info().Str("package", name).Msg("installed")
+		}
+		b.markChanged(refs, missingNames...)
+		return nil
+	}
+	if len(missing) == 1 || ctx.Err() != nil {
+		return fmt.Errorf("error installing %v: %v\n%v", strings.Join(missing, ", "), err, stderr)
+	}
+
+	// One bad package fails the whole transaction, so retry them one at a time to find out which
+	b.log.Warn().Err(err).Msg("installing packages together failed, installing individually")
+	var errs *multierror.Error
+	for i, name := range missing {
+		bin, args := installArgs(conf, manager, []string{name})
+		if _, stderr, err := runner.Run(ctx, bin, args...); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error installing %v: %v\n%v", name, err, stderr))
+			continue
+		}
+		b.log.Info().Str("package", name).Msg("installed")
+		b.markChanged(refs, missingNames[i])
+	}
+	return errs.ErrorOrNil()
+}
+
+// remove uninstalls the absent packages that are installed
+func (b *systemPackageBatch) remove(ctx context.Context, conf UserConfig, runner CommandRunner, manager string, refs []packageRef, installed map[string]string) error {
+	present := []string{}
+	for _, ref := range refs {
+		if !ref.absent || lo.Contains(present, ref.name) {
+			continue
+		}
+		if _, ok := installed[ref.name]; ok {
+			present = append(present, ref.name)
+		} else {
+			b.log.Debug().Str("package", ref.name).Msg("already absent")
+		}
+	}
+	if len(present) == 0 {
+		return nil
+	}
+
+	b.log.Info().Strs("packages", present).Msg("removing")
+	bin, args := removeArgs(conf, manager, present)
+	if _, stderr, err := runner.Run(ctx, bin, args...); err != nil {
+		return fmt.Errorf("error removing %v: %v\n%v", strings.Join(present, ", "), err, stderr)
+	}
+	b.markChanged(refs, present...)
 	return nil
 }
 
-func (s *SystemPackage) executeBrew() error {
-	if s.BrewName == "" {
-		return fmt.Errorf("no configured name for brew")
+// hold marks packages as held, or not, with apt-mark. Only packages whose state needs to change are
+// touched
+func (b *systemPackageBatch) hold(ctx context.Context, conf UserConfig, runner CommandRunner, refs []packageRef) error {
+	refs = lo.Filter(refs, func(r packageRef, _ int) bool { return r.hold != nil && !r.absent })
+	if len(refs) == 0 {
+		return nil
 	}
-	_, _, err := runCmd("brew", "install", s.BrewName)
+
+	stdout, stderr, err := runner.Run(ctx, "apt-mark", "showhold")
 	if err != nil {
-		return fmt.Errorf("error during installation: %v", err)
+		return fmt.Errorf("error listing held packages: %v\n%v", err, stderr)
 	}
-	return nil
+	held := strings.Fields(stdout)
+
+	toHold, toUnhold := []string{}, []string{}
+	for _, ref := range refs {
+		isHeld := lo.Contains(held, ref.name)
+		switch {
+		case *ref.hold && !isHeld && !lo.Contains(toHold, ref.name):
+			toHold = append(toHold, ref.name)
+		case !*ref.hold && isHeld && !lo.Contains(toUnhold, ref.name):
+			toUnhold = append(toUnhold, ref.name)
+		}
+	}
+
+	var errs *multierror.Error
+	for _, change := range []lo.Tuple2[string, []string]{lo.T2("hold", toHold), lo.T2("unhold", toUnhold)} {
+		if len(change.B) == 0 {
+			continue
+		}
+		b.log.Info().Strs("packages", change.B).Msg(change.A)
+		bin, args := conf.escalate(append([]string{"apt-mark", change.A}, change.B...)...)
+		if _, stderr, err := runner.Run(ctx, bin, args...); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error marking %v as %v: %v\n%v", strings.Join(change.B, ", "), change.A, err, stderr))
+			continue
+		}
+		b.markChanged(refs, change.B...)
+	}
+	return errs.ErrorOrNil()
 }
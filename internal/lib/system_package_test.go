@@ -0,0 +1,384 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/lithammer/dedent"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackageManagerForOsRelease(t *testing.T) {
+	testData := []struct {
+		name      string
+		osRelease string
+		installed []string
+		want      string
+	}{
+		{
+			name: "ubuntu",
+			osRelease: dedent.Dedent(`
+				NAME="Ubuntu"
+				ID=ubuntu
+				ID_LIKE=debian
+			`),
+			want: PackageManagerApt,
+		},
+		{
+			name: "fedora",
+			osRelease: dedent.Dedent(`
+				NAME="Fedora Linux"
+				ID=fedora
+			`),
+			installed: []string{"dnf"},
+			want:      PackageManagerDnf,
+		},
+		{
+			name: "old_centos",
+			osRelease: dedent.Dedent(`
+				ID="centos"
+				ID_LIKE="rhel fedora"
+			`),
+			installed: []string{"yum"},
+			want:      PackageManagerYum,
+		},
+		{
+			name: "rocky_via_id_like",
+			osRelease: dedent.Dedent(`
+				ID="rocky"
+				ID_LIKE="rhel centos fedora"
+			`),
+			installed: []string{"dnf", "yum"},
+			want:      PackageManagerDnf,
+		},
+		{
+			name: "manjaro",
+			osRelease: dedent.Dedent(`
+				ID=manjaro
+				ID_LIKE=arch
+			`),
+			want: PackageManagerPacman,
+		},
+		{
+			name:      "alpine",
+			osRelease: "ID=alpine\n",
+			want:      PackageManagerApk,
+		},
+		{
+			name: "tumbleweed",
+			osRelease: dedent.Dedent(`
+				ID="opensuse-tumbleweed"
+				ID_LIKE="opensuse suse"
+			`),
+			want: PackageManagerZypper,
+		},
+		{
+			name:      "nixos",
+			osRelease: "ID=nixos\n",
+			want:      PackageManagerNix,
+		},
+		{
+			name:      "unknown",
+			osRelease: "ID=something-else\n",
+			want:      PackageManagerApt,
+		},
+	}
+	for _, tc := range testData {
+		t.Run(tc.name, func(t *testing.T) {
+			got := packageManagerForOsRelease(tc.osRelease, func(bin string) bool {
+				for _, i := range tc.installed {
+					if i == bin {
+						return true
+					}
+				}
+				return false
+			})
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSystemPackageInstallCommand(t *testing.T) {
+	pkg := SystemPackage{
+		AptName:    "fd-find",
+		BrewName:   "fd",
+		DnfName:    "fd-find",
+		PacmanName: "fd",
+		ApkName:    "fd",
+		ZypperName: "fd",
+		NixName:    "fd",
+	}
+
+	testData := []struct {
+		manager string
+		pkg     SystemPackage
+		helper  string
+		want    string
+		err     string
+	}{
+		{manager: PackageManagerApt, pkg: pkg, want: "sudo DEBIAN_FRONTEND=noninteractive apt install -y fd-find"},
+		{manager: PackageManagerBrew, pkg: pkg, want: "brew install fd"},
+		{manager: PackageManagerDnf, pkg: pkg, want: "sudo dnf install -y fd-find"},
+		{manager: PackageManagerYum, pkg: pkg, want: "sudo yum install -y fd-find"},
+		{manager: PackageManagerPacman, pkg: pkg, want: "sudo pacman -S --needed --noconfirm fd"},
+		{manager: PackageManagerApk, pkg: pkg, want: "sudo apk add fd"},
+		{manager: PackageManagerZypper, pkg: pkg, want: "sudo zypper --non-interactive install fd"},
+		{manager: PackageManagerNix, pkg: pkg, want: "nix profile install nixpkgs#fd"},
+		{manager: PackageManagerNix, pkg: SystemPackage{NixName: "github:sharkdp/fd#fd"}, want: "nix profile install github:sharkdp/fd#fd"},
+		{manager: PackageManagerPacman, pkg: SystemPackage{AurName: "fd-git"}, helper: "paru", want: "paru -S --needed --noconfirm fd-git"},
+		{manager: PackageManagerPacman, pkg: SystemPackage{AurName: "fd-git"}, err: "no aur-helper is configured"},
+		{manager: PackageManagerApk, pkg: SystemPackage{AptName: "fd-find"}, err: "no configured name for apk"},
+	}
+	for _, tc := range testData {
+		t.Run(tc.manager, func(t *testing.T) {
+			conf := UserConfig{PackageManager: tc.manager, AurHelper: tc.helper}
+			ref, err := tc.pkg.packageRef(conf)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			bin, args := installArgs(conf, ref.manager, []string{ref.name})
+			require.Equal(t, tc.want, strings.Join(append([]string{bin}, args...), " "))
+		})
+	}
+}
+
+func TestSystemPackageValidate(t *testing.T) {
+	require.Error(t, (&SystemPackage{}).Validate())
+	require.NoError(t, (&SystemPackage{ZypperName: "fd"}).Validate())
+	require.NoError(t, (&SystemPackage{AurName: "fd-git"}).Validate())
+	require.ErrorContains(t, (&SystemPackage{PacmanName: "fd", Versions: map[string]string{"pacman": "10.1.0"}}).Validate(), "cannot pin versions for pacman")
+	require.ErrorContains(t, (&SystemPackage{AptName: "fd", Absent: true, Versions: map[string]string{"apt": "10.1.0"}}).Validate(), "absent package")
+	require.ErrorContains(t, (&SystemPackage{BrewName: "fd", Hold: lo.ToPtr(true)}).Validate(), "hold is only supported for apt")
+}
+
+func TestSystemPackageVersions(t *testing.T) {
+	testData := []struct {
+		manager string
+		pkg     SystemPackage
+		want    string
+	}{
+		{manager: PackageManagerApt, pkg: SystemPackage{AptName: "git", Versions: map[string]string{"apt": "1:2.43.0-1"}}, want: "git=1:2.43.0-1"},
+		{manager: PackageManagerBrew, pkg: SystemPackage{BrewName: "python", Versions: map[string]string{"brew": "3.11"}}, want: "python@3.11"},
+		{manager: PackageManagerDnf, pkg: SystemPackage{DnfName: "git", Versions: map[string]string{"dnf": "2.45.0"}}, want: "git-2.45.0"},
+		{manager: PackageManagerZypper, pkg: SystemPackage{ZypperName: "git", Versions: map[string]string{"zypper": "2.45.0"}}, want: "git=2.45.0"},
+		{manager: PackageManagerZypper, pkg: SystemPackage{ZypperName: "git", Versions: map[string]string{"apt": "2.45.0"}}, want: "git"},
+	}
+	for _, tc := range testData {
+		t.Run(tc.manager, func(t *testing.T) {
+			ref, err := tc.pkg.packageRef(UserConfig{PackageManager: tc.manager})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, ref.spec())
+		})
+	}
+
+	require.True(t, versionMatches("2.45.0-1.fc40", "2.45.0"))
+	require.True(t, versionMatches("2.45.0", "2.45.0"))
+	require.True(t, versionMatches("2.45.0", ""))
+	require.False(t, versionMatches("2.45.10", "2.45.1"))
+}
+
+// fakeRunner records the commands it's asked to run, responding with the first matching handler
+type fakeRunner struct {
+	commands []string
+	handlers map[string]func(args []string) (string, string, error)
+}
+
+func (f *fakeRunner) Run(_ context.Context, bin string, args ...string) (string, string, error) {
+	cmd := strings.Join(append([]string{bin}, args...), " ")
+	f.commands = append(f.commands, cmd)
+	for prefix, handler := range f.handlers {
+		if strings.HasPrefix(cmd, prefix) {
+			return handler(args)
+		}
+	}
+	return "", "", nil
+}
+
+func TestSystemPackageBatch(t *testing.T) {
+	packages := []*SystemPackage{
+		{Name: "git", AptName: "git"},
+		{Name: "ripgrep", AptName: "ripgrep"},
+		{Name: "fd", AptName: "fd-find"},
+		{Name: "git-again", AptName: "git"},
+	}
+
+	t.Run("only missing packages are installed, together", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"dpkg-query": func(args []string) (string, string, error) {
+				return "git\tinstall ok installed\t1:2.43.0-1\nripgrep:amd64\tdeinstall ok config-files\t14.1.0-1\n", "no packages found matching fd-find", fmt.Errorf("exit status 1")
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+		batch := newSystemPackageBatch(packages)
+		changed, err := batch.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, []string{
+			"dpkg-query -W -f=${Package}\t${Status}\t${Version}\n git ripgrep fd-find",
+			"sudo DEBIAN_FRONTEND=noninteractive apt install -y ripgrep fd-find",
+		}, runner.commands)
+		require.Equal(t, []string{"git", "ripgrep", "fd", "git-again"}, batch.members())
+		require.Equal(t, map[string]bool{"ripgrep": true, "fd": true}, batch.changed)
+	})
+
+	t.Run("nothing to do", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"brew list": func(args []string) (string, string, error) {
+				return "git 2.45.0\nfd 10.1.0\n", "", nil
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerBrew, runner: runner}
+		pkgs := []*SystemPackage{{Name: "git", BrewName: "git"}, {Name: "fd", BrewName: "sharkdp/tap/fd"}}
+		changed, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+		require.Len(t, runner.commands, 1)
+	})
+
+	t.Run("failures are narrowed down to the package", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"rpm": func(args []string) (string, string, error) {
+				return "", "", fmt.Errorf("exit status 1")
+			},
+			"sudo dnf install -y git ripgrep fd-find": func(args []string) (string, string, error) {
+				return "", "No match for argument: fd-find", fmt.Errorf("exit status 1")
+			},
+			"sudo dnf install -y fd-find": func(args []string) (string, string, error) {
+				return "", "No match for argument: fd-find", fmt.Errorf("exit status 1")
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerDnf, runner: runner}
+		pkgs := []*SystemPackage{{Name: "git", DnfName: "git"}, {Name: "ripgrep", DnfName: "ripgrep"}, {Name: "fd", DnfName: "fd-find"}}
+		_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.ErrorContains(t, err, "error installing fd-find")
+		require.NotContains(t, err.Error(), "error installing git")
+		require.Contains(t, runner.commands, "sudo dnf install -y git")
+		require.Contains(t, runner.commands, "sudo dnf install -y ripgrep")
+	})
+
+	t.Run("aur packages go through the helper", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"pacman -Q": func(args []string) (string, string, error) {
+				return "git 2.45.0-1\n", "error: package 'paru-bin' was not found", fmt.Errorf("exit status 1")
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerPacman, AurHelper: "yay", runner: runner}
+		pkgs := []*SystemPackage{{Name: "git", PacmanName: "git"}, {Name: "paru", AurName: "paru-bin"}}
+		_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"pacman -Q git",
+			"pacman -Q paru-bin",
+			"yay -S --needed --noconfirm paru-bin",
+		}, runner.commands)
+	})
+}
+
+func TestSystemPackageState(t *testing.T) {
+	dpkg := func(args []string) (string, string, error) {
+		return "git\tinstall ok installed\t1:2.45.0-1\nnano\tinstall ok installed\t7.2-1\nhtop\tinstall ok installed\t3.3.0-4\n", "", nil
+	}
+
+	t.Run("pins, removals & holds", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"dpkg-query": dpkg,
+			"apt-mark showhold": func(args []string) (string, string, error) {
+				return "htop\n", "", nil
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+		pkgs := []*SystemPackage{
+			{Name: "git", AptName: "git", Versions: map[string]string{"apt": "1:2.43.0-1"}, Hold: lo.ToPtr(true)},
+			{Name: "nano", AptName: "nano", Absent: true},
+			{Name: "vim", AptName: "vim", Absent: true},
+			{Name: "htop", AptName: "htop", Hold: lo.ToPtr(false)},
+		}
+		_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"dpkg-query -W -f=${Package}\t${Status}\t${Version}\n git nano vim htop",
+			"sudo DEBIAN_FRONTEND=noninteractive apt install -y --allow-downgrades git=1:2.43.0-1",
+			"sudo DEBIAN_FRONTEND=noninteractive apt remove -y nano",
+			"apt-mark showhold",
+			"sudo apt-mark hold git",
+			"sudo apt-mark unhold htop",
+		}, runner.commands)
+	})
+
+	t.Run("nothing to do when already in the requested state", func(t *testing.T) {
+		runner := &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+			"dpkg-query": dpkg,
+			"apt-mark showhold": func(args []string) (string, string, error) {
+				return "git\n", "", nil
+			},
+		}}
+		conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+		pkgs := []*SystemPackage{
+			{Name: "git", AptName: "git", Versions: map[string]string{"apt": "1:2.45.0"}, Hold: lo.ToPtr(true)},
+			{Name: "vim", AptName: "vim", Absent: true},
+		}
+		_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"dpkg-query -W -f=${Package}\t${Status}\t${Version}\n git vim",
+			"apt-mark showhold",
+		}, runner.commands)
+	})
+
+	t.Run("conflicts are refused", func(t *testing.T) {
+		runner := &fakeRunner{}
+		conf := UserConfig{PackageManager: PackageManagerApt, runner: runner}
+		pkgs := []*SystemPackage{
+			{Name: "git", AptName: "git"},
+			{Name: "no-git", AptName: "git", Absent: true},
+		}
+		_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.ErrorContains(t, err, "git is both required and absent (git, no-git)")
+		require.Empty(t, runner.commands)
+	})
+}
+
+func TestSystemPackageSkippedWithoutEscalation(t *testing.T) {
+	pkgs := []*SystemPackage{
+		{Name: "git", PacmanName: "git"},
+		{Name: "paru", AurName: "paru-bin"},
+	}
+	runner := &fakeRunner{}
+	conf := UserConfig{PackageManager: PackageManagerPacman, AurHelper: "paru", PrivilegeEscalation: PrivilegeEscalationSkip, runner: runner}
+	_, err := newSystemPackageBatch(pkgs).Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	// AUR helpers escalate themselves, so are still run
+	require.Equal(t, []string{
+		"pacman -Q paru-bin",
+		"paru -S --needed --noconfirm paru-bin",
+	}, runner.commands)
+}
+
+func TestBatchSystemPackages(t *testing.T) {
+	conf := &ConfigFile{Name: "conf"}
+	git := &SystemPackage{Name: "git"}
+	repo := &GitRepo{Name: "repo"}
+	fd := &SystemPackage{Name: "fd"}
+
+	batched := batchSystemPackages([]Executor{conf, git, repo, fd})
+	require.Len(t, batched, 3)
+	require.Equal(t, conf, batched[0])
+	require.Equal(t, []*SystemPackage{git, fd}, batched[1].(*systemPackageBatch).Packages)
+	require.Equal(t, repo, batched[2])
+}
+
+func TestNixProfileContains(t *testing.T) {
+	current := `{"elements":{"ripgrep":{"active":true,"attrPath":"legacyPackages.x86_64-linux.ripgrep","originalUrl":"flake:nixpkgs"}},"version":3}`
+	legacy := `{"elements":[{"active":true,"attrPath":"legacyPackages.x86_64-linux.ripgrep","originalUrl":"flake:nixpkgs"}],"version":2}`
+	for _, profile := range []string{current, legacy} {
+		require.True(t, nixProfileContains(profile, "nixpkgs#ripgrep"))
+		require.False(t, nixProfileContains(profile, "nixpkgs#fd"))
+		require.False(t, nixProfileContains(profile, "github:BurntSushi/ripgrep#ripgrep"))
+	}
+	require.False(t, nixProfileContains("not json", "nixpkgs#ripgrep"))
+}
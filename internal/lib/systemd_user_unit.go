@@ -0,0 +1,185 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var _ Executor = (*SystemdUserUnit)(nil)
+var _ bundleExporter = (*SystemdUserUnit)(nil)
+var _ generationRecorder = (*SystemdUserUnit)(nil)
+
+// systemdUserDir is where user units are installed, relative to the home directory
+const systemdUserDir = "~/.config/systemd/user"
+
+// systemdEnabledStates are the is-enabled states that need no enabling. Units without an [Install]
+// section report static, and are started by whatever depends on them instead
+var systemdEnabledStates = []string{
+	"enabled",
+	"enabled-runtime",
+	"static",
+	"indirect",
+	"alias",
+	"generated",
+}
+
+var systemdUnitSuffixes = []string{
+	".service",
+	".socket",
+	".timer",
+	".path",
+	".target",
+	".mount",
+	".automount",
+	".slice",
+}
+
+type SystemdUserUnit struct {
+	Name         string         `yaml:"-"`
+	TemplateName string         `yaml:"template-name" mapstructure:"template-name"`
+	NoTemplate   bool           `yaml:"no-template" mapstructure:"no-template"`
+	Enabled      *bool          `yaml:"enabled" mapstructure:"enabled"`
+	Started      *bool          `yaml:"started" mapstructure:"started"`
+	log          zerolog.Logger `yaml:"-"`
+}
+
+func (s *SystemdUserUnit) SetLogger(log zerolog.Logger) {
+	s.log = log
+}
+
+func (s *SystemdUserUnit) Type() ExecutorType {
+	return ExecutorTypeSystemdUserUnit
+}
+
+func (s *SystemdUserUnit) GetName() string {
+	return s.Name
+}
+
+func (s *SystemdUserUnit) SetName(n string) {
+	s.Name = n
+}
+
+func (s *SystemdUserUnit) Validate() error {
+	var errs *multierror.Error
+
+	if s.TemplateName == "" {
+		errs = multierror.Append(errs, fmt.Errorf("template-name is required"))
+	} else if !lo.SomeBy(systemdUnitSuffixes, func(suffix string) bool { return strings.HasSuffix(s.unitName(), suffix) }) {
+		errs = multierror.Append(errs, fmt.Errorf("template-name must be named like a unit, i.e ending in one of %v", strings.Join(systemdUnitSuffixes, ", ")))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (s *SystemdUserUnit) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, godotConf GodotConfig) (bool, error) {
+	if runtime.GOOS != "linux" {
+		return false, fmt.Errorf("systemd-user-unit is only available on linux")
+	}
+
+	unit := s.unitName()
+	s.log.Info().Str("unit", unit).Msg("ensuring systemd user unit")
+	unitChanged, err := s.configFile().Execute(ctx, conf, opts, godotConf)
+	if err != nil {
+		return false, fmt.Errorf("error rendering unit: %w", err)
+	}
+	changed := unitChanged
+
+	if unitChanged {
+		s.log.Debug().Msg("unit file changed, reloading")
+		if err := s.systemctl(ctx, conf, "daemon-reload"); err != nil {
+			return false, err
+		}
+	}
+
+	state, err := s.query(ctx, conf, "is-enabled", unit)
+	if err != nil {
+		return false, err
+	}
+	switch {
+	case (s.Enabled == nil || *s.Enabled) && !lo.Contains(systemdEnabledStates, state):
+		if err := s.systemctl(ctx, conf, "enable", unit); err != nil {
+			return false, err
+		}
+		changed = true
+	case s.Enabled != nil && !*s.Enabled && state == "enabled":
+		if err := s.systemctl(ctx, conf, "disable", unit); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	state, err = s.query(ctx, conf, "is-active", unit)
+	if err != nil {
+		return false, err
+	}
+	active := state == "active"
+	switch {
+	case (s.Started == nil || *s.Started) && !active:
+		if err := s.systemctl(ctx, conf, "start", unit); err != nil {
+			return false, err
+		}
+		changed = true
+	case (s.Started == nil || *s.Started) && unitChanged:
+		// Already running, but from the old unit file
+		if err := s.systemctl(ctx, conf, "restart", unit); err != nil {
+			return false, err
+		}
+	case s.Started != nil && !*s.Started && active:
+		if err := s.systemctl(ctx, conf, "stop", unit); err != nil {
+			return false, err
+		}
+		changed = true
+	}
+
+	return changed, nil
+}
+
+// unitName is the name the unit is installed as, the file name of the template
+func (s *SystemdUserUnit) unitName() string {
+	return path.Base(s.TemplateName)
+}
+
+// configFile renders the unit template into the user unit directory
+func (s *SystemdUserUnit) configFile() *ConfigFile {
+	f := &ConfigFile{
+		Name:         s.Name,
+		TemplateName: s.TemplateName,
+		Destination:  path.Join(systemdUserDir, s.unitName()),
+		NoTemplate:   s.NoTemplate,
+	}
+	f.SetLogger(s.log)
+	return f
+}
+
+// query runs a systemctl query, like is-active, returning the state it reports. These exit non-zero
+// when the answer is no, so only failing to run at all is an error
+func (s *SystemdUserUnit) query(ctx context.Context, conf UserConfig, query string, unit string) (string, error) {
+	stdout, stderr, err := conf.commandRunner().Run(ctx, "systemctl", "--user", query, unit)
+	if err != nil && stdout == "" {
+		return "", fmt.Errorf("error running systemctl %v: %v\n%v", query, err, stderr)
+	}
+	return strings.TrimSpace(stdout), nil
+}
+
+func (s *SystemdUserUnit) systemctl(ctx context.Context, conf UserConfig, args ...string) error {
+	s.log.Debug().Strs("args", args).Msg("running systemctl")
+	if _, stderr, err := conf.commandRunner().Run(ctx, "systemctl", append([]string{"--user"}, args...)...); err != nil {
+		return fmt.Errorf("error running systemctl %v: %v\n%v", strings.Join(args, " "), err, stderr)
+	}
+	return nil
+}
+
+func (s *SystemdUserUnit) exportToBundle(ctx context.Context, conf UserConfig, godotConf GodotConfig, w *bundleWriter) error {
+	return s.configFile().exportToBundle(ctx, conf, godotConf, w)
+}
+
+func (s *SystemdUserUnit) recordGeneration(conf UserConfig, gen *Generation) error {
+	return s.configFile().recordGeneration(conf, gen)
+}
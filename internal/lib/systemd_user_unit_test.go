@@ -0,0 +1,173 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystemd tracks the state of a single unit, as driven by systemctl
+type fakeSystemd struct {
+	enabled bool
+	active  bool
+	// enabledState overrides what is-enabled reports, i.e static for units without an [Install]
+	enabledState string
+}
+
+func (f *fakeSystemd) runner() *fakeRunner {
+	state := func(ok bool, yes string, no string) (string, string, error) {
+		if ok {
+			return yes + "\n", "", nil
+		}
+		return no + "\n", "", fmt.Errorf("exit status 1")
+	}
+	set := func(field *bool, value bool) func([]string) (string, string, error) {
+		return func([]string) (string, string, error) {
+			*field = value
+			return "", "", nil
+		}
+	}
+	return &fakeRunner{handlers: map[string]func([]string) (string, string, error){
+		"systemctl --user is-enabled": func([]string) (string, string, error) {
+			if f.enabledState != "" {
+				return f.enabledState + "\n", "", nil
+			}
+			return state(f.enabled, "enabled", "disabled")
+		},
+		"systemctl --user is-active": func([]string) (string, string, error) {
+			return state(f.active, "active", "inactive")
+		},
+		"systemctl --user enable":  set(&f.enabled, true),
+		"systemctl --user disable": set(&f.enabled, false),
+		"systemctl --user start":   set(&f.active, true),
+		"systemctl --user stop":    set(&f.active, false),
+	}}
+}
+
+func TestSystemdUserUnit(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("systemd is linux only")
+	}
+
+	t.Run("installs, enables and starts", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "sync.service", "[Service]\nExecStart={{ .Home }}/bin/sync\n")
+		systemd := &fakeSystemd{}
+		runner := systemd.runner()
+		conf.runner = runner
+
+		u := &SystemdUserUnit{Name: "sync", TemplateName: "sync.service"}
+		u.SetLogger(zerolog.Nop())
+		changed, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		requireContents(t, filepath.Join(conf.HomeDir, ".config/systemd/user/sync.service"), fmt.Sprintf("[Service]\nExecStart=%v/bin/sync\n", conf.HomeDir))
+		require.Equal(t, []string{
+			"systemctl --user daemon-reload",
+			"systemctl --user is-enabled sync.service",
+			"systemctl --user enable sync.service",
+			"systemctl --user is-active sync.service",
+			"systemctl --user start sync.service",
+		}, runner.commands)
+
+		runner.commands = nil
+		changed, err = u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+		require.Equal(t, []string{
+			"systemctl --user is-enabled sync.service",
+			"systemctl --user is-active sync.service",
+		}, runner.commands)
+	})
+
+	t.Run("restarts when the unit changes", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "sync.timer", "[Timer]\nOnCalendar=daily\n")
+		runner := (&fakeSystemd{enabled: true, active: true}).runner()
+		conf.runner = runner
+
+		u := &SystemdUserUnit{Name: "sync", TemplateName: "sync.timer"}
+		u.SetLogger(zerolog.Nop())
+		changed, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, []string{
+			"systemctl --user daemon-reload",
+			"systemctl --user is-enabled sync.timer",
+			"systemctl --user is-active sync.timer",
+			"systemctl --user restart sync.timer",
+		}, runner.commands)
+	})
+
+	t.Run("static units are left alone once running", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "sync.service", "[Service]\nType=oneshot\n")
+		runner := (&fakeSystemd{enabledState: "static", active: true}).runner()
+		conf.runner = runner
+
+		u := &SystemdUserUnit{Name: "sync", TemplateName: "sync.service"}
+		u.SetLogger(zerolog.Nop())
+		_, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+
+		runner.commands = nil
+		changed, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+		require.Equal(t, []string{
+			"systemctl --user is-enabled sync.service",
+			"systemctl --user is-active sync.service",
+		}, runner.commands)
+	})
+
+	t.Run("enabling a running unit doesn't restart it", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "sync.service", "[Service]\n")
+		systemd := &fakeSystemd{active: true}
+		runner := systemd.runner()
+		conf.runner = runner
+
+		u := &SystemdUserUnit{Name: "sync", TemplateName: "sync.service"}
+		u.SetLogger(zerolog.Nop())
+		_, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+
+		// Disabled behind godot's back, with the unit file unchanged
+		systemd.enabled = false
+		runner.commands = nil
+		changed, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.Equal(t, []string{
+			"systemctl --user is-enabled sync.service",
+			"systemctl --user enable sync.service",
+			"systemctl --user is-active sync.service",
+		}, runner.commands)
+	})
+
+	t.Run("disabled and stopped", func(t *testing.T) {
+		defer cleanFuncsMap(t)
+		conf := setupForConfigFile(t, "sync.service", "[Service]\n")
+		systemd := &fakeSystemd{enabled: true, active: true}
+		conf.runner = systemd.runner()
+
+		u := &SystemdUserUnit{Name: "sync", TemplateName: "sync.service", Enabled: new(bool), Started: new(bool)}
+		u.SetLogger(zerolog.Nop())
+		changed, err := u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.False(t, systemd.enabled)
+		require.False(t, systemd.active)
+	})
+}
+
+func TestSystemdUserUnitValidate(t *testing.T) {
+	require.NoError(t, (&SystemdUserUnit{TemplateName: "units/sync.service"}).Validate())
+	require.Error(t, (&SystemdUserUnit{}).Validate())
+	require.Error(t, (&SystemdUserUnit{TemplateName: "sync.conf"}).Validate())
+}
@@ -1,49 +1,119 @@
 package lib
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/mholt/archiver"
-	"github.com/samber/lo"
+	"github.com/mholt/archives"
+	"github.com/rs/zerolog"
 )
 
 type searchFunc func(string) (bool, error)
 
-var archiveExtensions = []string{
-	".gz",
-	".zip",
-}
+// archiveFormat identifies the archive or compression format of the file at path by both its name
+// and its magic bytes. A nil format is returned for files that are neither, i.e raw binaries
+//
+//nolint:ireturn
+func archiveFormat(ctx context.Context, path string) (archives.Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer f.Close()
 
-func isArchiveFile(path string) bool {
-	return lo.Contains(archiveExtensions, filepath.Ext(path))
+	format, _, err := archives.Identify(ctx, filepath.Base(path), f)
+	if errors.Is(err, archives.NoMatch) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error identifying format of %v: %w", filepath.Base(path), err)
+	}
+	return format, nil
 }
 
+// isExecutableFile reports if path is a regular, executable file. Symlinks are never followed, so
+// a link in an archive can't be picked as the binary
 func isExecutableFile(path string) (bool, error) {
-	fileInfo, err := os.Stat(path)
+	fileInfo, err := os.Lstat(path)
 	if err != nil {
 		return false, fmt.Errorf("error determining if file is executable: %w", err)
 	}
 
 	filePerm := fileInfo.Mode()
-	return !fileInfo.IsDir() && filePerm&0111 != 0, nil
+	return filePerm.IsRegular() && filePerm&0111 != 0, nil
 }
 
-func extractBinary(downloadPath string, extractPath string, binaryPath string, findFunc searchFunc) (string, error) {
-	if isArchiveFile(downloadPath) {
-		err := archiver.Unarchive(downloadPath, extractPath)
-		if err != nil {
-			return "", fmt.Errorf("error extracting archive: %w", err)
+// unpackDownload extracts downloadPath into extractPath if it's an archive, returning the location
+// to search for binaries in. Compressed single files are decompressed, and along with everything
+// else that isn't an archive, are returned as the binary itself
+func unpackDownload(ctx context.Context, downloadPath string, extractPath string, logger zerolog.Logger) (string, bool, error) {
+	format, err := archiveFormat(ctx, downloadPath)
+	if err != nil {
+		return "", false, err
+	}
+
+	if _, ok := format.(archives.Extractor); ok {
+		if err := extractArchive(ctx, downloadPath, extractPath, 0, logger); err != nil {
+			return "", false, fmt.Errorf("error extracting archive: %w", err)
 		}
-		if binaryPath != "" {
-			return filepath.Join(extractPath, binaryPath), nil
-		} else {
-			return findExecutable(extractPath, findFunc)
+		return extractPath, true, nil
+	}
+
+	if decompressor, ok := format.(archives.Decompressor); ok {
+		binary, err := decompressFile(ctx, downloadPath, extractPath, decompressor, format.Extension())
+		if err != nil {
+			return "", false, fmt.Errorf("error decompressing file: %w", err)
 		}
+		return binary, false, nil
 	}
-	return downloadPath, nil
+
+	return downloadPath, false, nil
+}
+
+// decompressFile decompresses a single compressed file (i.e foo.gz) into extractPath, named after
+// the original file without its compression extension
+func decompressFile(ctx context.Context, downloadPath string, extractPath string, decompressor archives.Decompressor, ext string) (string, error) {
+	input, err := os.Open(downloadPath)
+	if err != nil {
+		return "", fmt.Errorf("error opening file: %w", err)
+	}
+	defer input.Close()
+
+	reader, err := decompressor.OpenReader(input)
+	if err != nil {
+		return "", fmt.Errorf("error opening decompression reader: %w", err)
+	}
+	defer reader.Close()
+
+	if err := os.MkdirAll(extractPath, 0755); err != nil {
+		return "", fmt.Errorf("error creating extraction directory: %w", err)
+	}
+	outPath := filepath.Join(extractPath, strings.TrimSuffix(filepath.Base(downloadPath), ext))
+	out, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", fmt.Errorf("error creating decompressed file: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, contextReader{ctx: ctx, r: reader}); err != nil {
+		return "", fmt.Errorf("error writing decompressed file: %w", err)
+	}
+	return outPath, nil
+}
+
+// locateBinary finds a binary in an extracted archive, either at a known relative path or by
+// searching for it
+func locateBinary(extractPath string, binaryPath string, findFunc searchFunc) (string, error) {
+	if binaryPath != "" {
+		return filepath.Join(extractPath, binaryPath), nil
+	}
+	return findExecutable(extractPath, findFunc)
 }
 
 func findExecutable(path string, searchFunc searchFunc) (string, error) {
@@ -75,3 +145,137 @@ func findExecutable(path string, searchFunc searchFunc) (string, error) {
 
 	return executables[0], nil
 }
+
+// extractArchive extracts the entirety of archivePath into dest, removing the first strip leading
+// components of every path in the archive (in the same manner as tar --strip-components)
+//
+//nolint:gocognit
+func extractArchive(ctx context.Context, archivePath string, dest string, strip int, logger zerolog.Logger) error {
+	input, err := openWithProgress(archivePath, "extracting "+filepath.Base(archivePath), logger)
+	if err != nil {
+		return fmt.Errorf("error opening archive: %w", err)
+	}
+	defer input.Done()
+
+	format, stream, err := archives.Identify(ctx, filepath.Base(archivePath), input)
+	if err != nil {
+		return fmt.Errorf("error identifying archive format: %w", err)
+	}
+	extractor, ok := format.(archives.Extractor)
+	if !ok {
+		return fmt.Errorf("%v is not an extractable archive", filepath.Base(archivePath))
+	}
+
+	return extractor.Extract(ctx, stream, func(ctx context.Context, info archives.FileInfo) error {
+		name := stripComponents(info.NameInArchive, strip)
+		// i.e its one of the stripped directories
+		if name == "" {
+			return nil
+		}
+		if !validRelPath(name) {
+			return fmt.Errorf("archive contained invalid name %q", info.NameInArchive)
+		}
+
+		dstPath := filepath.Join(dest, filepath.FromSlash(name))
+		if err := refuseSymlinks(dest, dstPath); err != nil {
+			return fmt.Errorf("archive entry %q: %w", info.NameInArchive, err)
+		}
+		if info.IsDir() {
+			if err := os.MkdirAll(dstPath, info.Mode().Perm()|0700); err != nil {
+				return fmt.Errorf("error replicating directory from archive: %w", err)
+			}
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+			return fmt.Errorf("error creating containing directory: %w", err)
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !withinDir(dest, info.LinkTarget, filepath.Dir(dstPath)) {
+				return fmt.Errorf("archive contained symlink %q pointing outside of the archive to %q", info.NameInArchive, info.LinkTarget)
+			}
+			if err := os.Symlink(info.LinkTarget, dstPath); err != nil {
+				return fmt.Errorf("error replicating symlink from archive: %w", err)
+			}
+			return nil
+		}
+
+		fl, err := info.Open()
+		if err != nil {
+			return fmt.Errorf("error opening file in archive: %w", err)
+		}
+		defer fl.Close()
+
+		dstFile, err := os.OpenFile(dstPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("error creating destination file: %w", err)
+		}
+		defer dstFile.Close()
+
+		if _, err := io.Copy(dstFile, contextReader{ctx: ctx, r: fl}); err != nil {
+			return fmt.Errorf("error copying file: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// contextReader stops reading once ctx is done, so copying a single large file can be interrupted
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// refuseSymlinks errors if any existing part of path below dest is a symlink, as writing through it
+// could land outside of dest
+func refuseSymlinks(dest string, path string) error {
+	rel, err := filepath.Rel(dest, path)
+	if err != nil {
+		return fmt.Errorf("error resolving path: %w", err)
+	}
+
+	current := dest
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error checking path: %w", err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink %v", current)
+		}
+	}
+	return nil
+}
+
+// withinDir reports if a symlink target, relative to the directory the link lives in, stays inside
+// of dest. Absolute targets are never allowed
+func withinDir(dest string, target string, linkDir string) bool {
+	if target == "" || filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return false
+	}
+	rel, err := filepath.Rel(dest, filepath.Join(linkDir, filepath.FromSlash(target)))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func stripComponents(name string, strip int) string {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	if len(parts) <= strip {
+		return ""
+	}
+	return strings.Join(parts[strip:], "/")
+}
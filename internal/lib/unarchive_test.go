@@ -1,17 +1,25 @@
 package lib
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/mholt/archives"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
-func TestExtractBinary(t *testing.T) {
+func TestUnpackDownload(t *testing.T) {
 	t.Run("tar_gz", func(t *testing.T) {
 		extractDir := t.TempDir()
 
-		got, err := extractBinary("testdata/fzf.tar.gz", extractDir, "", nil)
+		got, err := unpackBinary(t, "testdata/fzf.tar.gz", extractDir)
 		require.NoError(t, err)
 		want := filepath.Join(extractDir, "fzf")
 		require.Equal(t, want, got)
@@ -20,9 +28,183 @@ func TestExtractBinary(t *testing.T) {
 	t.Run("zip", func(t *testing.T) {
 		extractDir := t.TempDir()
 
-		got, err := extractBinary("testdata/fzf.zip", extractDir, "", nil)
+		got, err := unpackBinary(t, "testdata/fzf.zip", extractDir)
 		require.NoError(t, err)
 		want := filepath.Join(extractDir, "fzf")
 		require.Equal(t, want, got)
 	})
+
+	compressedTars := map[string]archives.Compression{
+		"tool.tar.xz":  archives.Xz{},
+		"tool.tar.bz2": archives.Bz2{},
+		"tool.tar.zst": archives.Zstd{},
+		"tool.tgz":     archives.Gz{},
+	}
+	for name, compression := range compressedTars {
+		t.Run(name, func(t *testing.T) {
+			archive := buildArchive(t, name, archives.CompressedArchive{
+				Compression: compression,
+				Archival:    archives.Tar{},
+				Extraction:  archives.Tar{},
+			})
+
+			extractDir := t.TempDir()
+			got, err := unpackBinary(t, archive, extractDir)
+			require.NoError(t, err)
+			requireContents(t, got, "tool")
+			require.Equal(t, filepath.Join(extractDir, "tool-dir", "tool"), got)
+		})
+	}
+
+	t.Run("detected_by_contents", func(t *testing.T) {
+		// Assets without a meaningful extension should still be detected as archives
+		archive := buildArchive(t, "tool-linux-amd64", archives.CompressedArchive{
+			Compression: archives.Gz{},
+			Archival:    archives.Tar{},
+			Extraction:  archives.Tar{},
+		})
+
+		extractDir := t.TempDir()
+		got, err := unpackBinary(t, archive, extractDir)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(extractDir, "tool-dir", "tool"), got)
+	})
+
+	t.Run("compressed_binary", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "tool.gz")
+		f, err := os.Create(src)
+		require.NoError(t, err)
+		gz := gzip.NewWriter(f)
+		_, err = gz.Write([]byte("tool"))
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		require.NoError(t, f.Close())
+
+		extractDir := t.TempDir()
+		got, err := unpackBinary(t, src, extractDir)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(extractDir, "tool"), got)
+		requireContents(t, got, "tool")
+	})
+
+	t.Run("raw_binary", func(t *testing.T) {
+		src := filepath.Join(t.TempDir(), "tool")
+		require.NoError(t, os.WriteFile(src, []byte("\x7fELF not really"), 0755))
+
+		got, err := unpackBinary(t, src, t.TempDir())
+		require.NoError(t, err)
+		require.Equal(t, src, got)
+	})
+}
+
+// unpackBinary finds the binary in a download the same way installing it does
+func unpackBinary(t *testing.T, downloadPath string, extractPath string) (string, error) {
+	t.Helper()
+
+	root, isArchive, err := unpackDownload(context.Background(), downloadPath, extractPath, zerolog.Nop())
+	if err != nil || !isArchive {
+		return root, err
+	}
+	return locateBinary(root, "", nil)
+}
+
+func buildArchive(t *testing.T, name string, format archives.Archiver) string {
+	t.Helper()
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "tool-dir"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "tool-dir", "tool"), []byte("tool"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "tool-dir", "README"), []byte("readme"), 0644))
+
+	files, err := archives.FilesFromDisk(context.Background(), nil, map[string]string{
+		filepath.Join(src, "tool-dir"): "tool-dir",
+	})
+	require.NoError(t, err)
+
+	out := filepath.Join(t.TempDir(), name)
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, format.Archive(context.Background(), f, files))
+	return out
+}
+
+// buildTarEntries writes a tar.gz of the given headers, any regular files are given their name as contents
+func buildTarEntries(t *testing.T, headers ...*tar.Header) string {
+	t.Helper()
+
+	out := filepath.Join(t.TempDir(), "release.tar.gz")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(h.Name))
+		}
+		require.NoError(t, tw.WriteHeader(h))
+		if h.Typeflag == tar.TypeReg {
+			_, err := tw.Write([]byte(h.Name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return out
+}
+
+func TestExtractArchiveSymlinks(t *testing.T) {
+	link := func(name string, target string) *tar.Header {
+		return &tar.Header{Name: name, Linkname: target, Typeflag: tar.TypeSymlink, Mode: 0777}
+	}
+	file := func(name string) *tar.Header {
+		return &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0755}
+	}
+
+	malicious := map[string][]*tar.Header{
+		"relative_escape": {link("escape", "../outside")},
+		"nested_escape":   {link("a/b/escape", "../../../outside")},
+		"absolute_target": {link("escape", "/tmp")},
+		"write_through":   {&tar.Header{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755}, link("link", "sub"), file("link/tool")},
+		"overwrite_link":  {link("tool", "sub/tool"), file("tool")},
+	}
+	for name, headers := range malicious {
+		t.Run(name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "extract")
+			err := extractArchive(context.Background(), buildTarEntries(t, headers...), dest, 0, zerolog.Nop())
+			require.Error(t, err)
+
+			entries, err := os.ReadDir(root)
+			require.NoError(t, err)
+			require.Len(t, entries, 1, "nothing should be written outside of the extract dir")
+		})
+	}
+
+	t.Run("links inside the archive are kept, but never chosen as the binary", func(t *testing.T) {
+		dest := t.TempDir()
+		archive := buildTarEntries(t, file("bin/tool"), link("tool", "bin/tool"))
+
+		got, err := unpackBinary(t, archive, dest)
+		require.NoError(t, err)
+		require.Equal(t, filepath.Join(dest, "bin", "tool"), got)
+		target, err := os.Readlink(filepath.Join(dest, "tool"))
+		require.NoError(t, err)
+		require.Equal(t, "bin/tool", target)
+	})
+}
+
+func TestExtractArchiveCancelled(t *testing.T) {
+	archive := buildTarGz(t, map[string]string{"bin/tool": "tool"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := extractArchive(ctx, archive, t.TempDir(), 0, zerolog.Nop())
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Partway through a file
+	_, err = io.Copy(io.Discard, contextReader{ctx: ctx, r: strings.NewReader("tool")})
+	require.ErrorIs(t, err, context.Canceled)
 }
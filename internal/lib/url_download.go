@@ -2,6 +2,7 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"path"
 	"runtime"
@@ -12,14 +13,20 @@ import (
 )
 
 var _ Executor = (*UrlDownload)(nil)
+var _ bundleExporter = (*UrlDownload)(nil)
+var _ generationRecorder = (*UrlDownload)(nil)
 
 type UrlDownload struct {
-	Name       string         `yaml:"-"`
-	Tag        string         `yaml:"tag" mapstructure:"tag"`
-	MacUrl     string         `yaml:"mac-url" mapstructure:"mac-url"`
-	LinuxUrl   string         `yaml:"linux-url" mapstructure:"linux-url"`
-	WindowsUrl string         `yaml:"windows-url" mapstructure:"windows-url"`
-	log        zerolog.Logger `yaml:"-"`
+	Name            string         `yaml:"-"`
+	Tag             string         `yaml:"tag" mapstructure:"tag"`
+	MacUrl          string         `yaml:"mac-url" mapstructure:"mac-url"`
+	LinuxUrl        string         `yaml:"linux-url" mapstructure:"linux-url"`
+	WindowsUrl      string         `yaml:"windows-url" mapstructure:"windows-url"`
+	Binaries        []Binary       `yaml:"binaries" mapstructure:"binaries"`
+	InstallMode     string         `yaml:"install-mode" mapstructure:"install-mode"`
+	StripComponents int            `yaml:"strip-components" mapstructure:"strip-components"`
+	Links           []string       `yaml:"links" mapstructure:"links"`
+	log             zerolog.Logger `yaml:"-"`
 }
 
 type urlVars struct {
@@ -48,38 +55,43 @@ func (u *UrlDownload) Validate() error {
 	if u.MacUrl == "" && u.LinuxUrl == "" && u.WindowsUrl == "" {
 		errs = multierror.Append(errs, fmt.Errorf("one of mac-url, linux-url, or windows-url is required"))
 	}
+	if err := u.installSpec().Validate(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
 
 	return errs.ErrorOrNil()
 }
 
-func (u *UrlDownload) Execute(conf UserConfig, opts SyncOpts, _ GodotConfig) error {
+func (u *UrlDownload) Execute(ctx context.Context, conf UserConfig, opts SyncOpts, _ GodotConfig) (bool, error) {
 	u.log.Info().Str("url", u.Name).Msg("ensuring")
 	url, err := u.getDownloadUrl()
 	if err != nil {
-		return fmt.Errorf("error getting url: %w", err)
+		return false, fmt.Errorf("error getting url: %w", err)
 	}
 
-	dest, err := getDestination(conf, u.Name, u.Tag)
-	if err != nil {
-		return err
-	}
+	return installDownload(ctx, conf, opts, u.installSpec(), u.Tag, url, path.Base(url), nil, u.log)
+}
 
-	symlink, err := getSymlinkName(conf, u.Name, u.Tag)
+func (u *UrlDownload) exportToBundle(ctx context.Context, _ UserConfig, _ GodotConfig, w *bundleWriter) error {
+	url, err := u.getDownloadUrl()
 	if err != nil {
-		return err
+		return fmt.Errorf("error getting url: %w", err)
 	}
+	return w.addDownload(ctx, url, u.Tag, path.Base(url), nil)
+}
 
-	err = downloadAndSymlinkBinary(downloadOpts{
-		Name:         u.Name,
-		DownloadName: path.Base(url),
-		FinalDest:    dest,
-		Url:          url,
-		SymlinkName:  symlink,
-	}, u.log)
-	if err != nil {
-		return fmt.Errorf("error during download/symlink: %w", err)
+func (u *UrlDownload) recordGeneration(conf UserConfig, gen *Generation) error {
+	return gen.addInstall(conf, u.installSpec(), u.Tag)
+}
+
+func (u *UrlDownload) installSpec() installSpec {
+	return installSpec{
+		Name:            u.Name,
+		Binaries:        u.Binaries,
+		InstallMode:     u.InstallMode,
+		StripComponents: u.StripComponents,
+		Links:           u.Links,
 	}
-	return nil
 }
 
 func (u *UrlDownload) getDownloadUrl() (string, error) {
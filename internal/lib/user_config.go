@@ -2,9 +2,11 @@ package lib
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
-	"runtime"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v2"
@@ -23,18 +25,48 @@ type VaultConfig struct {
 	Client             VaultClient
 }
 
+// HostConfig describes how to authenticate against a single forge host, i.e a GitHub Enterprise
+// Server install. Hosts are keyed by hostname in the user config
+type HostConfig struct {
+	User           string         `yaml:"user"`
+	TokenEnv       string         `yaml:"token-env"`
+	TokenFromVault bool           `yaml:"token-from-vault"`
+	TokenConfig    VaultPatConfig `yaml:"token-config"`
+}
+
 type UserConfig struct {
-	BinaryDir      string      `yaml:"binary-dir"`
-	GithubUser     string      `yaml:"github-user"`
-	Target         string      `yaml:"target"`
-	DotfilesURL    string      `yaml:"dotfiles-url"`
-	CloneLocation  string      `yaml:"clone-location"`
-	BuildLocation  string      `yaml:"build-location"`
-	PackageManager string      `yaml:"package-manager"`
-	VaultConfig    VaultConfig `yaml:"vault-config"`
-	GithubPAT      string
-	GithubAuth     string
-	HomeDir        string
+	BinaryDir           string                `yaml:"binary-dir"`
+	GithubUser          string                `yaml:"github-user"`
+	GithubApiUrl        string                `yaml:"github-api-url"`
+	Target              string                `yaml:"target"`
+	DotfilesURL         string                `yaml:"dotfiles-url"`
+	CloneLocation       string                `yaml:"clone-location"`
+	BuildLocation       string                `yaml:"build-location"`
+	PackageManager      string                `yaml:"package-manager"`
+	AurHelper           string                `yaml:"aur-helper"`
+	PrivilegeEscalation string                `yaml:"privilege-escalation"`
+	VaultConfig         VaultConfig           `yaml:"vault-config"`
+	Hosts               map[string]HostConfig `yaml:"hosts"`
+	CacheDir            string                `yaml:"cache-dir"`
+	SharedCacheDirs     []string              `yaml:"shared-cache-dirs"`
+	Http                HttpConfig            `yaml:"http"`
+	GithubPAT           string
+	GithubAuth          string
+	HostTokens          map[string]string
+	HomeDir             string
+	// offline is set when syncing from an offline bundle
+	offline   *offlineBundle
+	client    *http.Client
+	downloads *http.Client
+	runner    CommandRunner
+}
+
+// commandRunner returns the runner external commands should be run through
+func (u UserConfig) commandRunner() CommandRunner {
+	if u.runner != nil {
+		return u.runner
+	}
+	return execRunner{}
 }
 
 type vaultFunc func(*UserConfig) error
@@ -101,6 +133,12 @@ func NewConfigFromPath(confPath string, setClient vaultFunc, overrides ConfigOve
 		conf.BinaryDir = replaceTilde(conf.BinaryDir, home)
 	}
 
+	// Default the github API, this can be pointed at a GitHub Enterprise Server install instead
+	if conf.GithubApiUrl == "" {
+		conf.GithubApiUrl = GithubDefaultApiUrl
+	}
+	conf.GithubApiUrl = strings.TrimSuffix(conf.GithubApiUrl, "/")
+
 	if conf.GithubUser == "" {
 		log.Warn().Msg("github-user not set, requests to the github API might be rate limited")
 	}
@@ -132,20 +170,40 @@ func NewConfigFromPath(confPath string, setClient vaultFunc, overrides ConfigOve
 		conf.BuildLocation = path.Join(home, ".config", "godot", "rendered")
 	}
 
+	// Default the download cache
+	if conf.CacheDir == "" {
+		conf.CacheDir = path.Join(home, ".cache", "godot")
+	} else {
+		conf.CacheDir = replaceTilde(conf.CacheDir, home)
+	}
+	for i, dir := range conf.SharedCacheDirs {
+		conf.SharedCacheDirs[i] = replaceTilde(dir, home)
+	}
+
+	// Build the clients all requests are made through
+	client, downloads, err := newHttpClient(conf.Http, home)
+	if err != nil {
+		return UserConfig{}, fmt.Errorf("error in http config: %w", err)
+	}
+	conf.client = client
+	conf.downloads = downloads
+
 	// Default and validate the package manager
 	if conf.PackageManager == "" {
-		switch runtime.GOOS {
-		case "linux":
-			conf.PackageManager = PackageManagerApt
-		case "darwin":
-			conf.PackageManager = PackageManagerBrew
-		}
+		conf.PackageManager = detectPackageManager()
 	} else {
 		if !isValidPackageManager(conf.PackageManager) {
 			return UserConfig{}, fmt.Errorf("unsupported packaged manager of %v\n", conf.PackageManager)
 		}
 	}
 
+	// Default and validate privilege escalation
+	if conf.PrivilegeEscalation == "" {
+		conf.PrivilegeEscalation = defaultPrivilegeEscalation()
+	} else if !isValidPrivilegeEscalation(conf.PrivilegeEscalation) {
+		return UserConfig{}, fmt.Errorf("unsupported privilege-escalation of %v, must be one of %v", conf.PrivilegeEscalation, strings.Join(validPrivilegeEscalations, ", "))
+	}
+
 	// Initialize the vault client (if requested), since we may get the github pat from vault and
 	// not the environment
 	if !overrides.IgnoreVault {
@@ -181,5 +239,96 @@ func NewConfigFromPath(confPath string, setClient vaultFunc, overrides ConfigOve
 		conf.GithubAuth = BasicAuth(conf.GithubUser, conf.GithubPAT)
 	}
 
+	// And any per-host tokens
+	if err := setHostTokens(&conf, overrides); err != nil {
+		return UserConfig{}, err
+	}
+
 	return conf, nil
 }
+
+func setHostTokens(conf *UserConfig, overrides ConfigOverrides) error {
+	conf.HostTokens = map[string]string{}
+	for host, hostConf := range conf.Hosts {
+		if hostConf.TokenFromVault {
+			if overrides.IgnoreVault {
+				continue
+			}
+			if !conf.VaultConfig.Client.Initialized() {
+				return fmt.Errorf("configured to read token for %v from vault, but vault client not properly initialized", host)
+			}
+			token, err := conf.VaultConfig.Client.ReadKey(hostConf.TokenConfig.Path, hostConf.TokenConfig.Key)
+			if err != nil {
+				return fmt.Errorf("error getting token for %v from vault: %w", host, err)
+			}
+			conf.HostTokens[host] = token
+			continue
+		}
+
+		if hostConf.TokenEnv == "" {
+			continue
+		}
+		token, ok := os.LookupEnv(hostConf.TokenEnv)
+		if !ok {
+			log.Warn().Str("host", host).Msgf("%v not set, requests to %v will be unauthenticated", hostConf.TokenEnv, host)
+			continue
+		}
+		conf.HostTokens[host] = token
+	}
+	return nil
+}
+
+// tokenForHost returns the configured token for the given hostname, falling back to the github PAT
+// for github.com
+func (u UserConfig) tokenForHost(host string) string {
+	if token, ok := u.HostTokens[host]; ok {
+		return token
+	}
+	if host == githubHost {
+		return u.GithubPAT
+	}
+	return ""
+}
+
+// githubAuthFor returns the value of the Authorization header to send to the given GitHub API.
+// Tokens are only ever sent to the host they were configured for
+func (u UserConfig) githubAuthFor(apiUrl string) string {
+	host := hostFromUrl(apiUrl)
+	if token, ok := u.HostTokens[host]; ok {
+		if user := u.Hosts[host].User; user != "" {
+			return BasicAuth(user, token)
+		}
+		return "Bearer " + token
+	}
+	if host == githubHost {
+		return u.GithubAuth
+	}
+	return ""
+}
+
+// sameHost reports if both urls point at the same host and port
+func sameHost(a string, b string) bool {
+	parsedA, err := url.Parse(a)
+	if err != nil {
+		return false
+	}
+	parsedB, err := url.Parse(b)
+	if err != nil {
+		return false
+	}
+	return parsedA.Host != "" && strings.EqualFold(parsedA.Host, parsedB.Host)
+}
+
+// hostFromUrl returns the hostname a url should be keyed by when looking up credentials. The public
+// GitHub API is served from api.github.com, but shares credentials with github.com
+func hostFromUrl(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	host := parsed.Hostname()
+	if host == githubApiHost {
+		return githubHost
+	}
+	return host
+}
@@ -78,3 +78,91 @@ func TestAuthenticationSetup(t *testing.T) {
 	require.Equal(t, "MY_GITHUB_PAT", c.GithubPAT)
 	require.NotEqual(t, "", c.GithubAuth)
 }
+
+func TestHostTokens(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("GHE_TOKEN", "my-ghe-token")
+
+	conf := UserConfig{
+		GithubUser:   "testuser",
+		GithubApiUrl: "https://github.example.com/api/v3/",
+		Hosts: map[string]HostConfig{
+			"github.example.com": {
+				TokenEnv: "GHE_TOKEN",
+			},
+			"git.example.com": {
+				User:           "vaultuser",
+				TokenFromVault: true,
+				TokenConfig: VaultPatConfig{
+					Path: "path/to/key",
+					Key:  "key1",
+				},
+			},
+		},
+	}
+	b, err := yaml.Marshal(conf)
+	require.NoError(t, err)
+	confPath := path.Join(dir, "some-conf.yaml")
+	require.NoError(t, os.WriteFile(confPath, b, 0777))
+
+	c, err := NewConfigFromPath(
+		confPath,
+		func(uc *UserConfig) error {
+			uc.VaultConfig.Client = &MockVaultClient{
+				ReadKeyFunc: func(s1, s2 string) (string, error) {
+					return "my-vault-token", nil
+				},
+			}
+			return nil
+		},
+		ConfigOverrides{},
+	)
+	require.NoError(t, err)
+
+	require.Equal(t, "https://github.example.com/api/v3", c.GithubApiUrl)
+	require.Equal(t, "Bearer my-ghe-token", c.githubAuthFor(c.GithubApiUrl))
+	require.Equal(t, BasicAuth("vaultuser", "my-vault-token"), c.githubAuthFor("https://git.example.com/api/v3"))
+	require.Equal(t, "", c.githubAuthFor("https://unknown.example.com/api/v3"))
+	require.Equal(t, "my-ghe-token", c.tokenForHost("github.example.com"))
+}
+
+func TestPrivilegeEscalation(t *testing.T) {
+	load := func(t *testing.T, escalation string) (UserConfig, error) {
+		t.Helper()
+		b, err := yaml.Marshal(UserConfig{GithubUser: "testuser", PrivilegeEscalation: escalation})
+		require.NoError(t, err)
+		confPath := path.Join(t.TempDir(), "some-conf.yaml")
+		require.NoError(t, os.WriteFile(confPath, b, 0777))
+		return NewConfigFromPath(confPath, nil, ConfigOverrides{IgnoreVault: true})
+	}
+
+	t.Run("defaulted", func(t *testing.T) {
+		c, err := load(t, "")
+		require.NoError(t, err)
+		require.Equal(t, defaultPrivilegeEscalation(), c.PrivilegeEscalation)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := load(t, "su")
+		require.ErrorContains(t, err, "unsupported privilege-escalation of su")
+	})
+
+	testData := []struct {
+		escalation string
+		argv       []string
+		want       []string
+	}{
+		{escalation: "", argv: []string{"apt-get", "update"}, want: []string{"sudo", "apt-get", "update"}},
+		{escalation: PrivilegeEscalationSudo, argv: []string{"DEBIAN_FRONTEND=noninteractive", "apt", "install"}, want: []string{"sudo", "DEBIAN_FRONTEND=noninteractive", "apt", "install"}},
+		{escalation: PrivilegeEscalationDoas, argv: []string{"apt-get", "update"}, want: []string{"doas", "apt-get", "update"}},
+		{escalation: PrivilegeEscalationDoas, argv: []string{"DEBIAN_FRONTEND=noninteractive", "apt", "install"}, want: []string{"doas", "env", "DEBIAN_FRONTEND=noninteractive", "apt", "install"}},
+		{escalation: PrivilegeEscalationNone, argv: []string{"apt-get", "update"}, want: []string{"apt-get", "update"}},
+		{escalation: PrivilegeEscalationNone, argv: []string{"DEBIAN_FRONTEND=noninteractive", "apt", "install"}, want: []string{"env", "DEBIAN_FRONTEND=noninteractive", "apt", "install"}},
+	}
+	for _, tc := range testData {
+		t.Run("escalate_"+tc.escalation+"_"+tc.argv[0], func(t *testing.T) {
+			bin, args := UserConfig{PrivilegeEscalation: tc.escalation}.escalate(tc.argv...)
+			require.Equal(t, tc.want, append([]string{bin}, args...))
+		})
+	}
+}
@@ -5,14 +5,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/carlmjohnson/requests"
 	"github.com/flytam/filenamify"
+	"github.com/hashicorp/go-multierror"
 	"github.com/rs/zerolog"
 )
 
@@ -32,9 +35,35 @@ func ensureContainingDir(destpath string) error {
 	return nil
 }
 
-func runCmd(bin string, args ...string) (string, string, error) {
+// CommandRunner runs external commands, returning their stdout & stderr
+type CommandRunner interface {
+	Run(ctx context.Context, bin string, args ...string) (string, string, error)
+}
+
+// execRunner runs commands for real
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, bin string, args ...string) (string, string, error) {
+	return runCmd(ctx, bin, args...)
+}
+
+// findTool resolves the binary for a tool, falling back to the places installers like rustup put
+// them, since those aren't necessarily on the PATH while syncing
+func findTool(name string, fallbacks ...string) string {
+	if _, err := exec.LookPath(name); err == nil {
+		return name
+	}
+	for _, fallback := range fallbacks {
+		if _, err := os.Stat(fallback); err == nil {
+			return fallback
+		}
+	}
+	return name
+}
+
+func runCmd(ctx context.Context, bin string, args ...string) (string, string, error) {
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(bin, args...)
+	cmd := exec.CommandContext(ctx, bin, args...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	err := cmd.Run()
@@ -71,6 +100,7 @@ func getSymlinkName(conf UserConfig, name string, tag string) (string, error) {
 	return strings.TrimSuffix(dest, "-"+normTag), nil
 }
 
+// copyToDestination copies src to dest as an executable, atomically
 func copyToDestination(src string, dest string) error {
 	sfile, err := os.Open(src)
 	if err != nil {
@@ -82,95 +112,257 @@ func copyToDestination(src string, dest string) error {
 		return err
 	}
 
-	dfile, err := os.Create(dest)
-	if err != nil {
-		return fmt.Errorf("error creating destination file: %w", err)
-	}
-	defer dfile.Close()
+	return writeAtomic(dest, 0755, func(w io.Writer) error {
+		if _, err := io.Copy(w, sfile); err != nil {
+			return fmt.Errorf("error copying binary to destination: %w", err)
+		}
+		return nil
+	})
+}
 
-	_, err = io.Copy(dfile, sfile)
+// writeAtomic writes dest with the contents produced by write. The contents are written to a
+// temporary file alongside dest and renamed into place, so an interrupted or failed write never
+// leaves a partial file behind, or clobbers what was already there
+func writeAtomic(dest string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(dest), ".godot-"+filepath.Base(dest)+"-")
 	if err != nil {
-		return fmt.Errorf("error copying binary to destination: %w", err)
+		return fmt.Errorf("error creating temp file for %v: %w", dest, err)
 	}
+	defer func() {
+		f.Close()
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
 
-	if err := os.Chmod(dest, 0755); err != nil {
-		return fmt.Errorf("error chmoding destination file: %w", err)
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing %v: %w", dest, err)
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return fmt.Errorf("error chmoding %v: %w", dest, err)
+	}
+	if err := os.Rename(f.Name(), dest); err != nil {
+		return fmt.Errorf("error moving %v into place: %w", dest, err)
 	}
 	return nil
 }
 
+// createSymlink points dest at src. The link is created under a temporary name and renamed over
+// dest, so dest is never missing part way through
 func createSymlink(src string, dest string) error {
-	exists, err := pathExists(dest)
-	if err != nil {
-		return fmt.Errorf("Error checking path existance: %w", err)
-	}
-	if exists {
-		err := os.Remove(dest)
-		if err != nil {
-			return fmt.Errorf("Error removing existing file: %w", err)
+	// A rename can't replace a directory, so those have to be removed up front
+	if info, err := os.Lstat(dest); err == nil && info.IsDir() {
+		if err := os.Remove(dest); err != nil {
+			return fmt.Errorf("Error removing existing directory: %w", err)
 		}
 	}
-	err = os.Symlink(src, dest)
-	if err != nil {
-		return fmt.Errorf("Error symlinking binary to tagged version: %w", err)
+
+	tmp := filepath.Join(filepath.Dir(dest), fmt.Sprintf(".godot-%v-%v.link", filepath.Base(dest), os.Getpid()))
+	_ = os.Remove(tmp)
+	if err := os.Symlink(src, tmp); err != nil {
+		return fmt.Errorf("Error symlinking %v to %v: %w", dest, src, err)
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("Error moving symlink into place: %w", err)
 	}
 	return nil
 }
 
+// ensureSymlink points dest at src, recording dest in the journal first. It reports whether dest had
+// to change
+func ensureSymlink(j *journal, src string, dest string) (bool, error) {
+	if target, err := os.Readlink(dest); err == nil && target == src {
+		return false, nil
+	}
+	if err := j.record(dest); err != nil {
+		return false, err
+	}
+	if err := createSymlink(src, dest); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 type downloadOpts struct {
 	Name         string
 	DownloadName string
 	FinalDest    string
 	Url          string
+	Version      string
 	RequestFunc  func(*requests.Builder)
 	SearchFunc   searchFunc
 	SymlinkName  string
+	Cache        downloadCache
+	Client       *http.Client
+	// Binaries, if given, are installed instead of the single binary described by FinalDest,
+	// SearchFunc & SymlinkName
+	Binaries []installBinary
+	Journal  *journal
 }
 
-func downloadAndSymlinkBinary(opts downloadOpts, logger zerolog.Logger) error {
-	exists, err := pathExists(opts.FinalDest)
-	if err != nil {
-		return fmt.Errorf("unable to check existance of %v: %w", opts.FinalDest, err)
+// installBinary describes a single executable to pull out of a download, and where to put it
+type installBinary struct {
+	Name        string
+	BinaryPath  string
+	SearchFunc  searchFunc
+	FinalDest   string
+	SymlinkName string
+}
+
+// Binary maps an executable inside of a downloaded archive to the name it should be installed as.
+// The executable is found either by its path relative to the root of the archive, or by a regex
+type Binary struct {
+	Name  string `yaml:"name" mapstructure:"name"`
+	Path  string `yaml:"path" mapstructure:"path"`
+	Regex string `yaml:"regex" mapstructure:"regex"`
+}
+
+func validateBinaries(binaries []Binary) error {
+	var errs *multierror.Error
+
+	names := map[string]struct{}{}
+	for i, bin := range binaries {
+		if bin.Name == "" {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: name is required", i))
+		} else if strings.ContainsAny(bin.Name, `/\`) || bin.Name == "." || bin.Name == ".." {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: name %v must be a plain file name", i, bin.Name))
+		}
+		if _, ok := names[bin.Name]; ok {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: duplicate name %v", i, bin.Name))
+		}
+		names[bin.Name] = struct{}{}
+
+		if bin.Path == "" && bin.Regex == "" {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: one of path or regex is required", i))
+		}
+		if bin.Path != "" && (!validRelPath(bin.Path) || path.Clean(bin.Path) == ".." || strings.HasSuffix(bin.Path, "/..")) {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: path %v must be a relative path inside the archive", i, bin.Path))
+		}
+		if bin.Path != "" && bin.Regex != "" {
+			errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: cannot specify both path and regex", i))
+		}
+		if bin.Regex != "" {
+			if _, err := regexp.Compile(bin.Regex); err != nil {
+				errs = multierror.Append(errs, fmt.Errorf("binaries[%v]: unable to compile regex: %w", i, err))
+			}
+		}
 	}
-	if exists {
-		logger.Info().Str("name", opts.Name).Msg("already exists, skipping")
-		return nil
+
+	return errs.ErrorOrNil()
+}
+
+// binaryInstalls computes the versioned destination & symlink of each requested binary
+func binaryInstalls(conf UserConfig, tag string, binaries []Binary) ([]installBinary, error) {
+	installs := []installBinary{}
+	for _, bin := range binaries {
+		dest, err := getDestination(conf, bin.Name, tag)
+		if err != nil {
+			return nil, err
+		}
+		symlink, err := getSymlinkName(conf, bin.Name, tag)
+		if err != nil {
+			return nil, err
+		}
+		search, err := regexSearchFunc(bin.Regex)
+		if err != nil {
+			return nil, err
+		}
+		installs = append(installs, installBinary{
+			Name:        bin.Name,
+			BinaryPath:  bin.Path,
+			SearchFunc:  search,
+			FinalDest:   dest,
+			SymlinkName: symlink,
+		})
+	}
+	return installs, nil
+}
+
+func (d downloadOpts) binaries() []installBinary {
+	if len(d.Binaries) > 0 {
+		return d.Binaries
+	}
+	return []installBinary{
+		{
+			Name:        d.Name,
+			SearchFunc:  d.SearchFunc,
+			FinalDest:   d.FinalDest,
+			SymlinkName: d.SymlinkName,
+		},
+	}
+}
+
+// downloadAndSymlinkBinary installs any of the binaries that are missing, and points the symlinks of
+// those already installed back at them, reporting whether anything changed
+func downloadAndSymlinkBinary(ctx context.Context, opts downloadOpts, logger zerolog.Logger) (bool, error) {
+	missing := []installBinary{}
+	relinked := false
+	for _, bin := range opts.binaries() {
+		exists, err := pathExists(bin.FinalDest)
+		if err != nil {
+			return false, fmt.Errorf("unable to check existance of %v: %w", bin.FinalDest, err)
+		}
+		if !exists {
+			missing = append(missing, bin)
+			continue
+		}
+		logger.Info().Str("name", bin.Name).Msg("already exists, skipping")
+		changed, err := ensureSymlink(opts.Journal, bin.FinalDest, bin.SymlinkName)
+		if err != nil {
+			return false, err
+		}
+		relinked = relinked || changed
+	}
+	if len(missing) == 0 {
+		return relinked, nil
 	}
 
 	logger.Info().Str("name", opts.Name).Msg("downloading")
 
 	dir, err := os.MkdirTemp("", "godot-")
 	if err != nil {
-		return fmt.Errorf("unable to make temp directory")
+		return false, fmt.Errorf("unable to make temp directory")
 	}
 	defer os.RemoveAll(dir)
 
 	filepath := path.Join(dir, opts.DownloadName)
-	req := requests.
-		URL(opts.Url).
-		ToFile(filepath)
-
-	if opts.RequestFunc != nil {
-		opts.RequestFunc(req)
-	}
-	err = req.Fetch(context.TODO())
-	if err != nil {
-		return fmt.Errorf("error downloading from url: %w", err)
+	if err := fetchToFile(ctx, opts.Cache, opts.Client, opts.Url, opts.Version, filepath, opts.RequestFunc, logger); err != nil {
+		return false, err
 	}
 
 	extractDir := path.Join(dir, "extract")
-	binary, err := extractBinary(filepath, extractDir, "", opts.SearchFunc)
+	root, isArchive, err := unpackDownload(ctx, filepath, extractDir, logger)
 	if err != nil {
-		return err
+		return false, err
 	}
-	if err := copyToDestination(binary, opts.FinalDest); err != nil {
-		return err
+	if !isArchive && len(missing) > 1 {
+		return false, fmt.Errorf("%v is not an archive, cannot install multiple binaries from it", opts.DownloadName)
 	}
-	if err := createSymlink(opts.FinalDest, opts.SymlinkName); err != nil {
-		return err
+
+	for _, bin := range missing {
+		binary := root
+		if isArchive {
+			binary, err = locateBinary(root, bin.BinaryPath, bin.SearchFunc)
+			if err != nil {
+				return false, fmt.Errorf("error locating %v: %w", bin.Name, err)
+			}
+		}
+		if err := opts.Journal.record(bin.FinalDest); err != nil {
+			return false, err
+		}
+		if err := copyToDestination(binary, bin.FinalDest); err != nil {
+			return false, err
+		}
+		if _, err := ensureSymlink(opts.Journal, bin.FinalDest, bin.SymlinkName); err != nil {
+			return false, err
+		}
 	}
 
-	return nil
+	return true, nil
 }
 
 func pathExists(loc string) (bool, error) {
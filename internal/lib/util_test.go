@@ -1,6 +1,11 @@
 package lib
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -56,3 +61,140 @@ func TestTagNormalization(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadMultipleBinaries(t *testing.T) {
+	archive := buildTarGz(t, map[string]string{
+		"kube/bin/kubectl":         "kubectl",
+		"kube/bin/kubectl-convert": "kubectl-convert",
+		"kube/README":              "readme",
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, archive)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	u := UrlDownload{
+		Name:     "kubectl",
+		Tag:      "v1.30.0",
+		LinuxUrl: srv.URL + "/kube.tar.gz",
+		MacUrl:   srv.URL + "/kube.tar.gz",
+		Binaries: []Binary{
+			{Name: "kubectl", Path: "kube/bin/kubectl"},
+			{Name: "kubectl-convert", Regex: "convert$"},
+		},
+	}
+	require.NoError(t, u.Validate())
+	_, err := u.Execute(context.Background(), UserConfig{BinaryDir: dir}, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+
+	requireContents(t, filepath.Join(dir, "kubectl-v1.30.0"), "kubectl")
+	requireContents(t, filepath.Join(dir, "kubectl"), "kubectl")
+	requireContents(t, filepath.Join(dir, "kubectl-convert-v1.30.0"), "kubectl-convert")
+	requireContents(t, filepath.Join(dir, "kubectl-convert"), "kubectl-convert")
+
+	// Removing one of the binaries should only reinstall that one
+	require.NoError(t, os.Remove(filepath.Join(dir, "kubectl-convert-v1.30.0")))
+	_, err = u.Execute(context.Background(), UserConfig{BinaryDir: dir}, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	requireContents(t, filepath.Join(dir, "kubectl-convert"), "kubectl-convert")
+
+	t.Run("existing binaries are relinked", func(t *testing.T) {
+		// i.e after a rollback pointed the link at an older version
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "kubectl-v1.29.0"), []byte("old"), 0755))
+		require.NoError(t, createSymlink(filepath.Join(dir, "kubectl-v1.29.0"), filepath.Join(dir, "kubectl")))
+
+		changed, err := u.Execute(context.Background(), UserConfig{BinaryDir: dir}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.True(t, changed)
+		requireContents(t, filepath.Join(dir, "kubectl"), "kubectl")
+
+		changed, err = u.Execute(context.Background(), UserConfig{BinaryDir: dir}, SyncOpts{}, GodotConfig{})
+		require.NoError(t, err)
+		require.False(t, changed)
+	})
+}
+
+func TestValidateBinaries(t *testing.T) {
+	err := validateBinaries([]Binary{
+		{Name: "a", Path: "bin/a"},
+		{Name: "a", Regex: "a$"},
+		{Name: "b"},
+		{Path: "bin/c", Regex: "c$"},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "duplicate name a")
+	require.Contains(t, err.Error(), "binaries[2]: one of path or regex is required")
+	require.Contains(t, err.Error(), "binaries[3]: name is required")
+	require.Contains(t, err.Error(), "binaries[3]: cannot specify both path and regex")
+
+	t.Run("names & paths stay inside their directories", func(t *testing.T) {
+		for _, name := range []string{"../x", "a/b", ".", ".."} {
+			err := validateBinaries([]Binary{{Name: name, Path: "bin/x"}})
+			require.ErrorContains(t, err, "must be a plain file name", name)
+		}
+		for _, p := range []string{"../x", "bin/../../x", "/usr/bin/x", "..", "bin/.."} {
+			err := validateBinaries([]Binary{{Name: "x", Path: p}})
+			require.ErrorContains(t, err, "must be a relative path inside the archive", p)
+		}
+		require.NoError(t, validateBinaries([]Binary{{Name: "x", Path: "./bin/x"}}))
+	})
+}
+
+func TestCancelledDownload(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stall := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1024")
+		_, _ = w.Write([]byte("#!/bin/sh\n"))
+		if !stall {
+			_, _ = w.Write(make([]byte, 1014))
+			return
+		}
+		w.(http.Flusher).Flush()
+		cancel()
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	u := UrlDownload{
+		Name:     "tool",
+		Tag:      "v1.0.0",
+		LinuxUrl: srv.URL + "/tool",
+		MacUrl:   srv.URL + "/tool",
+	}
+	conf := UserConfig{BinaryDir: dir, CacheDir: t.TempDir()}
+	_, err := u.Execute(ctx, conf, SyncOpts{}, GodotConfig{})
+	require.ErrorIs(t, err, context.Canceled)
+
+	// Nothing should be left behind that looks installed
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	stall = false
+	_, err = u.Execute(context.Background(), conf, SyncOpts{}, GodotConfig{})
+	require.NoError(t, err)
+	info, err := os.Stat(filepath.Join(dir, "tool-v1.0.0"))
+	require.NoError(t, err)
+	require.Equal(t, int64(1024), info.Size())
+}
+
+func TestCopyToDestination(t *testing.T) {
+	dir := buildDirectoryStructure(t, map[string]string{"src": "new"})
+	dest := filepath.Join(t.TempDir(), "bin", "tool")
+	require.NoError(t, copyToDestination(filepath.Join(dir, "src"), dest))
+	requireContents(t, dest, "new")
+
+	info, err := os.Stat(dest)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	// A failed copy should leave the existing file and no temporary files behind
+	require.Error(t, copyToDestination(dir, dest))
+	requireContents(t, dest, "new")
+	entries, err := os.ReadDir(filepath.Dir(dest))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 
 	"github.com/nicjohnson145/godot/internal/lib"
 	"github.com/rs/zerolog"
@@ -16,7 +24,16 @@ var (
 )
 
 func main() {
-	if err := buildCommand().Execute(); err != nil {
+	// Cancel on Ctrl-C/SIGTERM so in flight downloads and commands stop, and partial installs are
+	// cleaned up rather than left behind
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := buildCommand().ExecuteContext(ctx); err != nil {
+		if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+			fmt.Println("interrupted")
+			os.Exit(130)
+		}
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
@@ -57,13 +74,15 @@ func buildCommand() *cobra.Command {
 		Short: "Sync configuration",
 		Long:  "Sync local filesystem with configuration",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return lib.Sync(syncOpts, initLogger(verbose, debug))
+			return lib.Sync(cmd.Context(), syncOpts, initLogger(verbose, debug))
 		},
 	}
 	syncCmd.Flags().BoolVarP(&syncOpts.Quick, "quick", "q", false, "Run a quick sync, skipping some stages")
 	syncCmd.Flags().StringSliceVarP(&syncOpts.Ignore, "ignore", "i", []string{}, "Ignore these configs")
 	syncCmd.Flags().BoolVar(&syncOpts.NoVault, "no-vault", false, "Ignore vault lookup directives in templates")
 	syncCmd.Flags().StringSliceVarP(&syncOpts.Executors, "executors", "e", []string{}, fmt.Sprintf("Limit run to only these executor types (valid values: %v)", lib.ExecutorTypeNames()))
+	syncCmd.Flags().StringVar(&syncOpts.FromBundle, "from-bundle", "", "Sync without network access from a bundle created by 'bundle export'")
+	syncCmd.Flags().BoolVar(&syncOpts.NoRollback, "no-rollback", false, "Leave changes from earlier executors in place if the sync fails")
 	rootCmd.AddCommand(syncCmd)
 
 	validateCmd := &cobra.Command{
@@ -95,7 +114,7 @@ func buildCommand() *cobra.Command {
 		Args:  cobra.NoArgs,
 		Long:  "Check for newer version and install if found",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return lib.SelfUpdate(lib.SelfUpdateOpts{
+			return lib.SelfUpdate(cmd.Context(), lib.SelfUpdateOpts{
 				Logger: initLogger(true, false),
 				CurrentVersion: version,
 				IgnoreVault: updateIgnoreVault,
@@ -105,5 +124,188 @@ func buildCommand() *cobra.Command {
 	updateCmd.Flags().BoolVar(&updateIgnoreVault, "no-vault", false, "Ignore vault integrations")
 	rootCmd.AddCommand(updateCmd)
 
+	rootCmd.AddCommand(buildCacheCommand(&verbose, &debug))
+	rootCmd.AddCommand(buildBundleCommand(&verbose, &debug))
+	rootCmd.AddCommand(buildGenerationsCommand())
+
+	gcOpts := lib.GcOpts{}
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove old versions",
+		Long: "Remove versioned binaries and directories that are not referenced by the current symlinks or the most recent generations.\n\n" +
+			"Only what a generation recorded installing is removed. Unused versions of managed binaries that were installed " +
+			"before generations existed are listed as unmanaged and left alone, and can be removed by hand",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gcOpts.Logger = initLogger(verbose, debug)
+			result, err := lib.Gc(gcOpts)
+			if err != nil {
+				return err
+			}
+			verb := "Removed"
+			if gcOpts.DryRun {
+				verb = "Would remove"
+			}
+			for _, entry := range result.Removed {
+				fmt.Printf("%v %v (%v)\n", verb, entry.Path, lib.FormatBytes(entry.Size))
+			}
+			for _, entry := range result.Unmanaged {
+				fmt.Printf("Unmanaged, not removed %v (%v)\n", entry.Path, lib.FormatBytes(entry.Size))
+			}
+			for _, number := range result.Generations {
+				fmt.Printf("%v generation %v\n", verb, number)
+			}
+			fmt.Printf("%v %v total\n", verb, lib.FormatBytes(result.Reclaimed()))
+			return nil
+		},
+	}
+	gcCmd.Flags().IntVar(&gcOpts.Keep, "keep", 0, "Also keep everything referenced by this many of the most recent generations")
+	gcCmd.Flags().BoolVar(&gcOpts.DryRun, "dry-run", false, "List what would be removed without removing anything")
+	rootCmd.AddCommand(gcCmd)
+
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback [generation]",
+		Short: "Roll back to a previous generation",
+		Long:  "Re-point symlinks at the versions installed by a previous sync, and restore its rendered config files. Defaults to the generation before the current one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts := lib.RollbackOpts{
+				Logger: initLogger(true, false),
+			}
+			if len(args) == 1 {
+				n, err := strconv.Atoi(args[0])
+				if err != nil || n < 1 {
+					return fmt.Errorf("invalid generation %q", args[0])
+				}
+				opts.Generation = n
+			}
+			return lib.Rollback(opts)
+		},
+	}
+	rootCmd.AddCommand(rollbackCmd)
+
 	return rootCmd
 }
+
+func buildCacheCommand(verbose *bool, debug *bool) *cobra.Command {
+	var olderThan string
+
+	cacheCmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the download cache",
+		Long:  "Inspect and clean up the cache of downloaded release assets and tarballs",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List cached downloads",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entries, err := lib.CacheList()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVERSION\tSIZE\tLAST USED\tSHA256\tURL")
+			for _, e := range entries {
+				name := e.Name
+				if e.Shared {
+					name += " (shared)"
+				}
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", name, e.Version, e.Size, e.LastUsed.Format("2006-01-02 15:04"), e.ShortSha256(), e.Url)
+			}
+			return w.Flush()
+		},
+	}
+	cacheCmd.AddCommand(listCmd)
+
+	cleanCmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove all cached downloads",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lib.CacheClean(initLogger(*verbose, *debug))
+		},
+	}
+	cacheCmd.AddCommand(cleanCmd)
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove stale cached downloads",
+		Long:  "Remove cached downloads that have not been used within the given age",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return lib.CachePrune(olderThan, initLogger(*verbose, *debug))
+		},
+	}
+	pruneCmd.Flags().StringVar(&olderThan, "older-than", "30d", "Remove downloads not used within this age (i.e 72h, 30d)")
+	cacheCmd.AddCommand(pruneCmd)
+
+	return cacheCmd
+}
+
+func buildBundleCommand(verbose *bool, debug *bool) *cobra.Command {
+	exportOpts := lib.BundleExportOpts{}
+
+	bundleCmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "Manage offline bundles",
+		Long:  "Create bundles that allow syncing a target on machines without network access",
+	}
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export an offline bundle",
+		Long: "Resolve and download everything needed to sync a target, and write it to a single tarball. " +
+			"With --allow-vault the bundle holds secrets in plain text, it's only readable by you but should be handled with care",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			exportOpts.Logger = initLogger(*verbose, *debug)
+			return lib.BundleExport(cmd.Context(), exportOpts)
+		},
+	}
+	exportCmd.Flags().StringVarP(&exportOpts.Target, "target", "t", "", "Target to export (defaults to the configured target)")
+	exportCmd.Flags().StringVarP(&exportOpts.Output, "output", "o", "bundle.tar", "Path to write the bundle to")
+	exportCmd.Flags().BoolVar(&exportOpts.AllowVault, "allow-vault", false, "Resolve vault lookups in templates and store the values, in plain text, in the bundle")
+	bundleCmd.AddCommand(exportCmd)
+
+	return bundleCmd
+}
+
+func buildGenerationsCommand() *cobra.Command {
+	generationsCmd := &cobra.Command{
+		Use:   "generations",
+		Short: "Manage generations",
+		Long:  "Inspect the generations recorded after each successful sync",
+	}
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List generations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			generations, err := lib.GenerationList()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "GENERATION\tCREATED\tTARGET\tVERSIONS")
+			for _, g := range generations {
+				number := strconv.Itoa(g.Number)
+				if g.Current {
+					number += " (current)"
+				}
+				versions := []string{}
+				for name, version := range g.Versions {
+					versions = append(versions, name+"@"+version)
+				}
+				sort.Strings(versions)
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", number, g.Created.Format("2006-01-02 15:04"), g.Target, strings.Join(versions, ", "))
+			}
+			return w.Flush()
+		},
+	}
+	generationsCmd.AddCommand(listCmd)
+
+	return generationsCmd
+}